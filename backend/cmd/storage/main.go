@@ -5,35 +5,56 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
 	config "openreplay/backend/internal/config/storage"
 	"openreplay/backend/internal/storage"
+	"openreplay/backend/pkg/db/postgres/pool"
 	"openreplay/backend/pkg/failover"
 	"openreplay/backend/pkg/logger"
 	"openreplay/backend/pkg/messages"
 	"openreplay/backend/pkg/metrics"
 	storageMetrics "openreplay/backend/pkg/metrics/storage"
 	"openreplay/backend/pkg/objectstorage/store"
+	"openreplay/backend/pkg/projects"
 	"openreplay/backend/pkg/queue"
+	"openreplay/backend/pkg/sessions"
 )
 
 func main() {
 	ctx := context.Background()
 	log := logger.New()
 	cfg := config.New(log)
+	if err := storageMetrics.SetDurationBuckets(cfg.MetricsDurationBuckets); err != nil {
+		log.Fatal(ctx, "can't set metrics buckets: %s", err)
+	}
 	metrics.New(log, storageMetrics.List())
 
 	objStore, err := store.NewStore(&cfg.ObjectsConfig)
 	if err != nil {
 		log.Fatal(ctx, "can't init object storage: %s", err)
 	}
-	srv, err := storage.New(cfg, log, objStore)
+	srv, err := storage.New(cfg, log, objStore, nil)
 	if err != nil {
 		log.Fatal(ctx, "can't init storage service: %s", err)
 	}
 
+	// SessionEnd doesn't contain the project id, it's read from the sessions table
+	var sessManager sessions.Sessions
+	if cfg.ProjectLookup {
+		if cfg.PostgresString == "" {
+			log.Fatal(ctx, "PROJECT_LOOKUP requires POSTGRES_STRING")
+		}
+		pgConn, err := pool.New(cfg.PostgresString)
+		if err != nil {
+			log.Fatal(ctx, "can't init postgres connection: %s", err)
+		}
+		defer pgConn.Close()
+		sessManager = sessions.New(log, pgConn, projects.New(log, pgConn, nil), nil)
+	}
+
 	counter := storage.NewLogCounter()
 	sessionFinder, err := failover.NewSessionFinder(log, cfg, srv)
 	if err != nil {
@@ -57,6 +78,13 @@ func main() {
 					msg.Meta().SetMeta(oldMeta)
 				}
 				sessCtx := context.WithValue(context.Background(), "sessionID", fmt.Sprintf("%d", msg.SessionID()))
+				if sessManager != nil {
+					if sess, err := sessManager.Get(msg.SessionID()); err != nil {
+						log.Warn(sessCtx, "can't get project of the session: %s", err)
+					} else {
+						sessCtx = storage.WithProject(sessCtx, strconv.FormatUint(uint64(sess.ProjectID), 10), sess.TrackerVersion)
+					}
+				}
 				// Process session to save mob files to s3
 				sesEnd := msg.(*messages.SessionEnd)
 				if err := srv.Process(sessCtx, sesEnd); err != nil {
@@ -84,7 +112,11 @@ func main() {
 		case sig := <-sigchan:
 			log.Info(ctx, "caught signal %v: terminating", sig)
 			sessionFinder.Stop()
-			srv.Wait()
+			closeCtx, cancel := context.WithTimeout(ctx, cfg.ShutdownTimeout)
+			if err := srv.Close(closeCtx); err != nil {
+				log.Error(ctx, "can't close storage: %s", err)
+			}
+			cancel()
 			consumer.Close()
 			os.Exit(0)
 		case <-counterTick:
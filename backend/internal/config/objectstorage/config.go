@@ -3,18 +3,26 @@ package objectstorage
 // Object storage configuration
 
 type ObjectsConfig struct {
-	ServiceName          string `env:"SERVICE_NAME,required"`
-	CloudName            string `env:"CLOUD,default=aws"`
-	BucketName           string `env:"BUCKET_NAME,required"`
-	AWSRegion            string `env:"AWS_REGION"`
-	AWSAccessKeyID       string `env:"AWS_ACCESS_KEY_ID"`
-	AWSSecretAccessKey   string `env:"AWS_SECRET_ACCESS_KEY"`
-	AWSEndpoint          string `env:"AWS_ENDPOINT"`
-	AWSSkipSSLValidation bool   `env:"AWS_SKIP_SSL_VALIDATION"`
-	AzureAccountName     string `env:"AZURE_ACCOUNT_NAME"`
-	AzureAccountKey      string `env:"AZURE_ACCOUNT_KEY"`
-	UseS3Tags            bool   `env:"USE_S3_TAGS,default=true"`
-	AWSIAMRole           string `env:"AWS_IAM_ROLE"`
+	ServiceName             string `env:"SERVICE_NAME,required"`
+	CloudName               string `env:"CLOUD,default=aws"`
+	BucketName              string `env:"BUCKET_NAME,required"`
+	AWSRegion               string `env:"AWS_REGION"`        // resolved by the SDK if empty, optional with AWS_ENDPOINT
+	AWSAccessKeyID          string `env:"AWS_ACCESS_KEY_ID"` // set together with the secret, the default credential chain is used if both are empty, also with AWS_ENDPOINT
+	AWSSecretAccessKey      string `env:"AWS_SECRET_ACCESS_KEY"`
+	AWSEndpoint             string `env:"AWS_ENDPOINT"`
+	AWSSkipSSLValidation    bool   `env:"AWS_SKIP_SSL_VALIDATION"`
+	AWSPathStyle            bool   `env:"AWS_PATH_STYLE,default=true"`       // used with AWS_ENDPOINT only, AWS itself is always addressed in virtual-host style
+	AWSMultipartThreshold   int64  `env:"AWS_MULTIPART_THRESHOLD,default=0"` // 0 - multipart uploads are managed by aws sdk
+	AWSMultipartPartSize    int64  `env:"AWS_MULTIPART_PART_SIZE,default=5242880"`
+	AWSMultipartRetries     int    `env:"AWS_MULTIPART_RETRIES,default=3"` // per part
+	AWSServerSideEncryption string `env:"AWS_SERVER_SIDE_ENCRYPTION"`      // AES256 (SSE-S3) or aws:kms (SSE-KMS), bucket's default if empty; applied on top of ENCRYPTION_MODE
+	AWSSSEKMSKeyID          string `env:"AWS_SSE_KMS_KEY_ID"`              // used with aws:kms only, AWS managed key if empty
+	AzureAccountName        string `env:"AZURE_ACCOUNT_NAME"`
+	AzureAccountKey         string `env:"AZURE_ACCOUNT_KEY"`
+	AzureConnString         string `env:"AZURE_CONNECTION_STRING"` // used instead of account name and key if set
+	UseS3Tags               bool   `env:"USE_S3_TAGS,default=true"`
+	AWSIAMRole              string `env:"AWS_IAM_ROLE"`
+	GCPCredentialsPath      string `env:"GCP_CREDENTIALS_PATH"`
 }
 
 func (c *ObjectsConfig) UseFileTags() bool {
@@ -1,31 +1,118 @@
 package storage
 
 import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
 	"openreplay/backend/internal/config/common"
 	"openreplay/backend/internal/config/configurator"
 	"openreplay/backend/internal/config/objectstorage"
 	"openreplay/backend/pkg/logger"
-	"time"
 )
 
 type Config struct {
 	common.Config
 	objectstorage.ObjectsConfig
-	FSDir                string        `env:"FS_DIR,required"`
-	FileSplitSize        int           `env:"FILE_SPLIT_SIZE,required"`
-	FileSplitTime        time.Duration `env:"FILE_SPLIT_TIME,default=15s"`
-	RetryTimeout         time.Duration `env:"RETRY_TIMEOUT,default=2m"`
-	GroupStorage         string        `env:"GROUP_STORAGE,required"`
-	TopicTrigger         string        `env:"TOPIC_TRIGGER,required"`
-	GroupFailover        string        `env:"GROUP_STORAGE_FAILOVER"`
-	TopicFailover        string        `env:"TOPIC_STORAGE_FAILOVER"`
-	DeleteTimeout        time.Duration `env:"DELETE_TIMEOUT,default=48h"`
-	ProducerCloseTimeout int           `env:"PRODUCER_CLOSE_TIMEOUT,default=15000"`
-	UseFailover          bool          `env:"USE_FAILOVER,default=false"`
-	MaxFileSize          int64         `env:"MAX_FILE_SIZE,default=524288000"`
-	UseSort              bool          `env:"USE_SESSION_SORT,default=true"`
-	UseProfiler          bool          `env:"PROFILER_ENABLED,default=false"`
-	CompressionAlgo      string        `env:"COMPRESSION_ALGO,default=zstd"` // none, gzip, brotli, zstd
+	FSDir                     string             `env:"FS_DIR,required"`
+	Source                    string             `env:"SESSION_FILES_SOURCE,default=local"` // local or objectstorage, FS_DIR is the key prefix for objectstorage
+	MirrorBucketName          string             `env:"MIRROR_BUCKET_NAME"`                 // uploaded sessions are copied to this bucket if set
+	MirrorRegion              string             `env:"MIRROR_REGION"`                      // AWS_REGION if empty
+	MirrorAsync               bool               `env:"MIRROR_ASYNC,default=true"`          // best-effort mirroring in background workers
+	MirrorMaxRetries          int                `env:"MIRROR_MAX_RETRIES,default=3"`
+	ColdBucketName            string             `env:"COLD_BUCKET_NAME"` // DOM parts after the start part are uploaded to this bucket if set, the indexed layout isn't split between buckets
+	ColdRegion                string             `env:"COLD_REGION"`      // AWS_REGION if empty
+	SourceBucketName          string             `env:"SOURCE_BUCKET_NAME"`
+	FileSplitSize             int                `env:"FILE_SPLIT_SIZE,required"`
+	FileSplitTime             time.Duration      `env:"FILE_SPLIT_TIME,default=15s"`
+	MaxFileSplits             int                `env:"MAX_FILE_SPLITS,default=2"`        // more than 2 splits the end part by FILE_SPLIT_SIZE
+	SplitStatsInterval        time.Duration      `env:"SPLIT_STATS_INTERVAL,default=10m"` // period of DOM size p50/p95 logs, 0 - disabled
+	RetryTimeout              time.Duration      `env:"RETRY_TIMEOUT,default=2m"`
+	ReadTimeout               time.Duration      `env:"READ_TIMEOUT,default=0"`          // 0 - disabled, session file reads aren't interrupted
+	SlowReadThreshold         time.Duration      `env:"SLOW_READ_THRESHOLD,default=10s"` // longer reads are counted as slow, 0 - disabled
+	GroupStorage              string             `env:"GROUP_STORAGE,required"`
+	TopicTrigger              string             `env:"TOPIC_TRIGGER,required"`
+	GroupFailover             string             `env:"GROUP_STORAGE_FAILOVER"`
+	TopicFailover             string             `env:"TOPIC_STORAGE_FAILOVER"`
+	DeleteTimeout             time.Duration      `env:"DELETE_TIMEOUT,default=48h"`
+	ProducerCloseTimeout      int                `env:"PRODUCER_CLOSE_TIMEOUT,default=15000"`
+	ShutdownTimeout           time.Duration      `env:"SHUTDOWN_TIMEOUT,default=30s"`
+	UseFailover               bool               `env:"USE_FAILOVER,default=false"`
+	MaxFileSize               int64              `env:"MAX_FILE_SIZE,default=524288000"`
+	MaxInFlightBytes          int64              `env:"MAX_IN_FLIGHT_BYTES,default=0"`      // total size of raw session files in memory, 0 - not limited
+	DropOversized             bool               `env:"DROP_OVERSIZED,default=true"`        // DOM files bigger than MAX_FILE_SIZE are streamed if false, unsorted and not split
+	MinFileSize               int64              `env:"MIN_FILE_SIZE,default=1"`            // smaller files are not uploaded
+	SampleRate                float64            `env:"SAMPLE_RATE,default=1"`              // share of stored sessions, from 0 to 1
+	ProjectSampleRates        map[string]float64 `env:"PROJECT_SAMPLE_RATES"`               // projectID:rate pairs, requires PROJECT_LOOKUP
+	DetectPrecompressed       bool               `env:"DETECT_PRECOMPRESSED,default=false"` // gzipped session files are uploaded without compression and sorting
+	ProcessDevTools           bool               `env:"PROCESS_DEVTOOLS,default=true"`      // devtools files aren't read and uploaded if false
+	UseSort                   bool               `env:"USE_SESSION_SORT,default=true"`
+	MetricsDurationBuckets    string             `env:"METRICS_DURATION_BUCKETS"`               // name=ms,ms,...;name2=... e.g. upload_duration=10,50,100,500,1000
+	HighCardinalityMetrics    bool               `env:"HIGH_CARDINALITY_METRICS,default=false"` // project id and tracker version labels of size and duration metrics, requires PROJECT_LOOKUP
+	StructuredLogs            bool               `env:"STRUCTURED_LOGS,default=false"`          // one log line with upload details per session
+	UseProfiler               bool               `env:"PROFILER_ENABLED,default=false"`
+	CompressionAlgo           string             `env:"COMPRESSION_ALGO,default=zstd"`         // none, gzip, brotli, zstd
+	FileCompression           map[string]string  `env:"FILE_COMPRESSION"`                      // file type:algo pairs (dom, devtools, canvas), COMPRESSION_ALGO for not listed types
+	ZstdDictPath              string             `env:"ZSTD_DICTIONARY_PATH"`                  // dictionary trained with zstd --train, used if set
+	EncryptionMode            string             `env:"ENCRYPTION_MODE,default=cbc"`           // cbc or gcm (AES-256-GCM with HKDF derived key, enterprise edition only), Download uses the same mode
+	GzipLevel                 int                `env:"GZIP_COMPRESSION_LEVEL,default=-1"`     // from -2 (huffman only) to 9 (best compression)
+	GzipAdaptiveLevel         bool               `env:"GZIP_ADAPTIVE_LEVEL,default=false"`     // level depends on the file size instead of GZIP_COMPRESSION_LEVEL
+	GzipSmallFileSize         int64              `env:"GZIP_SMALL_FILE_SIZE,default=102400"`   // smaller files are compressed with best speed in adaptive mode
+	GzipLargeFileSize         int64              `env:"GZIP_LARGE_FILE_SIZE,default=10485760"` // bigger files are compressed with best compression in adaptive mode
+	GzipBlockSize             int                `env:"GZIP_BLOCK_SIZE,default=1048576"`       // pgzip compresses blocks of this size in parallel, more than 16384
+	GzipBlocks                int                `env:"GZIP_BLOCKS,default=0"`                 // blocks compressed at the same time for each file, GOMAXPROCS if 0; memory is about size * blocks
+	StreamThreshold           int64              `env:"STREAM_THRESHOLD,default=0"`            // 0 - disabled, files are always read into memory; streamed files aren't sorted, requires USE_SESSION_SORT=false
+	DeleteAfterUpload         bool               `env:"DELETE_AFTER_UPLOAD,default=true"`
+	DeadLetterDir             string             `env:"DEAD_LETTER_DIR"`              // failed sessions are dropped if not set
+	WriteManifest             bool               `env:"WRITE_MANIFEST,default=false"` // <sessionID>/manifest.json describes uploaded parts
+	BatchUploads              bool               `env:"BATCH_UPLOADS,default=false"`  // batched sessions are read through manifests, requires WRITE_MANIFEST
+	BatchMaxSize              int                `env:"BATCH_MAX_SIZE,default=10485760"`
+	BatchMaxWait              time.Duration      `env:"BATCH_MAX_WAIT,default=30s"`
+	FormatVersion             string             `env:"MOB_FORMAT_VERSION"`                       // written to object metadata and checked on download, current format if empty
+	LayoutMode                string             `env:"OBJECT_LAYOUT,default=split"`              // split - DOM parts in separate objects, indexed - one dom.mob object with part offsets in metadata; not used with BATCH_UPLOADS
+	KeyScheme                 string             `env:"OBJECT_KEY_SCHEME,default=v1"`             // v2 prefixes keys with v2/<projectID>/<session end timestamp>/, requires PROJECT_LOOKUP
+	ProjectLookup             bool               `env:"PROJECT_LOOKUP,default=false"`             // project ids and tracker versions of sessions are read from postgres
+	PostgresString            string             `env:"POSTGRES_STRING"`                          // required by PROJECT_LOOKUP
+	KeyCollisionCheck         bool               `env:"OBJECT_KEY_COLLISION_CHECK,default=false"` // warn if the session already exists under the v1 key
+	KeyTemplate               string             `env:"OBJECT_KEY_TEMPLATE"`                      // session objects location, {sessionID} by default, {date} and {projectID} (requires PROJECT_LOOKUP) are supported
+	DevToolsObjectKey         string             `env:"DEVTOOLS_OBJECT_KEY,default=devtools.mob"` // devtools object key relative to the session's location, can contain a subpath and {version}
+	DevToolsFileName          string             `env:"DEVTOOLS_FILE_NAME,default=devtools"`      // suffix of the devtools file name on disk, appended to the session id
+	DomContentType            string             `env:"DOM_CONTENT_TYPE,default=application/octet-stream"`
+	DevtoolsContentType       string             `env:"DEVTOOLS_CONTENT_TYPE,default=application/octet-stream"`
+	StorageClass              string             `env:"STORAGE_CLASS"`              // STANDARD, STANDARD_IA, INTELLIGENT_TIERING or GLACIER, bucket's default if empty
+	DevtoolsStorageClass      string             `env:"DEVTOOLS_STORAGE_CLASS"`     // same as STORAGE_CLASS if empty
+	ObjectACL                 string             `env:"OBJECT_ACL,default=private"` // public-read makes every replay readable by anyone knowing the key, use only for public CDNs without sensitive data; encrypted sessions stay encrypted
+	Tags                      map[string]string  `env:"OBJECT_TAGS"`                // key:value pairs, {sessionID} and {projectID} (requires PROJECT_LOOKUP) are supported in values
+	DryRun                    bool               `env:"DRY_RUN,default=false"`      // files are processed but not uploaded
+	VerifyUploads             bool               `env:"VERIFY_UPLOADS,default=false"`
+	IdempotentUploads         bool               `env:"IDEMPOTENT_UPLOADS,default=false"` // objects with the same size and checksum aren't uploaded again
+	Dedup                     bool               `env:"DEDUP,default=false"`              // not encrypted files are stored once under dedup/<sha256>, session keys get pointer objects
+	DedupIndexSize            int                `env:"DEDUP_INDEX_SIZE,default=100000"`  // checksums of known dedup/ objects kept in memory, others are checked with Exists
+	Workers                   int                `env:"STORAGE_WORKERS,default=1"`
+	UploadQueueCapacity       int                `env:"UPLOAD_QUEUE_CAPACITY,default=0"`       // compressed sessions waiting for upload, number of workers if 0; each one keeps its compressed files in memory
+	QueueCapacity             int                `env:"QUEUE_CAPACITY,default=0"`              // number of sessions waiting for processing, number of workers if 0
+	QueueFullPolicy           string             `env:"QUEUE_FULL_POLICY,default=block"`       // block, reject or drop-oldest
+	MaxConcurrentUploads      int                `env:"MAX_CONCURRENT_UPLOADS,default=0"`      // object uploads in progress across all workers, 3 per worker if 0
+	MaxCompressionConcurrency int                `env:"MAX_COMPRESSION_CONCURRENCY,default=0"` // files and DOM parts compressed at the same time across all workers, GOMAXPROCS if 0; streamed files aren't limited
+	UploadsPerSecond          float64            `env:"UPLOADS_PER_SECOND,default=0"`          // sessions accepted by Process per second, 0 - not limited
+	UploadsBurst              int                `env:"UPLOADS_BURST,default=1"`
+	RateLimitPolicy           string             `env:"RATE_LIMIT_POLICY,default=block"`      // block waits for the rate limiter, reject returns an error
+	UploadedQueueCapacity     int                `env:"UPLOADED_CALLBACK_QUEUE,default=1000"` // uploaded sessions waiting for the callback, new ones are dropped if it's full
+	UploadMaxRetries          int                `env:"UPLOAD_MAX_RETRIES,default=3"`
+	UploadTimeout             time.Duration      `env:"UPLOAD_TIMEOUT,default=10m"` // deadline of each upload attempt, 0 - disabled
+	UploadRetryBaseDelay      time.Duration      `env:"UPLOAD_RETRY_BASE_DELAY,default=500ms"`
+	UploadRetryMaxDelay       time.Duration      `env:"UPLOAD_RETRY_MAX_DELAY,default=10s"`
+	BreakerErrorRate          float64            `env:"BREAKER_ERROR_RATE,default=0"`    // share of failed uploads which opens the circuit breaker, 0 - disabled
+	BreakerMinRequests        int                `env:"BREAKER_MIN_REQUESTS,default=20"` // uploads in the window before the error rate is checked
+	BreakerWindow             time.Duration      `env:"BREAKER_WINDOW,default=1m"`
+	BreakerOpenTimeout        time.Duration      `env:"BREAKER_OPEN_TIMEOUT,default=30s"`     // time before the probe upload
+	HealthWindow              time.Duration      `env:"HEALTH_WINDOW,default=5m"`             // period of upload error rate and worker panics checks
+	HealthMaxErrorRate        float64            `env:"HEALTH_MAX_ERROR_RATE,default=0.5"`    // 0 - error rate isn't checked
+	HealthMinUploads          int                `env:"HEALTH_MIN_UPLOADS,default=10"`        // uploads in the window before the error rate is checked
+	HealthMaxUploadAge        time.Duration      `env:"HEALTH_MAX_UPLOAD_AGE,default=10m"`    // max time without uploads if sessions are pending, 0 - not checked
+	HealthMaxDeadLetters      int                `env:"HEALTH_MAX_DEAD_LETTERS,default=1000"` // 0 - dead letter dir isn't checked
 }
 
 func New(log logger.Logger) *Config {
@@ -33,3 +120,64 @@ func New(log logger.Logger) *Config {
 	configurator.Process(log, cfg)
 	return cfg
 }
+
+// Validate checks the values which otherwise fail only while processing sessions
+func (c *Config) Validate() error {
+	if c.FileSplitSize <= 0 {
+		return fmt.Errorf("FILE_SPLIT_SIZE must be positive: %d", c.FileSplitSize)
+	}
+	if c.MaxFileSize <= 0 {
+		return fmt.Errorf("MAX_FILE_SIZE must be positive: %d", c.MaxFileSize)
+	}
+	if int64(c.FileSplitSize) >= c.MaxFileSize {
+		return fmt.Errorf("FILE_SPLIT_SIZE (%d) must be less than MAX_FILE_SIZE (%d)", c.FileSplitSize, c.MaxFileSize)
+	}
+	// Project id isn't a part of SessionEnd, it's known only with the project lookup
+	if c.KeyScheme == "v2" && !c.ProjectLookup {
+		return fmt.Errorf("OBJECT_KEY_SCHEME=v2 requires PROJECT_LOOKUP")
+	}
+	if strings.Contains(c.KeyTemplate, "{projectID}") && !c.ProjectLookup {
+		return fmt.Errorf("{projectID} in OBJECT_KEY_TEMPLATE requires PROJECT_LOOKUP")
+	}
+	if len(c.ProjectSampleRates) > 0 && !c.ProjectLookup {
+		return fmt.Errorf("PROJECT_SAMPLE_RATES requires PROJECT_LOOKUP")
+	}
+	if c.HighCardinalityMetrics && !c.ProjectLookup {
+		return fmt.Errorf("HIGH_CARDINALITY_METRICS requires PROJECT_LOOKUP")
+	}
+	// Streamed files aren't read into memory, so they can't be sorted and split
+	if c.StreamThreshold > 0 && c.UseSort {
+		return fmt.Errorf("STREAM_THRESHOLD requires USE_SESSION_SORT=false")
+	}
+	if c.BatchUploads && !c.WriteManifest {
+		return fmt.Errorf("BATCH_UPLOADS requires WRITE_MANIFEST")
+	}
+	if len(c.Tags) > 0 && c.CloudName == "gcp" {
+		return fmt.Errorf("OBJECT_TAGS aren't supported by gcs")
+	}
+	for k, v := range c.Tags {
+		if strings.Contains(v, "{projectID}") && !c.ProjectLookup {
+			return fmt.Errorf("{projectID} in object tag %s requires PROJECT_LOOKUP", k)
+		}
+	}
+	// FS_DIR is the key prefix if session files are read from the object storage
+	if c.Source != "" && c.Source != "local" {
+		return nil
+	}
+	dir, err := os.Open(c.FSDir)
+	if err != nil {
+		return fmt.Errorf("FS_DIR isn't readable: %s", err)
+	}
+	defer dir.Close()
+	info, err := dir.Stat()
+	if err != nil {
+		return fmt.Errorf("FS_DIR isn't readable: %s", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("FS_DIR isn't a directory: %s", c.FSDir)
+	}
+	if _, err := dir.Readdirnames(1); err != nil && err != io.EOF {
+		return fmt.Errorf("FS_DIR isn't readable: %s", err)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+package storage
+
+import "context"
+
+// metricAttributes returns project id and tracker version labels of size and duration metrics. Both are taken from
+// the session's context (see WithProject) because SessionEnd doesn't contain them. Labels are empty unless
+// HIGH_CARDINALITY_METRICS is enabled to keep the number of time series low.
+func (s *Storage) metricAttributes(ctx context.Context) (string, string) {
+	if !s.cfg.HighCardinalityMetrics {
+		return "", ""
+	}
+	return projectIDOf(ctx), trackerOf(ctx)
+}
@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	metrics "openreplay/backend/pkg/metrics/storage"
+	"openreplay/backend/pkg/objectstorage"
+)
+
+// batchEntry describes the position of the session file content inside the batch tar object and how it's encoded
+type batchEntry struct {
+	Offset      int64  `json:"offset"`
+	Size        int64  `json:"size"`
+	Checksum    string `json:"checksum"`
+	Compression string `json:"compression"`
+	Encryption  string `json:"encryption,omitempty"`
+}
+
+// batchFile is the session file written to the batch
+type batchFile struct {
+	key string
+	tp  FileType
+	buf *bytes.Buffer
+}
+
+// batcher packs files of many small sessions into a single tar object. Each batch is uploaded as
+// batches/<host>/<ts>-<random>.tar together with batches/<host>/<ts>-<random>.index.json which maps the original
+// object key (for example 123/dom.mobs) to the offset and size of the file content inside the tar object.
+// Batched sessions are read through their manifests (BATCH_UPLOADS requires WRITE_MANIFEST), parts of the manifest
+// point to the batch tar object.
+type batcher struct {
+	s       *Storage
+	host    string
+	mu      sync.Mutex
+	buf     *bytes.Buffer
+	tw      *tar.Writer
+	index   map[string]batchEntry
+	tasks   []*Task
+	entries [][]batchEntry // entries of each task in the order of the session's manifest parts
+	started time.Time
+	done    chan struct{}
+}
+
+func newBatcher(s *Storage) *batcher {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "storage"
+	}
+	b := &batcher{
+		s:    s,
+		host: host,
+		done: make(chan struct{}),
+	}
+	b.reset()
+	if s.cfg.BatchMaxWait > 0 {
+		go b.run()
+	}
+	return b
+}
+
+func (b *batcher) reset() {
+	b.buf = new(bytes.Buffer)
+	b.tw = tar.NewWriter(b.buf)
+	b.index = make(map[string]batchEntry)
+	b.tasks, b.entries = nil, nil
+	b.started = time.Now()
+}
+
+func (b *batcher) run() {
+	tick := time.NewTicker(b.s.cfg.BatchMaxWait)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			b.mu.Lock()
+			expired := time.Since(b.started) >= b.s.cfg.BatchMaxWait
+			b.mu.Unlock()
+			if expired {
+				b.flush()
+			}
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *batcher) add(task *Task) {
+	b.mu.Lock()
+	if len(b.tasks) == 0 {
+		b.started = time.Now()
+	}
+	files := make([]batchFile, 0, len(task.doms)+2)
+	for i, dom := range task.doms {
+		files = append(files, batchFile{b.s.objectKey(task.base, DOM) + domPartSuffix(i), DOM, dom})
+	}
+	if task.dev != nil {
+		files = append(files, batchFile{b.s.objectKey(task.base, DEV), DEV, task.dev})
+	}
+	if task.canvas != nil {
+		files = append(files, batchFile{b.s.objectKey(task.base, CANVAS), CANVAS, task.canvas})
+	}
+	entries := make([]batchEntry, 0, len(files))
+	for _, file := range files {
+		entry, err := b.write(file.key, file.buf.Bytes())
+		if err != nil {
+			// The tar stream is broken after the failed write, sessions of the batch can't be uploaded
+			tasks := append(b.tasks, task)
+			b.reset()
+			b.mu.Unlock()
+			b.fail(tasks, err)
+			return
+		}
+		entry.Compression = task.compressionOf(file.tp).String()
+		entry.Encryption = b.s.encryptionOf(task)
+		b.index[file.key] = entry
+		entries = append(entries, entry)
+	}
+	b.tasks = append(b.tasks, task)
+	b.entries = append(b.entries, entries)
+	// Flush waits for sessions submitted before it, they aren't kept in the batch until BATCH_MAX_WAIT
+	full := b.buf.Len() >= b.s.cfg.BatchMaxSize || b.s.flushing(task)
+	b.mu.Unlock()
+
+	if full {
+		b.flush()
+	}
+}
+
+func (b *batcher) write(key string, data []byte) (batchEntry, error) {
+	if err := b.tw.WriteHeader(&tar.Header{
+		Name:    key,
+		Mode:    0644,
+		Size:    int64(len(data)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return batchEntry{}, fmt.Errorf("can't write tar header: %s", err)
+	}
+	// Tar writer flushes the header to the buffer before the content
+	offset := int64(b.buf.Len())
+	if _, err := b.tw.Write(data); err != nil {
+		return batchEntry{}, fmt.Errorf("can't write tar content: %s", err)
+	}
+	return batchEntry{Offset: offset, Size: int64(len(data)), Checksum: checksum(data)}, nil
+}
+
+func (b *batcher) flush() {
+	b.mu.Lock()
+	if len(b.tasks) == 0 {
+		b.mu.Unlock()
+		return
+	}
+	tw, buf, index, tasks, entries, started := b.tw, b.buf, b.index, b.tasks, b.entries, b.started
+	b.reset()
+	b.mu.Unlock()
+
+	key, err := b.upload(tw, buf, index, started)
+	if err != nil {
+		b.fail(tasks, err)
+		return
+	}
+	for i, task := range tasks {
+		if err := b.uploadManifest(task, key, entries[i]); err != nil {
+			b.s.onUploadFailed(task, err)
+		} else {
+			b.s.onUploaded(task)
+		}
+		b.s.releaseBuffers(task)
+		b.s.taskDone(task)
+	}
+}
+
+// fail reports sessions of the batch as failed, batched sessions are done only once the batch is uploaded or failed
+func (b *batcher) fail(tasks []*Task, err error) {
+	for _, task := range tasks {
+		b.s.onUploadFailed(task, err)
+		b.s.releaseBuffers(task)
+		b.s.taskDone(task)
+	}
+}
+
+// batchKey returns the unique key of the batch, several batches can be started in the same millisecond
+func (b *batcher) batchKey(started time.Time) string {
+	return fmt.Sprintf("batches/%s/%d-%08x.tar", b.host, started.UnixMilli(), rand.Uint32())
+}
+
+// upload uploads the batch tar object and its index, returns the key of the tar object
+func (b *batcher) upload(tw *tar.Writer, buf *bytes.Buffer, index map[string]batchEntry, started time.Time) (string, error) {
+	if err := tw.Close(); err != nil {
+		return "", fmt.Errorf("can't close batch: %s", err)
+	}
+	rawIndex, err := json.Marshal(index)
+	if err != nil {
+		return "", fmt.Errorf("can't marshal batch index: %s", err)
+	}
+	key := b.batchKey(started)
+	batchTask := &Task{ctx: context.Background(), compression: objectstorage.NoCompression}
+	metadata := map[string]string{
+		checksumMetadataKey:      checksum(buf.Bytes()),
+		compressionMetadataKey:   objectstorage.NoCompression.String(),
+		encryptionMetadataKey:    encryptionNone, // entries are encrypted separately, see the index
+		formatVersionMetadataKey: b.s.formatVersion,
+	}
+	if err := b.s.withRetry(batchTask, key, DOM, func(ctx context.Context) error {
+		opts := &objectstorage.UploadOptions{Metadata: metadata, StorageClass: b.s.storageClass[DOM], ACL: b.s.acl,
+			Tags: b.s.objectTags(batchTask), Context: ctx}
+		return b.s.objStorage.UploadWithOptions(bytes.NewReader(buf.Bytes()), key, "application/x-tar", objectstorage.NoCompression, opts)
+	}); err != nil {
+		return "", fmt.Errorf("batch upload failed: %s", err)
+	}
+	if !b.s.cfg.DryRun {
+		metrics.IncreaseStorageStoredBytes(float64(buf.Len()), "batch")
+	}
+	indexKey := strings.TrimSuffix(key, ".tar") + ".index.json"
+	if err := b.s.withRetry(batchTask, indexKey, DOM, func(ctx context.Context) error {
+		return b.s.objStorage.UploadWithOptions(bytes.NewReader(rawIndex), indexKey, "application/json",
+			objectstorage.NoCompression, &objectstorage.UploadOptions{Context: ctx})
+	}); err != nil {
+		return "", fmt.Errorf("batch index upload failed: %s", err)
+	}
+	return key, nil
+}
+
+// uploadManifest uploads the manifest of the batched session, its parts are read from the batch tar object
+func (b *batcher) uploadManifest(task *Task, key string, entries []batchEntry) error {
+	manifest := b.s.newManifest(task)
+	if len(manifest.Parts) != len(entries) {
+		return fmt.Errorf("batch has %d files of the session, manifest: %d", len(entries), len(manifest.Parts))
+	}
+	for i := range manifest.Parts {
+		part := &manifest.Parts[i]
+		part.Key, part.Offset, part.Size, part.Store = key, entries[i].Offset, entries[i].Size, ""
+		part.Indexed, part.Batch = true, true
+	}
+	return b.s.putManifest(task, manifest)
+}
+
+func (b *batcher) stop() {
+	close(b.done)
+	b.flush()
+}
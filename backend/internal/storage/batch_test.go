@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/messages"
+)
+
+func TestBatchUploads(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{BatchUploads: true, BatchMaxSize: 1 << 20, WriteManifest: true})
+	for _, id := range []string{"1", "2"} {
+		s.pending.Add(1)
+		s.uploadSession(&Task{
+			ctx:         context.Background(),
+			id:          id,
+			base:        id,
+			doms:        []*bytes.Buffer{bytes.NewBufferString("dom" + id)},
+			domRawSizes: []float64{4},
+		})
+	}
+	if len(objStorage.Keys()) != 0 {
+		t.Fatal("batch shouldn't be uploaded before flush")
+	}
+	if s.pending.Load() != 2 {
+		t.Errorf("batched sessions shouldn't be done before the batch upload, pending: %d", s.pending.Load())
+	}
+	s.Wait()
+	if s.pending.Load() != 0 {
+		t.Errorf("batched sessions should be done after the batch upload, pending: %d", s.pending.Load())
+	}
+	keys := objStorage.Keys()
+	if len(keys) != 4 {
+		t.Fatalf("expected batch, index and manifest objects, got: %v", keys)
+	}
+	var tarKey string
+	var tarData, indexData []byte
+	for _, key := range keys {
+		obj, _ := objStorage.Object(key)
+		switch {
+		case strings.HasSuffix(key, ".tar"):
+			tarKey, tarData = key, obj.Data
+			if obj.Metadata[checksumMetadataKey] != checksum(tarData) || obj.Metadata[compressionMetadataKey] != "none" {
+				t.Errorf("wrong batch metadata: %v", obj.Metadata)
+			}
+		case strings.HasSuffix(key, ".index.json"):
+			indexData = obj.Data
+		}
+	}
+	if !regexp.MustCompile(`^batches/[^/]+/\d+-[0-9a-f]{8}\.tar$`).MatchString(tarKey) {
+		t.Errorf("batch key should have a unique suffix: %s", tarKey)
+	}
+	index := make(map[string]batchEntry)
+	if err := json.Unmarshal(indexData, &index); err != nil {
+		t.Fatalf("can't parse batch index: %s", err)
+	}
+	entry, ok := index["2"+string(DOM)+"s"]
+	if !ok {
+		t.Fatal("session 2 is missing in batch index")
+	}
+	if got := string(tarData[entry.Offset : entry.Offset+entry.Size]); got != "dom2" {
+		t.Errorf("wrong batch content: %s", got)
+	}
+	if entry.Checksum != checksum([]byte("dom2")) || entry.Compression != "none" {
+		t.Errorf("wrong batch entry: %+v", entry)
+	}
+
+	// Batched sessions are read through their manifests
+	for _, id := range []uint64{1, 2} {
+		reader, err := s.Download(id, 0, "")
+		if err != nil {
+			t.Fatalf("can't download batched session %d: %s", id, err)
+		}
+		data, _ := io.ReadAll(reader)
+		reader.Close()
+		if string(data) != "dom"+strconv.FormatUint(id, 10) {
+			t.Errorf("wrong session %d: %q", id, data)
+		}
+	}
+	if _, err := s.PresignedURLs("", 1, 0, DOM, time.Minute); !errors.Is(err, errBatched) {
+		t.Errorf("batched session shouldn't be presigned, got: %v", err)
+	}
+	if err := s.Delete(context.Background(), "", 1, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := objStorage.Object(tarKey); !ok {
+		t.Error("batch object shared with session 2 was deleted")
+	}
+	if _, ok := objStorage.Object("1" + manifestName); ok {
+		t.Error("manifest of the deleted session wasn't deleted")
+	}
+}
+
+func TestBatchWriteError(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{BatchUploads: true, BatchMaxSize: 1 << 20, WriteManifest: true})
+	batchTask := func(id string) *Task {
+		s.pending.Add(1)
+		return &Task{
+			ctx:         context.Background(),
+			id:          id,
+			base:        id,
+			doms:        []*bytes.Buffer{bytes.NewBufferString("dom" + id)},
+			domRawSizes: []float64{4},
+		}
+	}
+	s.uploadSession(batchTask("1"))
+	// Broken tar stream fails all sessions of the batch
+	s.batcher.tw.Close()
+	s.uploadSession(batchTask("2"))
+	if s.pending.Load() != 0 {
+		t.Errorf("sessions of the broken batch should be done, pending: %d", s.pending.Load())
+	}
+	if len(s.batcher.tasks) != 0 || len(s.batcher.index) != 0 || s.batcher.buf.Len() != 0 {
+		t.Fatal("batch wasn't reset after the write error")
+	}
+	// The next batch isn't affected
+	s.uploadSession(batchTask("3"))
+	s.Wait()
+	if len(objStorage.Keys()) != 3 {
+		t.Fatalf("expected batch, index and manifest objects, got: %v", objStorage.Keys())
+	}
+	reader, err := s.Download(3, 0, "")
+	if err != nil {
+		t.Fatalf("can't download session of the next batch: %s", err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "dom3" {
+		t.Errorf("wrong session: %q", data)
+	}
+}
+
+func TestFlushBatch(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{BatchUploads: true, BatchMaxSize: 1 << 20, BatchMaxWait: time.Hour,
+		WriteManifest: true})
+	if err := os.WriteFile(s.cfg.FSDir+"/51", []byte("dom"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(51)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	// Sessions submitted before Flush are uploaded without waiting for BATCH_MAX_WAIT
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if !objStorage.Exists("51" + manifestName) {
+		t.Error("batched session wasn't uploaded by flush")
+	}
+}
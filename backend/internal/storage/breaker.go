@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	metrics "openreplay/backend/pkg/metrics/storage"
+)
+
+var errCircuitOpen = errors.New("object storage circuit breaker is open")
+
+// States of the circuit breaker, values are exposed by the breaker state metric
+const (
+	breakerClosed   = 0
+	breakerHalfOpen = 1
+	breakerOpen     = 2
+)
+
+// breaker stops uploads for BreakerOpenTimeout once the error rate of the current BreakerWindow reaches
+// BreakerErrorRate. After the timeout one probe upload is allowed, the breaker is closed if it succeeds. Results of
+// uploads started before the breaker was opened don't change its state.
+type breaker struct {
+	mu          sync.Mutex
+	errorRate   float64
+	minRequests int
+	window      time.Duration
+	openTimeout time.Duration
+	state       int
+	requests    int
+	failures    int
+	windowStart time.Time
+	openedAt    time.Time
+	probing     bool
+	now         func() time.Time
+}
+
+func newBreaker(errorRate float64, minRequests int, window, openTimeout time.Duration) *breaker {
+	b := &breaker{
+		errorRate:   errorRate,
+		minRequests: minRequests,
+		window:      window,
+		openTimeout: openTimeout,
+		now:         time.Now,
+	}
+	b.windowStart = b.now()
+	metrics.RecordBreakerState(breakerClosed)
+	return b
+}
+
+// allow checks that the upload can be started, in the half-open state only one probe upload is allowed. The probe
+// flag must be passed to record with the result of the upload.
+func (b *breaker) allow() (allowed, probe bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.openTimeout {
+			return false, false
+		}
+		b.setState(breakerHalfOpen)
+		fallthrough
+	case breakerHalfOpen:
+		if b.probing {
+			return false, false
+		}
+		b.probing = true
+		return true, true
+	}
+	return true, false
+}
+
+// record saves the result of the allowed upload, only the probe decides the state of the half-open breaker
+func (b *breaker) record(probe, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if probe {
+		b.probing = false
+		if b.state != breakerHalfOpen {
+			return
+		}
+		if success {
+			b.setState(breakerClosed)
+		} else {
+			b.open()
+		}
+		return
+	}
+	// Uploads started before the breaker was opened
+	if b.state != breakerClosed {
+		return
+	}
+	if now := b.now(); now.Sub(b.windowStart) >= b.window {
+		b.windowStart, b.requests, b.failures = now, 0, 0
+	}
+	b.requests++
+	if !success {
+		b.failures++
+	}
+	if b.requests >= b.minRequests && float64(b.failures)/float64(b.requests) >= b.errorRate {
+		b.open()
+	}
+}
+
+func (b *breaker) open() {
+	b.openedAt = b.now()
+	b.setState(breakerOpen)
+}
+
+func (b *breaker) setState(state int) {
+	b.state = state
+	if state == breakerClosed {
+		b.windowStart, b.requests, b.failures = b.now(), 0, 0
+	}
+	metrics.RecordBreakerState(float64(state))
+}
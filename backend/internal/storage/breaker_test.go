@@ -0,0 +1,87 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	config "openreplay/backend/internal/config/storage"
+)
+
+func TestBreaker(t *testing.T) {
+	now := time.Now()
+	b := newBreaker(0.5, 4, time.Minute, 30*time.Second)
+	b.now = func() time.Time { return now }
+	for _, success := range []bool{true, false, true, false} {
+		if allowed, _ := b.allow(); !allowed {
+			t.Fatal("closed breaker should allow uploads")
+		}
+		b.record(false, success)
+	}
+	if allowed, _ := b.allow(); allowed {
+		t.Fatal("breaker should be open after 50% of failed uploads")
+	}
+	now = now.Add(30 * time.Second)
+	if allowed, probe := b.allow(); !allowed || !probe {
+		t.Fatal("half-open breaker should allow the probe upload")
+	}
+	if allowed, _ := b.allow(); allowed {
+		t.Fatal("only one probe upload is allowed")
+	}
+	b.record(true, false)
+	if allowed, _ := b.allow(); allowed {
+		t.Fatal("breaker should be open again after the failed probe")
+	}
+	now = now.Add(30 * time.Second)
+	if allowed, probe := b.allow(); !allowed || !probe {
+		t.Fatal("half-open breaker should allow the probe upload")
+	}
+	b.record(true, true)
+	for i := 0; i < 2; i++ {
+		if allowed, probe := b.allow(); !allowed || probe {
+			t.Fatal("breaker should be closed after the successful probe")
+		}
+	}
+}
+
+func TestBreakerStaleResults(t *testing.T) {
+	now := time.Now()
+	b := newBreaker(1, 1, time.Minute, 30*time.Second)
+	b.now = func() time.Time { return now }
+	// Both uploads are started before the breaker is opened
+	b.allow()
+	b.allow()
+	b.record(false, false)
+	now = now.Add(30 * time.Second)
+	if allowed, probe := b.allow(); !allowed || !probe {
+		t.Fatal("half-open breaker should allow the probe upload")
+	}
+	// Results of stale uploads don't change the half-open state
+	b.record(false, true)
+	b.record(false, false)
+	if b.state != breakerHalfOpen {
+		t.Fatalf("stale result changed the breaker state: %d", b.state)
+	}
+	if allowed, _ := b.allow(); allowed {
+		t.Fatal("probe is still in progress")
+	}
+	b.record(true, true)
+	if b.state != breakerClosed {
+		t.Fatalf("breaker should be closed by the probe: %d", b.state)
+	}
+}
+
+func TestBreakerRejectsUploads(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{BreakerErrorRate: 1, BreakerMinRequests: 1, BreakerWindow: time.Minute, BreakerOpenTimeout: time.Minute})
+	objStorage.SetError(errors.New("storage is unavailable"))
+	task := &Task{ctx: context.Background()}
+	if err := s.uploadWithRetry(task, bytes.NewBufferString("data"), "26"+string(DEV), DEV, nil); errors.Is(err, errCircuitOpen) {
+		t.Fatalf("first upload should reach the object storage: %s", err)
+	}
+	objStorage.SetError(nil)
+	if err := s.uploadWithRetry(task, bytes.NewBufferString("data"), "26"+string(DEV), DEV, nil); !errors.Is(err, errCircuitOpen) {
+		t.Fatalf("upload should be rejected by the open breaker, got: %v", err)
+	}
+}
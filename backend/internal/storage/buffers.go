@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"bytes"
+	"sync"
+
+	"openreplay/backend/pkg/objectstorage"
+)
+
+// bufferPool keeps compression output buffers to reuse them for the next sessions
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+func getBuffer() *bytes.Buffer {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	return buf
+}
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf != nil {
+		bufferPool.Put(buf)
+	}
+}
+
+// releaseBuffers returns compressed session parts to the pool once they are uploaded (or saved to disk).
+// Not compressed parts share memory with the mob file and encrypted parts are new slices, so they are not reused.
+func (s *Storage) releaseBuffers(task *Task) {
+	if task.encrypted() {
+		return
+	}
+	if isPooled(task, DOM) {
+		for _, dom := range task.doms {
+			putBuffer(dom)
+		}
+	}
+	if isPooled(task, DEV) {
+		putBuffer(task.dev)
+	}
+	if isPooled(task, CANVAS) {
+		putBuffer(task.canvas)
+	}
+	task.doms, task.dev, task.canvas = nil, nil, nil
+}
+
+// isPooled checks that the file was compressed into the buffer from the pool
+func isPooled(task *Task, tp FileType) bool {
+	return !task.isPrecompressed(tp) && task.compressionOf(tp) != objectstorage.NoCompression
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	metrics "openreplay/backend/pkg/metrics/storage"
+)
+
+const checksumMetadataKey = "checksum_sha256"
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// verifyUpload compares the size and checksum of the stored object with the uploaded data
+func (s *Storage) verifyUpload(key string, size int64, sum string) error {
+	info, err := s.objStorage.Head(key)
+	if err != nil {
+		return fmt.Errorf("can't get uploaded object info: %s", err)
+	}
+	if info.Size != size {
+		metrics.IncreaseStorageChecksumMismatch()
+		return fmt.Errorf("uploaded object size mismatch, expected: %d, got: %d", size, info.Size)
+	}
+	if stored, ok := info.Metadata[checksumMetadataKey]; ok && stored != sum {
+		metrics.IncreaseStorageChecksumMismatch()
+		return fmt.Errorf("uploaded object checksum mismatch, expected: %s, got: %s", sum, stored)
+	}
+	return nil
+}
+
+// isUploaded checks that the object with the same size and checksum is already stored
+func (s *Storage) isUploaded(key string, size int64, sum string) bool {
+	info, err := s.objStorage.Head(key)
+	if err != nil {
+		return false
+	}
+	return info.Size == size && info.Metadata[checksumMetadataKey] == sum
+}
@@ -0,0 +1,201 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	metrics "openreplay/backend/pkg/metrics/storage"
+	"openreplay/backend/pkg/objectstorage"
+)
+
+const deadLetterManifest = "manifest.json"
+
+type deadLetter struct {
+	SessionID     string                                     `json:"session_id"`
+	KeyBase       string                                     `json:"key_base"`
+	SessionEnd    uint64                                     `json:"session_end,omitempty"`
+	Error         string                                     `json:"error"`
+	Timestamp     time.Time                                  `json:"timestamp"`
+	Compression   objectstorage.CompressionType              `json:"compression"`
+	Compressions  map[FileType]objectstorage.CompressionType `json:"compressions,omitempty"`
+	DomParts      int                                        `json:"dom_parts"`
+	DomRawSizes   []float64                                  `json:"dom_raw_sizes"`
+	Path          string                                     `json:"path,omitempty"` // session path of dead letters saved by older versions
+	Paths         map[FileType]string                        `json:"paths,omitempty"`
+	DomPath       string                                     `json:"dom_path,omitempty"`
+	HasDev        bool                                       `json:"has_dev"`
+	DevRawSize    float64                                    `json:"dev_raw_size"`
+	HasCanvas     bool                                       `json:"has_canvas"`
+	CanvasRawSize float64                                    `json:"canvas_raw_size"`
+	Metadata      map[string]string                          `json:"metadata,omitempty"`
+	ProjectID     string                                     `json:"project_id,omitempty"`
+	Tracker       string                                     `json:"tracker,omitempty"`
+	Precompressed []FileType                                 `json:"precompressed,omitempty"`
+}
+
+// deadLetter saves already compressed and encrypted session parts to disk to be able to upload them later
+func (s *Storage) deadLetter(task *Task, uploadErr error) error {
+	dir := filepath.Join(s.cfg.DeadLetterDir, task.id)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	for i, dom := range task.doms {
+		if err := os.WriteFile(filepath.Join(dir, "dom.mob"+domPartSuffix(i)), dom.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	if task.dev != nil {
+		if err := os.WriteFile(filepath.Join(dir, "devtools.mob"), task.dev.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	if task.canvas != nil {
+		if err := os.WriteFile(filepath.Join(dir, "canvas.mob"), task.canvas.Bytes(), 0644); err != nil {
+			return err
+		}
+	}
+	var precompressed []FileType
+	for _, tp := range fileTypes {
+		if task.isPrecompressed(tp) {
+			precompressed = append(precompressed, tp)
+		}
+	}
+	manifest, err := json.Marshal(&deadLetter{
+		SessionID:     task.id,
+		KeyBase:       task.base,
+		SessionEnd:    task.timestamp,
+		Error:         uploadErr.Error(),
+		Timestamp:     time.Now(),
+		Compression:   task.compression,
+		Compressions:  task.compressions,
+		DomParts:      len(task.doms),
+		DomRawSizes:   task.domRawSizes,
+		Paths:         task.paths,
+		DomPath:       task.domPath,
+		HasDev:        task.dev != nil,
+		DevRawSize:    task.devRawSize,
+		HasCanvas:     task.canvas != nil,
+		CanvasRawSize: task.canvasRawSize,
+		Metadata:      task.metadata,
+		ProjectID:     projectIDOf(task.ctx),
+		Tracker:       trackerOf(task.ctx),
+		Precompressed: precompressed,
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, deadLetterManifest), manifest, 0644); err != nil {
+		return err
+	}
+	metrics.IncreaseStorageDeadLetteredSessions()
+	return nil
+}
+
+// RetryDeadLetters submits all dead-lettered sessions to the uploader again, returns the number of resubmitted sessions
+func (s *Storage) RetryDeadLetters() (int, error) {
+	if s.cfg.DeadLetterDir == "" {
+		return 0, fmt.Errorf("dead letter dir is not set")
+	}
+	entries, err := os.ReadDir(s.cfg.DeadLetterDir)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(s.cfg.DeadLetterDir, entry.Name())
+		// The session resubmitted by the previous call is still in progress
+		if _, retrying := s.retrying.LoadOrStore(dir, true); retrying {
+			continue
+		}
+		task, err := s.loadDeadLetter(dir)
+		if err != nil {
+			s.retrying.Delete(dir)
+			s.log.Error(context.Background(), "can't load dead letter %s: %s", dir, err)
+			continue
+		}
+		// The entry is removed after the upload, a failed upload saves the session to it again
+		task.deadLetterDir = dir
+		s.mu.RLock()
+		if s.closed {
+			s.mu.RUnlock()
+			s.retrying.Delete(dir)
+			return count, ErrStorageClosed
+		}
+		s.taskSubmitted(task)
+		s.uploaderPool.Submit(task)
+		s.mu.RUnlock()
+		count++
+	}
+	return count, nil
+}
+
+func (s *Storage) loadDeadLetter(dir string) (*Task, error) {
+	raw, err := os.ReadFile(filepath.Join(dir, deadLetterManifest))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &deadLetter{}
+	if err := json.Unmarshal(raw, manifest); err != nil {
+		return nil, err
+	}
+	task := &Task{
+		ctx:           WithProject(context.WithValue(context.Background(), "sessionID", manifest.SessionID), manifest.ProjectID, manifest.Tracker),
+		id:            manifest.SessionID,
+		base:          manifest.KeyBase,
+		timestamp:     manifest.SessionEnd,
+		compression:   manifest.Compression,
+		compressions:  manifest.Compressions,
+		domRawSizes:   manifest.DomRawSizes,
+		paths:         manifest.Paths,
+		domPath:       manifest.DomPath,
+		devRawSize:    manifest.DevRawSize,
+		canvasRawSize: manifest.CanvasRawSize,
+		startedAt:     time.Now(),
+		metadata:      manifest.Metadata,
+	}
+	if task.paths == nil && manifest.Path != "" {
+		task.paths = make(map[FileType]string, len(fileTypes))
+		for _, tp := range fileTypes {
+			task.paths[tp] = s.localPath(manifest.Path, tp)
+		}
+	}
+	for _, tp := range manifest.Precompressed {
+		task.setPrecompressed(tp)
+	}
+	if task.base == "" {
+		task.base = task.id
+	}
+	if len(task.domRawSizes) != manifest.DomParts {
+		return nil, fmt.Errorf("wrong number of dom raw sizes: %d, parts: %d", len(task.domRawSizes), manifest.DomParts)
+	}
+	for i := 0; i < manifest.DomParts; i++ {
+		dom, err := os.ReadFile(filepath.Join(dir, "dom.mob"+domPartSuffix(i)))
+		if err != nil {
+			return nil, err
+		}
+		task.doms = append(task.doms, bytes.NewBuffer(dom))
+	}
+	if manifest.HasDev {
+		dev, err := os.ReadFile(filepath.Join(dir, "devtools.mob"))
+		if err != nil {
+			return nil, err
+		}
+		task.dev = bytes.NewBuffer(dev)
+	}
+	if manifest.HasCanvas {
+		canvas, err := os.ReadFile(filepath.Join(dir, "canvas.mob"))
+		if err != nil {
+			return nil, err
+		}
+		task.canvas = bytes.NewBuffer(canvas)
+	}
+	return task, nil
+}
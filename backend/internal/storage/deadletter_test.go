@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+)
+
+func TestDeadLetterRetry(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{DeadLetterDir: t.TempDir()})
+	objStorage.SetError(errors.New("upload failed"))
+	task := &Task{
+		ctx:         context.Background(),
+		id:          "5",
+		base:        "5",
+		doms:        []*bytes.Buffer{bytes.NewBufferString("start"), bytes.NewBufferString("end")},
+		domRawSizes: []float64{5, 3},
+		dev:         bytes.NewBufferString("dev"),
+		devRawSize:  3,
+	}
+	s.pending.Add(1)
+	s.uploadSession(task)
+	if objStorage.Exists("5" + string(DOM) + "s") {
+		t.Fatal("session shouldn't be uploaded")
+	}
+
+	// Failed retry keeps the dead letter
+	for _, uploadErr := range []error{errors.New("upload failed"), nil} {
+		objStorage.SetError(uploadErr)
+		count, err := s.RetryDeadLetters()
+		if err != nil || count != 1 {
+			t.Fatalf("expected 1 resubmitted session, got: %d, err: %v", count, err)
+		}
+		s.Wait()
+		if _, err := os.Stat(s.cfg.DeadLetterDir + "/5/" + deadLetterManifest); (err == nil) != (uploadErr != nil) {
+			t.Errorf("dead letter exists: %t, upload err: %v", err == nil, uploadErr)
+		}
+	}
+	for _, key := range []string{"5" + string(DOM) + "s", "5" + string(DOM) + "e", "5" + string(DEV)} {
+		if !objStorage.Exists(key) {
+			t.Errorf("%s wasn't uploaded after retry", key)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"strings"
+	"sync"
+
+	metrics "openreplay/backend/pkg/metrics/storage"
+	"openreplay/backend/pkg/objectstorage"
+)
+
+const (
+	// dedupPrefix is the location of deduplicated objects, they are named by the checksum of the stored data
+	dedupPrefix = "dedup/"
+	// dedupPointerPrefix starts the body of the pointer object uploaded under the session's key
+	dedupPointerPrefix = "openreplay-dedup:"
+	// dedupMetadataKey is the pointer object metadata key with the key of the deduplicated object
+	dedupMetadataKey = "dedup_key"
+	// dedupPointerContentType is the content type of the not compressed plain text pointer object
+	dedupPointerContentType = "text/x-openreplay-dedup-pointer"
+)
+
+// dedupIndex is an LRU set of checksums of the objects known to exist under dedup/
+type dedupIndex struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List // front is the most recently used checksum
+	items    map[string]*list.Element
+}
+
+func newDedupIndex(capacity int) *dedupIndex {
+	return &dedupIndex{
+		capacity: capacity,
+		order:    list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func (d *dedupIndex) contains(sum string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	item, ok := d.items[sum]
+	if ok {
+		d.order.MoveToFront(item)
+	}
+	return ok
+}
+
+func (d *dedupIndex) add(sum string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if item, ok := d.items[sum]; ok {
+		d.order.MoveToFront(item)
+		return
+	}
+	d.items[sum] = d.order.PushFront(sum)
+	if d.order.Len() > d.capacity {
+		oldest := d.order.Back()
+		d.order.Remove(oldest)
+		delete(d.items, oldest.Value.(string))
+	}
+}
+
+// shouldDedup skips encrypted files, each session has its own key, and indexed DOM files read with ranged GETs
+func (s *Storage) shouldDedup(task *Task, tp FileType) bool {
+	return s.dedup != nil && task.key == "" && !(tp == DOM && s.cfg.LayoutMode == layoutIndexed)
+}
+
+// uploadDeduplicated uploads the data under dedup/<sha256> if it isn't stored yet and the pointer under the key,
+// Download and PresignedURLs follow the pointer. Consistency caveats:
+//   - dedup/ objects are shared by sessions, Delete and lifecycle rules of session keys remove only pointers,
+//     so dedup/ needs its own lifecycle long enough for all sessions referencing its objects;
+//   - the index isn't checked against the object storage, a dedup/ object removed after it was indexed
+//     is still reported as a hit and new pointers to it are dangling;
+//   - instances don't share the index, a miss is checked with Exists and at worst the same data is uploaded
+//     again under the same key.
+func (s *Storage) uploadDeduplicated(task *Task, data *bytes.Buffer, key string, tp FileType, metadata map[string]string) error {
+	sum := checksum(data.Bytes())
+	contentKey := dedupPrefix + sum
+	if s.dedup.contains(sum) || s.objStorage.Exists(contentKey) {
+		metrics.IncreaseStorageDedupHits(tp.String())
+	} else if err := s.uploadObject(task, data, contentKey, tp, metadata); err != nil {
+		return err
+	}
+	s.dedup.add(sum)
+	return s.uploadPointer(task, key, tp, contentKey, metadata)
+}
+
+// uploadPointer uploads the pointer to the deduplicated object. The pointer is stored without compression,
+// compression and encryption metadata describe the deduplicated object only. The split offset is kept for DownloadRange.
+func (s *Storage) uploadPointer(task *Task, key string, tp FileType, contentKey string, metadata map[string]string) error {
+	opts := &objectstorage.UploadOptions{
+		Metadata:     map[string]string{dedupMetadataKey: contentKey, formatVersionMetadataKey: s.formatVersion},
+		StorageClass: s.storageClass[tp],
+		ACL:          s.acl,
+		Tags:         s.objectTags(task),
+	}
+	for k, v := range task.metadata {
+		opts.Metadata[k] = v
+	}
+	if offset, ok := metadata[splitOffsetMetadataKey]; ok {
+		opts.Metadata[splitOffsetMetadataKey] = offset
+	}
+	body := []byte(dedupPointerPrefix + contentKey)
+	return s.withRetry(task, key, tp, func(ctx context.Context) error {
+		opts.Context = ctx
+		return s.objStorage.UploadWithOptions(bytes.NewReader(body), key, dedupPointerContentType, objectstorage.NoCompression, opts)
+	})
+}
+
+// dedupTarget returns the key of the deduplicated object if the data is the pointer object body
+func dedupTarget(data []byte) (string, bool) {
+	if !bytes.HasPrefix(data, []byte(dedupPointerPrefix+dedupPrefix)) {
+		return "", false
+	}
+	key := string(data[len(dedupPointerPrefix):])
+	return key, !strings.ContainsAny(key, "\n\x00")
+}
@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/messages"
+	"openreplay/backend/pkg/objectstorage"
+)
+
+func TestDedup(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{Dedup: true, DedupIndexSize: 1, CompressionAlgo: "zstd"})
+	dom := bytes.Repeat([]byte("shared dom snapshot "), 10)
+	for _, id := range []uint64{43, 44} {
+		if err := os.WriteFile(s.cfg.FSDir+"/"+strconv.FormatUint(id, 10), dom, 0644); err != nil {
+			t.Fatal(err)
+		}
+		msg := &messages.SessionEnd{}
+		msg.SetSessionID(id)
+		if err := s.Process(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+		s.Wait()
+	}
+	var stored []string
+	for _, key := range objStorage.Keys() {
+		if strings.HasPrefix(key, dedupPrefix) {
+			stored = append(stored, key)
+		}
+	}
+	if len(stored) != 1 {
+		t.Fatalf("shared dom should be stored once: %v", stored)
+	}
+	for _, id := range []uint64{43, 44} {
+		key := strconv.FormatUint(id, 10) + string(DOM) + "s"
+		obj, ok := objStorage.Object(key)
+		if !ok || obj.Metadata[dedupMetadataKey] != stored[0] {
+			t.Fatalf("%s should point to %s", key, stored[0])
+		}
+		if obj.Compression != objectstorage.NoCompression || obj.ContentType != dedupPointerContentType ||
+			obj.Metadata[compressionMetadataKey] != "" {
+			t.Errorf("pointer %s should be stored as plain text: %s, %s", key, obj.Compression, obj.ContentType)
+		}
+		reader, err := s.Download(id, 0, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res, _ := io.ReadAll(reader); !bytes.Equal(res, dom) {
+			t.Errorf("downloaded data of %d mismatch", id)
+		}
+	}
+	// The index keeps one checksum, an evicted one is found with Exists
+	s.dedup.add("other")
+	if s.dedup.contains(strings.TrimPrefix(stored[0], dedupPrefix)) {
+		t.Error("the oldest checksum should be evicted")
+	}
+}
@@ -0,0 +1,55 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	metrics "openreplay/backend/pkg/metrics/storage"
+)
+
+// Delete removes all objects of the session: DOM parts, devtools, canvas and the manifest. Keys are built the same
+// way as during the upload, so the session end timestamp is required for the date placeholder and the project id
+// for the v2 key scheme. Missing objects are skipped.
+// Sessions uploaded with BATCH_UPLOADS are not supported, their parts are stored inside batch objects.
+func (s *Storage) Delete(ctx context.Context, projectID string, sessionID uint64, timestamp uint64) error {
+	loc, err := s.locateSession(projectID, sessionID, timestamp)
+	if err != nil {
+		s.log.Warn(ctx, "can't locate %s by manifest, looking for dom parts: %s", loc.base, err)
+		s.findDomKeys(loc)
+	}
+	var keys []string
+	if loc.manifest != nil {
+		for _, part := range loc.manifest.Parts {
+			// The batch object is shared with other sessions, only the manifest of the session is deleted
+			if !part.Batch {
+				keys = append(keys, part.Key)
+			}
+		}
+	} else {
+		keys = append(keys, loc.domKeys...)
+	}
+	// Manifest goes last to be able to find the parts if the deletion fails
+	keys = append(keys, s.objectKey(loc.base, DOM), s.objectKey(loc.base, DEV), s.objectKey(loc.base, CANVAS),
+		loc.base+manifestName)
+
+	var errs []error
+	deleted := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if deleted[key] || !s.objStorage.Exists(key) {
+			continue
+		}
+		deleted[key] = true
+		if err := s.objStorage.Delete(key); err != nil {
+			errs = append(errs, fmt.Errorf("can't delete %s: %s", key, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	metrics.IncreaseStorageSessionsDeleted()
+	return nil
+}
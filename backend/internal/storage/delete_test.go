@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/messages"
+	"openreplay/backend/pkg/objectstorage"
+)
+
+func TestDeleteSession(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{WriteManifest: true})
+	// Split session without manifest
+	for _, id := range []string{"35", "37"} {
+		for _, key := range []string{id + string(DOM) + "s", id + string(DOM) + "e", id + string(DEV)} {
+			if err := objStorage.Upload(strings.NewReader("data"), key, "", objectstorage.NoCompression); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := os.WriteFile(s.cfg.FSDir+"/36", []byte("dom"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(36)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	for _, id := range []uint64{35, 36, 35} {
+		if err := s.Delete(context.Background(), "", id, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keys := objStorage.Keys()
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "37") {
+			t.Errorf("object %s wasn't deleted", key)
+		}
+	}
+	if len(keys) != 3 {
+		t.Errorf("other session shouldn't be deleted: %v", keys)
+	}
+}
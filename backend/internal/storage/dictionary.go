@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/klauspost/compress/zstd"
+
+	"openreplay/backend/pkg/objectstorage"
+)
+
+const zstdDictMetadataKey = "zstd_dictionary_id"
+
+// loadZstdDictionary reads the zstd dictionary trained offline (zstd --train) and returns its content and id
+func loadZstdDictionary(path string) ([]byte, uint32, error) {
+	dict, err := os.ReadFile(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("can't read zstd dictionary: %s", err)
+	}
+	info, err := zstd.InspectDictionary(dict)
+	if err != nil {
+		return nil, 0, fmt.Errorf("wrong zstd dictionary: %s", err)
+	}
+	return dict, info.ID(), nil
+}
+
+// useZstdDictionary checks that the task's file is compressed with the dictionary
+func (s *Storage) useZstdDictionary(task *Task, tp FileType) bool {
+	return task.compressionOf(tp) == objectstorage.Zstd && s.zstdDict != nil
+}
+
+// setDictionaryMetadata saves the dictionary id to let the reader select the right dictionary for decompression
+func (s *Storage) setDictionaryMetadata(task *Task, tp FileType, metadata map[string]string) {
+	if s.useZstdDictionary(task, tp) {
+		metadata[zstdDictMetadataKey] = strconv.FormatUint(uint64(s.zstdDictID), 10)
+	}
+}
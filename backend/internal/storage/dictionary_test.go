@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+
+	config "openreplay/backend/internal/config/storage"
+)
+
+func TestZstdDictionary(t *testing.T) {
+	sample := []byte("openreplay session with a lot of repeated dom mutations")
+	var contents [][]byte
+	for i := 0; i < 500; i++ {
+		contents = append(contents, []byte(fmt.Sprintf("%s, node: %d, attr: %x, text: %s", sample, i*7919, i*i,
+			strings.Repeat(strconv.Itoa(i), i%13))))
+	}
+	dict, err := zstd.BuildDict(zstd.BuildDictOptions{ID: 42, Contents: contents, History: bytes.Repeat(sample, 10),
+		Offsets: [3]int{1, 4, 8}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dictPath := t.TempDir() + "/dict"
+	if err := os.WriteFile(dictPath, dict, 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, objStorage := newTestStorage(t, &config.Config{CompressionAlgo: "zstd", ZstdDictPath: dictPath})
+	task := &Task{ctx: context.Background(), id: "21", base: "21", compression: s.compression}
+	data, err := s.compress(sample, s.compression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.uploadWithRetry(task, data, "21"+string(DEV), DEV, nil); err != nil {
+		t.Fatal(err)
+	}
+	if id := objectMetadata(objStorage, "21"+string(DEV))[zstdDictMetadataKey]; id != "42" {
+		t.Errorf("wrong dictionary id in metadata: %s", id)
+	}
+	obj, _ := objStorage.Object("21" + string(DEV))
+	if res, err := s.decompress(obj.Data, s.compression); err != nil || !bytes.Equal(res, sample) {
+		t.Errorf("can't decompress data with dictionary: %v", err)
+	}
+}
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	gzip "github.com/klauspost/pgzip"
+
+	"openreplay/backend/pkg/objectstorage"
+)
+
+// Download returns the original (sorted) DOM mob file of the session, the session end timestamp is required to
+// locate the objects if the key template contains a date. Each uploaded part is decrypted with
+// the session's encryption key (empty key means no encryption) and decompressed separately.
+// If the session has a manifest, parts, compression and encryption mode are taken from it.
+// Both object layouts are supported, parts of the indexed dom.mob object are read with ranged GETs.
+// Sessions uploaded with BATCH_UPLOADS are not supported: their parts are stored inside batches/<host>/<ts>.tar,
+// to read them look up the part key in the batch's .index.json and read Size bytes from Offset of the tar object.
+func (s *Storage) Download(sessionID uint64, timestamp uint64, encryptionKey string) (io.ReadCloser, error) {
+	return s.DownloadProjectSession("", sessionID, timestamp, encryptionKey)
+}
+
+// DownloadProjectSession is Download for the v2 key scheme, the project id should be the same as in the session's
+// context during the upload
+func (s *Storage) DownloadProjectSession(projectID string, sessionID uint64, timestamp uint64, encryptionKey string) (io.ReadCloser, error) {
+	loc, err := s.locateSession(projectID, sessionID, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if loc.manifest != nil {
+		mob, err := s.downloadFromManifest(loc.manifest, sessionID, encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(mob), nil
+	}
+	if loc.indexed {
+		mob, err := s.downloadIndexed(loc.domKeys[0], sessionID, encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		return io.NopCloser(mob), nil
+	}
+	// All parts are checked before the download to not join parts of different formats
+	encodings := make([]partEncoding, len(loc.domKeys))
+	for i, key := range loc.domKeys {
+		info, err := s.objStorage.Head(key)
+		if err != nil {
+			return nil, fmt.Errorf("can't get %s info: %s", key, err)
+		}
+		if err := s.checkFormatVersion(key, info.Metadata[formatVersionMetadataKey]); err != nil {
+			return nil, err
+		}
+		if encodings[i], err = s.objectEncoding(info); err != nil {
+			return nil, err
+		}
+	}
+	mob := new(bytes.Buffer)
+	for i, key := range loc.domKeys {
+		part, err := s.downloadPart(strconv.FormatUint(sessionID, 10), key, encryptionKey, encodings[i])
+		if err != nil {
+			return nil, fmt.Errorf("can't download %s: %s", key, err)
+		}
+		mob.Write(part)
+	}
+	return io.NopCloser(mob), nil
+}
+
+// partEncoding is the compression and encryption mode of the stored DOM part, encryption is empty for not
+// encrypted parts
+type partEncoding struct {
+	compression objectstorage.CompressionType
+	encryption  string
+}
+
+// objectEncoding returns the encoding of the object from its metadata, pointers of deduplicated objects are
+// resolved to their targets. Objects uploaded before the metadata was recorded are decoded with the current config.
+func (s *Storage) objectEncoding(info *objectstorage.ObjectInfo) (partEncoding, error) {
+	if target, ok := info.Metadata[dedupMetadataKey]; ok {
+		var err error
+		if info, err = s.objStorage.Head(target); err != nil {
+			return partEncoding{}, fmt.Errorf("can't get %s info: %s", target, err)
+		}
+	}
+	enc := partEncoding{compression: s.compressionFor(DOM), encryption: s.cfg.EncryptionMode}
+	if compression, err := objectstorage.ParseCompressionType(info.Metadata[compressionMetadataKey]); err == nil {
+		enc.compression = compression
+	}
+	if mode, ok := info.Metadata[encryptionMetadataKey]; ok {
+		enc.encryption = mode
+		if mode == encryptionNone {
+			enc.encryption = ""
+		}
+	} else if enc.encryption == "" {
+		enc.encryption = encryptionCBC
+	}
+	return enc, nil
+}
+
+func (s *Storage) downloadPart(sessionID, key, encryptionKey string, enc partEncoding) ([]byte, error) {
+	data, err := s.getObject(key)
+	if err != nil {
+		return nil, err
+	}
+	return s.decodePart(sessionID, data, encryptionKey, enc)
+}
+
+// decodePart decrypts and decompresses the DOM part as it was stored, the key isn't used for not encrypted parts
+func (s *Storage) decodePart(sessionID string, data []byte, encryptionKey string, enc partEncoding) ([]byte, error) {
+	var err error
+	if encryptionKey != "" && enc.encryption != "" {
+		if data, err = s.decrypt(enc.encryption, sessionID, data, encryptionKey); err != nil {
+			return nil, err
+		}
+	}
+	return s.decompress(data, enc.compression)
+}
+
+func (s *Storage) getObject(key string) ([]byte, error) {
+	return s.readObject(s.objStorage, key)
+}
+
+func (s *Storage) readObject(objStorage objectstorage.ObjectStorage, key string) ([]byte, error) {
+	reader, err := objStorage.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	// Deduplicated objects are read regardless of the current DEDUP setting, they are always in the primary storage
+	if target, ok := dedupTarget(data); ok {
+		return s.getObject(target)
+	}
+	return data, nil
+}
+
+// decrypt decrypts the session file with the mode it was encrypted with, GCM mode also checks data integrity
+func (s *Storage) decrypt(mode, sessionID string, data []byte, encryptionKey string) ([]byte, error) {
+	if mode == encryptionGCM {
+		decrypted, err := decryptGCM(data, []byte(encryptionKey), sessionID)
+		if err != nil {
+			return nil, fmt.Errorf("can't decrypt data: %s", err)
+		}
+		return decrypted, nil
+	}
+	// CBC works with whole blocks, for example not encrypted legacy objects aren't aligned
+	if len(data) < aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("can't decrypt data: size %d isn't a multiple of the block size", len(data))
+	}
+	decrypted, err := DecryptData(data, []byte(encryptionKey))
+	if err != nil {
+		return nil, fmt.Errorf("can't decrypt data: %s", err)
+	}
+	// Remove padding added to fill the last block during encryption
+	if len(decrypted) == 0 {
+		return decrypted, nil
+	}
+	padding := int(decrypted[len(decrypted)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(decrypted) {
+		return nil, fmt.Errorf("wrong padding size: %d", padding)
+	}
+	return decrypted[:len(decrypted)-padding], nil
+}
+
+// decompress uses all known zstd dictionaries, the decoder selects one by the dictionary id of the frame
+func (s *Storage) decompress(data []byte, compressionType objectstorage.CompressionType) ([]byte, error) {
+	var (
+		reader io.Reader
+		err    error
+	)
+	switch compressionType {
+	case objectstorage.Gzip:
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		reader = gr
+	case objectstorage.Brotli:
+		reader = brotli.NewReader(bytes.NewReader(data))
+	case objectstorage.Zstd:
+		var opts []zstd.DOption
+		if s.zstdDict != nil {
+			opts = append(opts, zstd.WithDecoderDicts(s.zstdDict))
+		}
+		zr, err := zstd.NewReader(bytes.NewReader(data), opts...)
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		reader = zr
+	default:
+		return data, nil
+	}
+	res, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("can't decompress data: %s", err)
+	}
+	return res, nil
+}
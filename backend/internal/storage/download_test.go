@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	gzip "github.com/klauspost/pgzip"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/messages"
+	"openreplay/backend/pkg/objectstorage"
+)
+
+func TestDownloadRoundTrip(t *testing.T) {
+	for _, algo := range []string{"none", "gzip", "brotli", "zstd"} {
+		s, objStorage := newTestStorage(t, &config.Config{CompressionAlgo: algo, GzipLevel: gzip.BestSpeed})
+		dom := bytes.Repeat([]byte("dom start "), 100)
+		domEnd := bytes.Repeat([]byte("dom end "), 100)
+		for key, part := range map[string][]byte{"7" + string(DOM) + "s": dom, "7" + string(DOM) + "e": domEnd} {
+			compressed, err := s.compress(part, s.compression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := objStorage.Upload(compressed, key, "", s.compression); err != nil {
+				t.Fatal(err)
+			}
+		}
+		reader, err := s.Download(7, 0, "")
+		if err != nil {
+			t.Fatalf("%s: can't download session: %s", algo, err)
+		}
+		res, _ := io.ReadAll(reader)
+		if !bytes.Equal(res, append(dom, domEnd...)) {
+			t.Errorf("%s: downloaded data mismatch", algo)
+		}
+	}
+}
+
+// Sessions without manifests are decoded with the compression and encryption mode from object metadata
+func TestDownloadStoredEncoding(t *testing.T) {
+	for _, layout := range []string{layoutSplit, layoutIndexed} {
+		s, _ := newTestStorage(t, &config.Config{CompressionAlgo: "gzip", LayoutMode: layout})
+		dom := bytes.Repeat([]byte("dom"), 100)
+		if err := os.WriteFile(s.cfg.FSDir+"/25", dom, 0644); err != nil {
+			t.Fatal(err)
+		}
+		msg := &messages.SessionEnd{}
+		msg.SetSessionID(25)
+		if err := s.Process(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+		s.Wait()
+		s.compression, s.cfg.EncryptionMode = objectstorage.Zstd, encryptionGCM
+		reader, err := s.Download(25, 0, "session key material")
+		if err != nil {
+			t.Fatalf("can't download session, layout: %s: %s", layout, err)
+		}
+		if res, _ := io.ReadAll(reader); !bytes.Equal(res, dom) {
+			t.Errorf("downloaded data mismatch, layout: %s", layout)
+		}
+		if res, err := s.DownloadRange("", 25, 0, "session key material", 0, 3); err != nil || string(res) != "dom" {
+			t.Errorf("wrong range, layout: %s: %q, %v", layout, res, err)
+		}
+	}
+}
+
+func TestDecryptNotAligned(t *testing.T) {
+	s, _ := newTestStorage(t, &config.Config{})
+	key := string(bytes.Repeat([]byte("k"), 32))
+	// Not encrypted legacy objects are rejected instead of panicking in the CBC decrypter
+	for _, data := range [][]byte{nil, []byte("not encrypted dom"), bytes.Repeat([]byte("d"), 15)} {
+		if _, err := s.decrypt(encryptionCBC, "1", data, key); err == nil {
+			t.Errorf("data of size %d shouldn't be decrypted", len(data))
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/logger"
+	"openreplay/backend/pkg/messages"
+	"openreplay/backend/pkg/objectstorage/memory"
+)
+
+// CBC encryption isn't available in the open source edition, such sessions are uploaded as is and must not look encrypted
+func TestNotEncryptedFallback(t *testing.T) {
+	if _, err := EncryptData([]byte("dom"), []byte("session key material")); err == nil {
+		t.Skip("cbc encryption is supported in this edition")
+	}
+	s, objStorage := newTestStorage(t, &config.Config{CompressionAlgo: "none", WriteManifest: true})
+	dom := bytes.Repeat([]byte("dom"), 100)
+	if err := os.WriteFile(s.cfg.FSDir+"/24", dom, 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{EncryptionKey: "session key material"}
+	msg.SetSessionID(24)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	obj, ok := objStorage.Object("24/dom.mobs")
+	if !ok || !bytes.Equal(obj.Data, dom) {
+		t.Fatalf("session should be uploaded as is, keys: %v", objStorage.Keys())
+	}
+	if keyID, ok := obj.Metadata[encryptionKeyIDMetadataKey]; ok {
+		t.Errorf("not encrypted object has encryption key id: %s", keyID)
+	}
+	obj, ok = objStorage.Object("24" + manifestName)
+	if !ok {
+		t.Fatal("manifest wasn't uploaded")
+	}
+	manifest := &sessionManifest{}
+	if err := json.Unmarshal(obj.Data, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Encryption != "" || manifest.KeyID != "" {
+		t.Errorf("not encrypted session has encryption in manifest: %+v", manifest)
+	}
+}
+
+func TestGCMUnsupported(t *testing.T) {
+	if gcmSupported {
+		t.Skip("gcm encryption is supported in this edition")
+	}
+	_, err := New(&config.Config{FSDir: t.TempDir(), FileSplitSize: 1000, MaxFileSize: 1 << 20, EncryptionMode: "gcm"},
+		logger.New(), memory.New(), nil)
+	if err == nil {
+		t.Error("gcm encryption mode should be rejected")
+	}
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"fmt"
+
+	"openreplay/backend/pkg/objectstorage"
+)
+
+const compressionMetadataKey = "compression"
+
+// parseFileCompressions returns compression algorithms configured for separate file types (dom, devtools, canvas),
+// other file types use the default algorithm. Returns nil if all file types use the default one.
+func parseFileCompressions(algos map[string]string) (map[FileType]objectstorage.CompressionType, error) {
+	if len(algos) == 0 {
+		return nil, nil
+	}
+	compressions := make(map[FileType]objectstorage.CompressionType, len(algos))
+	for name, algo := range algos {
+		tp, ok := parseFileType(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown file type: %s", name)
+		}
+		compression, err := objectstorage.ParseCompressionType(algo)
+		if err != nil {
+			return nil, fmt.Errorf("wrong %s compression: %s", name, err)
+		}
+		compressions[tp] = compression
+	}
+	return compressions, nil
+}
+
+func parseFileType(name string) (FileType, bool) {
+	for _, tp := range fileTypes {
+		if tp.String() == name {
+			return tp, true
+		}
+	}
+	return "", false
+}
+
+// compressionFor returns the configured compression of the file type
+func (s *Storage) compressionFor(tp FileType) objectstorage.CompressionType {
+	if compression, ok := s.compressions[tp]; ok {
+		return compression
+	}
+	return s.compression
+}
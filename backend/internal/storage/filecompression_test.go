@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/messages"
+)
+
+func TestFileCompression(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{CompressionAlgo: "none",
+		FileCompression: map[string]string{"dom": "gzip", "devtools": "zstd"}})
+	files := map[FileType][]byte{DOM: bytes.Repeat([]byte("dom"), 100), DEV: bytes.Repeat([]byte("devtools"), 100)}
+	if err := os.WriteFile(s.cfg.FSDir+"/27", files[DOM], 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.cfg.FSDir+"/27devtools", files[DEV], 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(27)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	for tp, key := range map[FileType]string{DOM: "27" + string(DOM) + "s", DEV: "27" + string(DEV)} {
+		obj, ok := objStorage.Object(key)
+		if !ok {
+			t.Fatalf("%s wasn't uploaded", key)
+		}
+		if obj.Compression != s.compressionFor(tp) || obj.Metadata[compressionMetadataKey] != s.compressionFor(tp).String() {
+			t.Errorf("wrong %s compression: %s, metadata: %v", tp.String(), obj.Compression, obj.Metadata)
+		}
+		data, err := s.decompress(obj.Data, obj.Compression)
+		if err != nil {
+			t.Fatalf("can't decompress %s: %s", key, err)
+		}
+		if !bytes.Equal(data, files[tp]) {
+			t.Errorf("%s data mismatch", tp.String())
+		}
+	}
+	if _, err := parseFileCompressions(map[string]string{"video": "gzip"}); err == nil {
+		t.Error("unknown file type should fail")
+	}
+}
@@ -0,0 +1,98 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	metrics "openreplay/backend/pkg/metrics/storage"
+)
+
+// flushState tracks not uploaded sessions by generation, Flush starts a new generation and waits until all
+// sessions of the previous generations are uploaded
+type flushState struct {
+	mu         sync.Mutex
+	generation uint64
+	inflight   map[uint64]int // number of not uploaded sessions of each generation
+	changed    chan struct{}  // closed and replaced every time a session is done
+}
+
+func newFlushState() *flushState {
+	return &flushState{
+		inflight: make(map[uint64]int),
+		changed:  make(chan struct{}),
+	}
+}
+
+// taskSubmitted should be called before the session is submitted to the pools
+func (s *Storage) taskSubmitted(task *Task) {
+	f := s.flushes
+	f.mu.Lock()
+	task.generation = f.generation
+	f.inflight[task.generation]++
+	f.mu.Unlock()
+	metrics.RecordTaskQueueDepth(float64(s.pending.Add(1)))
+}
+
+// taskDone should be called once the session is uploaded, failed or dropped
+func (s *Storage) taskDone(task *Task) {
+	f := s.flushes
+	f.mu.Lock()
+	if f.inflight[task.generation]--; f.inflight[task.generation] <= 0 {
+		delete(f.inflight, task.generation)
+	}
+	close(f.changed)
+	f.changed = make(chan struct{})
+	f.mu.Unlock()
+	metrics.RecordTaskQueueDepth(float64(s.pending.Add(-1)))
+	s.releaseInFlight(task)
+	if task.deadLetterDir != "" {
+		s.retrying.Delete(task.deadLetterDir)
+	}
+}
+
+// flushing checks that Flush waits for the session, batched sessions are uploaded right away then
+func (s *Storage) flushing(task *Task) bool {
+	f := s.flushes
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return task.generation < f.generation
+}
+
+// Flush waits until all sessions submitted before the call are uploaded (or failed) and uploads the current batch.
+// Unlike Close, the storage keeps accepting new sessions during and after the flush.
+func (s *Storage) Flush(ctx context.Context) error {
+	f := s.flushes
+	f.mu.Lock()
+	last := f.generation
+	f.generation++
+	f.mu.Unlock()
+	// Sessions batched before the new generation are done only once their batch is uploaded
+	if s.batcher != nil {
+		s.batcher.flush()
+	}
+	for {
+		f.mu.Lock()
+		drained := true
+		for generation := range f.inflight {
+			if generation <= last {
+				drained = false
+				break
+			}
+		}
+		changed := f.changed
+		f.mu.Unlock()
+		if drained {
+			break
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return fmt.Errorf("storage flush interrupted: %s", ctx.Err())
+		}
+	}
+	if s.batcher != nil {
+		s.batcher.flush()
+	}
+	return nil
+}
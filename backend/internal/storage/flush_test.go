@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/messages"
+)
+
+func TestFlush(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{Workers: 2})
+	objStorage.SetLatency(20 * time.Millisecond)
+	process := func(id uint64) {
+		if err := os.WriteFile(fmt.Sprintf("%s/%d", s.cfg.FSDir, id), []byte("dom"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		msg := &messages.SessionEnd{}
+		msg.SetSessionID(id)
+		if err := s.Process(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for id := uint64(51); id <= 54; id++ {
+		process(id)
+	}
+	if err := s.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for id := 51; id <= 54; id++ {
+		if !objStorage.Exists(fmt.Sprintf("%d%ss", id, string(DOM))) {
+			t.Errorf("session %d wasn't uploaded before flush returned", id)
+		}
+	}
+
+	// Storage is still usable after flush
+	objStorage.SetLatency(time.Second)
+	process(55)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.Flush(ctx); err == nil {
+		t.Error("expected interrupted flush error")
+	}
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !objStorage.Exists("55" + string(DOM) + "s") {
+		t.Error("session submitted after flush wasn't uploaded")
+	}
+}
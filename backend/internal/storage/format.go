@@ -0,0 +1,19 @@
+package storage
+
+import "fmt"
+
+const (
+	// formatVersionMetadataKey is the object metadata key with the mob format version of the stored file
+	formatVersionMetadataKey = "format_version"
+	// mobFormatVersion is the current mob format, it should be increased after incompatible format changes
+	mobFormatVersion = "1"
+)
+
+// checkFormatVersion refuses to read the object written in another mob format. Objects uploaded before
+// the version was recorded don't have it and are read as the current format.
+func (s *Storage) checkFormatVersion(key, version string) error {
+	if version != "" && version != s.formatVersion {
+		return fmt.Errorf("unsupported mob format version of %s: %s, expected: %s", key, version, s.formatVersion)
+	}
+	return nil
+}
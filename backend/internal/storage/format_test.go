@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/messages"
+)
+
+func TestFormatVersion(t *testing.T) {
+	for _, manifest := range []bool{false, true} {
+		s, objStorage := newTestStorage(t, &config.Config{WriteManifest: manifest})
+		if err := os.WriteFile(s.cfg.FSDir+"/38", []byte("dom"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		msg := &messages.SessionEnd{}
+		msg.SetSessionID(38)
+		if err := s.Process(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+		s.Wait()
+		if v := objectMetadata(objStorage, "38"+string(DOM)+"s")[formatVersionMetadataKey]; v != mobFormatVersion {
+			t.Errorf("wrong format version in metadata: %s", v)
+		}
+		if _, err := s.Download(38, 0, ""); err != nil {
+			t.Fatal(err)
+		}
+		s.formatVersion = "2"
+		if _, err := s.Download(38, 0, ""); err == nil {
+			t.Errorf("session of another format shouldn't be downloaded, manifest: %t", manifest)
+		}
+	}
+}
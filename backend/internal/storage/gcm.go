@@ -0,0 +1,16 @@
+package storage
+
+import (
+	"errors"
+)
+
+// gcmSupported enables ENCRYPTION_MODE=gcm, AES-256-GCM encryption is available only in the enterprise edition
+const gcmSupported = false
+
+func encryptGCM(data, keyMaterial []byte, sessionID string) ([]byte, error) {
+	return nil, errors.New("not supported")
+}
+
+func decryptGCM(data, keyMaterial []byte, sessionID string) ([]byte, error) {
+	return nil, errors.New("not supported")
+}
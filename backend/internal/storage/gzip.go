@@ -1,14 +1,98 @@
 package storage
 
 import (
-	gzip "github.com/klauspost/pgzip"
+	"fmt"
 	"io"
+	"runtime"
+	"strconv"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+	gzip "github.com/klauspost/pgzip"
+
+	metrics "openreplay/backend/pkg/metrics/storage"
+	"openreplay/backend/pkg/objectstorage"
 )
 
+// compressionLevelMetadataKey is the object metadata key with the compression level, it isn't set for
+// not compressed and precompressed files
+const compressionLevelMetadataKey = "compression_level"
+
+// gzipLevelFor returns the gzip compression level for the file of the given size, in adaptive mode small files
+// are compressed with best speed, large files with best compression and the rest with the default level
+func (s *Storage) gzipLevelFor(size int64) int {
+	level := s.gzipLevelOf(size)
+	metrics.IncreaseStorageGzipLevel(level)
+	return level
+}
+
+// setCompressionLevelMetadata records the level the file of the given raw size was compressed with
+func (s *Storage) setCompressionLevelMetadata(task *Task, tp FileType, size int64, metadata map[string]string) {
+	if task.isPrecompressed(tp) {
+		return
+	}
+	switch task.compressionOf(tp) {
+	case objectstorage.Gzip:
+		metadata[compressionLevelMetadataKey] = strconv.Itoa(s.gzipLevelOf(size))
+	case objectstorage.Brotli:
+		metadata[compressionLevelMetadataKey] = strconv.Itoa(brotli.DefaultCompression)
+	case objectstorage.Zstd:
+		metadata[compressionLevelMetadataKey] = zstd.SpeedDefault.String()
+	}
+}
+
+func (s *Storage) gzipLevelOf(size int64) int {
+	level := s.gzipLevel
+	if s.cfg.GzipAdaptiveLevel {
+		switch {
+		case size < s.cfg.GzipSmallFileSize:
+			level = gzip.BestSpeed
+		case size > s.cfg.GzipLargeFileSize:
+			level = gzip.BestCompression
+		default:
+			level = gzip.DefaultCompression
+		}
+	}
+	return level
+}
+
+// newGzipWriter returns the pgzip writer with the configured block size and number of parallel blocks
+func (s *Storage) newGzipWriter(w io.Writer, level int) (*gzip.Writer, error) {
+	gw, err := gzip.NewWriterLevel(w, level)
+	if err != nil {
+		return nil, err
+	}
+	if err := gw.SetConcurrency(s.gzipBlockSize, s.gzipBlocks); err != nil {
+		return nil, err
+	}
+	return gw, nil
+}
+
+// defaultGzipBlockSize is the pgzip default block size
+const defaultGzipBlockSize = 1 << 20
+
+// parseGzipConcurrency validates pgzip block settings, zero values mean pgzip defaults: 1MB blocks, one per CPU
+func parseGzipConcurrency(blockSize, blocks int) (int, int, error) {
+	if blockSize == 0 {
+		blockSize = defaultGzipBlockSize
+	}
+	if blocks == 0 {
+		blocks = runtime.GOMAXPROCS(0)
+	}
+	if err := gzip.NewWriter(io.Discard).SetConcurrency(blockSize, blocks); err != nil {
+		return 0, 0, fmt.Errorf("wrong gzip block settings: %s", err)
+	}
+	return blockSize, blocks, nil
+}
+
 func (s *Storage) gzipFile(file io.Reader) io.Reader {
 	reader, writer := io.Pipe()
 	go func() {
-		gw, _ := gzip.NewWriterLevel(writer, gzip.BestSpeed)
+		gw, err := s.newGzipWriter(writer, s.gzipLevel)
+		if err != nil {
+			writer.CloseWithError(err)
+			return
+		}
 		io.Copy(gw, file)
 
 		gw.Close()
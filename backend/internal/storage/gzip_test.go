@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"testing"
+
+	gzip "github.com/klauspost/pgzip"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/logger"
+	"openreplay/backend/pkg/messages"
+	"openreplay/backend/pkg/objectstorage"
+	"openreplay/backend/pkg/objectstorage/memory"
+)
+
+func TestCompressGzipLevels(t *testing.T) {
+	data := bytes.Repeat([]byte("openreplay session data "), 1000)
+	for level := gzip.HuffmanOnly; level <= gzip.BestCompression; level++ {
+		s, _ := newTestStorage(t, &config.Config{GzipLevel: level})
+		if s.gzipLevel != level {
+			t.Fatalf("expected level %d, got %d", level, s.gzipLevel)
+		}
+		compressed, err := s.compress(data, objectstorage.Gzip)
+		if err != nil {
+			t.Fatalf("level %d: can't compress: %s", level, err)
+		}
+		r, err := gzip.NewReader(compressed)
+		if err != nil {
+			t.Fatalf("level %d: can't create reader: %s", level, err)
+		}
+		res, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("level %d: can't decompress: %s", level, err)
+		}
+		if !bytes.Equal(res, data) {
+			t.Errorf("level %d: data mismatch after round-trip", level)
+		}
+	}
+}
+
+func TestWrongGzipLevel(t *testing.T) {
+	s, _ := newTestStorage(t, &config.Config{GzipLevel: 42})
+	if s.gzipLevel != gzip.BestSpeed {
+		t.Errorf("expected fallback to best speed, got %d", s.gzipLevel)
+	}
+}
+
+func TestGzipConcurrency(t *testing.T) {
+	if _, _, err := parseGzipConcurrency(1024, 2); err == nil {
+		t.Error("too small gzip block should fail")
+	}
+	if _, _, err := parseGzipConcurrency(1<<20, -1); err == nil {
+		t.Error("negative number of gzip blocks should fail")
+	}
+	s, _ := newTestStorage(t, &config.Config{CompressionAlgo: "gzip", GzipLevel: gzip.DefaultCompression,
+		GzipBlockSize: 1 << 15, GzipBlocks: 2})
+	data := bytes.Repeat([]byte("gzip block "), 1<<13)
+	compressed, err := s.compress(data, s.compression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := s.decompress(compressed.Bytes(), s.compression); err != nil || !bytes.Equal(res, data) {
+		t.Errorf("data compressed in several blocks mismatch: %v", err)
+	}
+}
+
+func TestGzipAdaptiveLevel(t *testing.T) {
+	s, _ := newTestStorage(t, &config.Config{GzipLevel: gzip.HuffmanOnly, GzipAdaptiveLevel: true,
+		GzipSmallFileSize: 100, GzipLargeFileSize: 1000})
+	for size, level := range map[int64]int{10: gzip.BestSpeed, 500: gzip.DefaultCompression, 5000: gzip.BestCompression} {
+		if got := s.gzipLevelFor(size); got != level {
+			t.Errorf("wrong gzip level for %d bytes: %d, expected: %d", size, got, level)
+		}
+	}
+	s.cfg.GzipAdaptiveLevel = false
+	if got := s.gzipLevelFor(5000); got != gzip.HuffmanOnly {
+		t.Errorf("fixed gzip level wasn't used: %d", got)
+	}
+}
+
+func TestCompressionLevelMetadata(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{CompressionAlgo: "gzip", GzipAdaptiveLevel: true,
+		GzipSmallFileSize: 100, GzipLargeFileSize: 1000, FileCompression: map[string]string{"devtools": "zstd"}})
+	if err := os.WriteFile(s.cfg.FSDir+"/39", []byte("dom"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.localPath(s.cfg.FSDir+"/39", DEV), []byte("devtools"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(39)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	for key, expected := range map[string][2]string{
+		"39" + string(DOM) + "s": {"gzip", strconv.Itoa(gzip.BestSpeed)},
+		"39" + string(DEV):       {"zstd", "default"},
+	} {
+		metadata := objectMetadata(objStorage, key)
+		if metadata[compressionMetadataKey] != expected[0] || metadata[compressionLevelMetadataKey] != expected[1] {
+			t.Errorf("wrong compression metadata of %s: %v", key, metadata)
+		}
+	}
+}
+
+// BenchmarkGzipConcurrency compresses the large DOM file with different pgzip block settings
+func BenchmarkGzipConcurrency(b *testing.B) {
+	raw := benchmarkMob(1 << 17)
+	for _, bc := range []struct{ blockSize, blocks int }{
+		{1 << 18, 1}, {1 << 18, 4}, {1 << 20, 1}, {1 << 20, 4}, {1 << 22, 4},
+	} {
+		b.Run(fmt.Sprintf("block-%dk/blocks-%d", bc.blockSize>>10, bc.blocks), func(b *testing.B) {
+			s, err := New(&config.Config{FSDir: b.TempDir(), FileSplitSize: 1 << 19, MaxFileSize: 1 << 30,
+				CompressionAlgo: "gzip", GzipLevel: gzip.DefaultCompression, GzipBlockSize: bc.blockSize,
+				GzipBlocks: bc.blocks, Workers: 1},
+				logger.New(), memory.New(), nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer s.Close(context.Background())
+			b.SetBytes(int64(len(raw)))
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				compressed, err := s.compress(raw, s.compression)
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.ReportMetric(float64(len(raw))/float64(compressed.Len()), "ratio")
+				putBuffer(compressed)
+			}
+		})
+	}
+}
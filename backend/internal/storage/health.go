@@ -0,0 +1,82 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// healthState collects upload results of the current HealthWindow and the time of the last upload and panic
+type healthState struct {
+	mu          sync.Mutex
+	windowStart time.Time
+	uploads     int
+	failures    int
+	lastUpload  time.Time
+	lastPanic   time.Time
+}
+
+func newHealthState() *healthState {
+	now := time.Now()
+	return &healthState{windowStart: now, lastUpload: now}
+}
+
+func (h *healthState) recordUpload(success bool, window time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	if now.Sub(h.windowStart) >= window {
+		h.windowStart, h.uploads, h.failures = now, 0, 0
+	}
+	h.uploads++
+	if success {
+		h.lastUpload = now
+	} else {
+		h.failures++
+	}
+}
+
+func (h *healthState) recordPanic() {
+	h.mu.Lock()
+	h.lastPanic = time.Now()
+	h.mu.Unlock()
+}
+
+// Health returns an error if the storage can't upload sessions: it's closed, a worker panicked during the last
+// HealthWindow, too many uploads failed or sessions are waiting but nothing was uploaded for HealthMaxUploadAge,
+// or the dead letter dir has too many sessions. It's intended for readiness probes.
+func (s *Storage) Health() error {
+	if s.isClosed() {
+		return ErrStorageClosed
+	}
+	h := s.health
+	h.mu.Lock()
+	lastPanic, lastUpload := h.lastPanic, h.lastUpload
+	uploads, failures := h.uploads, h.failures
+	if time.Since(h.windowStart) >= s.cfg.HealthWindow {
+		uploads, failures = 0, 0
+	}
+	h.mu.Unlock()
+
+	if !lastPanic.IsZero() && time.Since(lastPanic) < s.cfg.HealthWindow {
+		return fmt.Errorf("worker panicked %s ago", time.Since(lastPanic).Round(time.Second))
+	}
+	if s.cfg.HealthMaxErrorRate > 0 && uploads >= s.cfg.HealthMinUploads &&
+		float64(failures)/float64(uploads) > s.cfg.HealthMaxErrorRate {
+		return fmt.Errorf("high upload error rate: %d of %d uploads failed", failures, uploads)
+	}
+	if s.cfg.HealthMaxUploadAge > 0 && s.pending.Load() > 0 && time.Since(lastUpload) > s.cfg.HealthMaxUploadAge {
+		return fmt.Errorf("no successful uploads for %s, pending sessions: %d", time.Since(lastUpload).Round(time.Second), s.pending.Load())
+	}
+	if s.cfg.HealthMaxDeadLetters > 0 && s.cfg.DeadLetterDir != "" {
+		entries, err := os.ReadDir(s.cfg.DeadLetterDir)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("can't read dead letter dir: %s", err)
+		}
+		if len(entries) > s.cfg.HealthMaxDeadLetters {
+			return fmt.Errorf("too many dead-lettered sessions: %d", len(entries))
+		}
+	}
+	return nil
+}
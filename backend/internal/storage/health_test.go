@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	config "openreplay/backend/internal/config/storage"
+)
+
+func TestHealth(t *testing.T) {
+	s, _ := newTestStorage(t, &config.Config{HealthWindow: time.Minute, HealthMaxErrorRate: 0.5, HealthMinUploads: 2,
+		HealthMaxDeadLetters: 1, DeadLetterDir: t.TempDir()})
+	if err := s.Health(); err != nil {
+		t.Fatalf("new storage should be healthy: %s", err)
+	}
+	s.health.recordUpload(false, s.cfg.HealthWindow)
+	s.health.recordUpload(false, s.cfg.HealthWindow)
+	if err := s.Health(); err == nil {
+		t.Error("storage with failed uploads shouldn't be healthy")
+	}
+	s.health = newHealthState()
+	for _, id := range []string{"1", "2"} {
+		if err := os.Mkdir(s.cfg.DeadLetterDir+"/"+id, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Health(); err == nil {
+		t.Error("storage with dead letter backlog shouldn't be healthy")
+	}
+	s.cfg.HealthMaxDeadLetters = 0
+	s.health.recordPanic()
+	if err := s.Health(); err == nil {
+		t.Error("storage with panicked worker shouldn't be healthy")
+	}
+}
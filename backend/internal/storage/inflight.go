@@ -0,0 +1,44 @@
+package storage
+
+import (
+	metrics "openreplay/backend/pkg/metrics/storage"
+)
+
+// acquireInFlight reserves the memory budget for all session files which are read into memory. The whole session
+// is reserved at once to not block sessions holding a part of the budget, files bigger than the budget take all of it.
+func (s *Storage) acquireInFlight(task *Task) error {
+	if s.inFlight == nil {
+		return nil
+	}
+	var size int64
+	for _, tp := range fileTypes {
+		if tp == DEV && !s.cfg.ProcessDevTools {
+			continue
+		}
+		fileSize, err := s.source.Size(task.paths[tp])
+		if err != nil || fileSize > s.cfg.MaxFileSize || (tp == DOM && s.isStreamed(task, fileSize)) {
+			continue
+		}
+		size += fileSize
+	}
+	if size > s.cfg.MaxInFlightBytes {
+		size = s.cfg.MaxInFlightBytes
+	}
+	if size == 0 {
+		return nil
+	}
+	if err := s.inFlight.Acquire(task.ctx, size); err != nil {
+		return err
+	}
+	task.inFlightBytes.Store(size)
+	metrics.RecordInFlightBytes(float64(s.inFlightBytes.Add(size)))
+	return nil
+}
+
+// releaseInFlight returns the session's memory budget, it's safe to call it more than once
+func (s *Storage) releaseInFlight(task *Task) {
+	if size := task.inFlightBytes.Swap(0); size > 0 {
+		s.inFlight.Release(size)
+		metrics.RecordInFlightBytes(float64(s.inFlightBytes.Add(-size)))
+	}
+}
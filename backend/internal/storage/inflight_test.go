@@ -0,0 +1,33 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	config "openreplay/backend/internal/config/storage"
+)
+
+func TestInFlightBytes(t *testing.T) {
+	s, _ := newTestStorage(t, &config.Config{MaxInFlightBytes: 10})
+	if err := os.WriteFile(s.cfg.FSDir+"/25", []byte("dom file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	first := &Task{ctx: context.Background(), paths: s.sessionPaths("", 25)}
+	if err := s.acquireInFlight(first); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	second := &Task{ctx: ctx, paths: first.paths}
+	if err := s.acquireInFlight(second); err == nil {
+		t.Fatal("second session should wait for the budget")
+	}
+	s.releaseInFlight(first)
+	s.releaseInFlight(first)
+	second.ctx = context.Background()
+	if err := s.acquireInFlight(second); err != nil {
+		t.Fatalf("budget should be released: %s", err)
+	}
+}
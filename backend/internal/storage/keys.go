@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	metrics "openreplay/backend/pkg/metrics/storage"
+)
+
+const defaultKeyTemplate = "{sessionID}"
+
+// Key schemes: v1 uses only the key template, v2 adds the project id and the session end timestamp in front
+// of it (v2/<projectID>/<timestamp>/<template>), so a reused session id doesn't overwrite the older session
+const (
+	keySchemeV1 = "v1"
+	keySchemeV2 = "v2"
+)
+
+// noProject replaces the project id in keys if the session's context has no project id, e.g. the lookup failed
+const noProject = "none"
+
+var keyPlaceholder = regexp.MustCompile(`\{[^{}]*\}`)
+
+// keyPlaceholders are the supported placeholders of the object key template. Project id isn't a part of the
+// SessionEnd message, {projectID} requires PROJECT_LOOKUP.
+var keyPlaceholders = map[string]bool{
+	"{projectID}": true,
+	"{sessionID}": true,
+	"{date}":      true,
+}
+
+// parseKeyTemplate validates the template of the session's objects location in the bucket
+func parseKeyTemplate(template string) (string, error) {
+	template = strings.Trim(template, "/")
+	if template == "" {
+		return defaultKeyTemplate, nil
+	}
+	for _, placeholder := range keyPlaceholder.FindAllString(template, -1) {
+		if !keyPlaceholders[placeholder] {
+			return "", fmt.Errorf("unknown placeholder %s in object key template: %s", placeholder, template)
+		}
+	}
+	if !strings.Contains(template, "{sessionID}") {
+		return "", fmt.Errorf("object key template must contain {sessionID}: %s", template)
+	}
+	return template, nil
+}
+
+const (
+	defaultDevToolsFileName = "devtools"
+	defaultDevToolsKey      = "devtools.mob"
+)
+
+// parseDevToolsNames validates the devtools file name on disk and the object key, {version} in the key is replaced
+// with the mob format version. Both are suffixes, so they must differ from DOM and canvas names, the key must also
+// not start like a DOM part key (dom.mob<suffix>) to not be read as a DOM part.
+func parseDevToolsNames(fileName, key, version string) (string, string, error) {
+	if fileName == "" {
+		fileName = defaultDevToolsFileName
+	}
+	key = strings.Trim(key, "/")
+	if key == "" {
+		key = defaultDevToolsKey
+	}
+	if strings.ContainsAny(fileName, "/") {
+		return "", "", fmt.Errorf("devtools file name must not contain a path: %s", fileName)
+	}
+	if fileName == canvasFileName {
+		return "", "", fmt.Errorf("devtools file name collides with canvas file name: %s", fileName)
+	}
+	for _, placeholder := range keyPlaceholder.FindAllString(key, -1) {
+		if placeholder != "{version}" {
+			return "", "", fmt.Errorf("unknown placeholder %s in devtools object key: %s", placeholder, key)
+		}
+	}
+	key = "/" + strings.ReplaceAll(key, "{version}", version)
+	if strings.HasPrefix(key, string(DOM)) || key == string(CANVAS) || key == manifestName {
+		return "", "", fmt.Errorf("devtools object key collides with session object keys: %s", key)
+	}
+	return fileName, key, nil
+}
+
+// keyBase returns the location of the session's objects, the session end timestamp is used for the date placeholder
+func (s *Storage) keyBase(projectID string, sessionID uint64, timestamp uint64) string {
+	if projectID == "" {
+		projectID = noProject
+	}
+	return strings.NewReplacer(
+		"{projectID}", projectID,
+		"{sessionID}", strconv.FormatUint(sessionID, 10),
+		"{date}", time.UnixMilli(int64(timestamp)).UTC().Format("2006/01/02"),
+	).Replace(s.keyTemplate)
+}
+
+// projectKeyBase returns the location of the session's objects in the configured key scheme
+func (s *Storage) projectKeyBase(projectID string, sessionID uint64, timestamp uint64) string {
+	if projectID == "" {
+		projectID = noProject
+	}
+	if s.cfg.KeyScheme != keySchemeV2 {
+		return s.keyBase(projectID, sessionID, timestamp)
+	}
+	return fmt.Sprintf("%s/%s/%d/%s", keySchemeV2, projectID, timestamp, s.keyBase(projectID, sessionID, timestamp))
+}
+
+// checkKeyCollision warns if the DOM object of the session already exists under the v1 key. In v1 scheme it means
+// that the session will be overwritten, in v2 scheme that the session id was already used before the migration.
+func (s *Storage) checkKeyCollision(task *Task, sessionID uint64, timestamp uint64) {
+	key := s.domKey(s.keyBase(projectIDOf(task.ctx), sessionID, timestamp), 0)
+	if !s.objStorage.Exists(key) {
+		return
+	}
+	metrics.IncreaseStorageKeyCollisions()
+	s.log.Warn(task.ctx, "session object %s already exists, key scheme: %s", key, s.cfg.KeyScheme)
+}
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/logger"
+	"openreplay/backend/pkg/messages"
+	"openreplay/backend/pkg/objectstorage/memory"
+)
+
+func TestKeyTemplate(t *testing.T) {
+	for _, template := range []string{"{projectID}/{sessionID}", "{date}", "{sessionID}/{unknown}"} {
+		// {projectID} requires the project lookup
+		if _, err := New(&config.Config{FSDir: t.TempDir(), FileSplitSize: 1000, MaxFileSize: 1 << 20,
+			KeyTemplate: template}, logger.New(), memory.New(), nil); err == nil {
+			t.Errorf("expected error for template %s", template)
+		}
+	}
+	s, _ := newTestStorage(t, &config.Config{KeyTemplate: "/prod/{date}/{sessionID}/"})
+	// 2024-03-05 12:00:00 UTC
+	if base := s.keyBase("", 42, 1709640000000); base != "prod/2024/03/05/42" {
+		t.Errorf("wrong key base: %s", base)
+	}
+	s, _ = newTestStorage(t, &config.Config{})
+	if base := s.keyBase("", 42, 1709640000000); base != "42" {
+		t.Errorf("wrong default key base: %s", base)
+	}
+	s, _ = newTestStorage(t, &config.Config{KeyTemplate: "{projectID}/{sessionID}", ProjectLookup: true})
+	if base := s.projectKeyBase("7", 42, 1709640000000); base != "7/42" {
+		t.Errorf("wrong project key base: %s", base)
+	}
+	if base := s.projectKeyBase("", 42, 1709640000000); base != noProject+"/42" {
+		t.Errorf("wrong key base without the project: %s", base)
+	}
+}
+
+func TestKeySchemeV2(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{KeyScheme: "v2", ProjectLookup: true, KeyCollisionCheck: true})
+	if err := os.WriteFile(s.cfg.FSDir+"/31", []byte("dom"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{Timestamp: 1700000000000}
+	msg.SetSessionID(31)
+	if err := s.Process(WithProject(context.Background(), "5", ""), msg); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	if !objStorage.Exists("v2/5/1700000000000/31" + string(DOM) + "s") {
+		t.Fatalf("wrong uploaded objects: %v", objStorage.Keys())
+	}
+	reader, err := s.DownloadProjectSession("5", 31, msg.Timestamp, "")
+	if err != nil {
+		t.Fatalf("can't download session: %s", err)
+	}
+	if res, _ := io.ReadAll(reader); string(res) != "dom" {
+		t.Errorf("wrong downloaded data: %s", res)
+	}
+	s.objStorage = &presignStorage{objStorage}
+	if urls, err := s.PresignedURLs("5", 31, msg.Timestamp, DOM, time.Minute); err != nil || len(urls) != 1 {
+		t.Errorf("can't presign session of the project: %v, %s", urls, err)
+	}
+	if res, err := s.DownloadRange("5", 31, msg.Timestamp, "", 0, 3); err != nil || string(res) != "dom" {
+		t.Errorf("wrong range of the project's session: %q, %v", res, err)
+	}
+	if err := s.Delete(context.Background(), "5", 31, msg.Timestamp); err != nil {
+		t.Fatal(err)
+	}
+	if keys := objStorage.Keys(); len(keys) != 0 {
+		t.Errorf("project's session wasn't deleted: %v", keys)
+	}
+	cfg := *s.cfg
+	cfg.KeyScheme = "v3"
+	if _, err := New(&cfg, logger.New(), objStorage, nil); err == nil {
+		t.Error("unknown key scheme should fail")
+	}
+}
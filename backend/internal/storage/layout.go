@@ -0,0 +1,145 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	layoutSplit   = "split"   // DOM parts are uploaded as separate objects: dom.mobs, dom.mobe, dom.mob2, ...
+	layoutIndexed = "indexed" // DOM parts are joined into a single dom.mob object with the index of parts in metadata
+	// domIndexMetadataKey is the object metadata key with the index of DOM parts in the indexed layout
+	domIndexMetadataKey = "dom_index"
+)
+
+// domIndexEntry describes the position of the DOM part in the indexed object and the end of the part in the whole
+// DOM file. Each part is compressed and encrypted separately, so it can be read with a ranged GET.
+type domIndexEntry struct {
+	Offset    int64
+	Size      int64
+	EndOffset int64
+}
+
+// encodeDomIndex returns the index in offset:size:end_offset,... format, it's short enough for object metadata
+func encodeDomIndex(index []domIndexEntry) string {
+	entries := make([]string, len(index))
+	for i, entry := range index {
+		entries[i] = fmt.Sprintf("%d:%d:%d", entry.Offset, entry.Size, entry.EndOffset)
+	}
+	return strings.Join(entries, ",")
+}
+
+func parseDomIndex(raw string) ([]domIndexEntry, error) {
+	var index []domIndexEntry
+	for _, item := range strings.Split(raw, ",") {
+		fields := strings.Split(item, ":")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("wrong dom index entry: %s", item)
+		}
+		var values [3]int64
+		for i, field := range fields {
+			value, err := strconv.ParseInt(field, 10, 64)
+			if err != nil || value < 0 {
+				return nil, fmt.Errorf("wrong dom index entry: %s", item)
+			}
+			values[i] = value
+		}
+		index = append(index, domIndexEntry{Offset: values[0], Size: values[1], EndOffset: values[2]})
+	}
+	return index, nil
+}
+
+// domKey returns the object key of the DOM part in the configured layout
+func (s *Storage) domKey(base string, part int) string {
+	if s.cfg.LayoutMode == layoutIndexed {
+		return s.objectKey(base, DOM)
+	}
+	return s.objectKey(base, DOM) + domPartSuffix(part)
+}
+
+// uploadIndexedDom joins packed DOM parts into a single object, positions of parts are saved in its metadata
+func (s *Storage) uploadIndexedDom(task *Task) error {
+	joined := new(bytes.Buffer)
+	index := make([]domIndexEntry, len(task.doms))
+	var (
+		endOffset int64
+		level     string
+	)
+	for i, dom := range task.doms {
+		endOffset += int64(task.domRawSizes[i])
+		index[i] = domIndexEntry{Offset: int64(joined.Len()), Size: int64(dom.Len()), EndOffset: endOffset}
+		joined.Write(dom.Bytes())
+		// Parts can be compressed with different levels in adaptive mode, the level is set only if it's the same
+		partMetadata := make(map[string]string)
+		s.setCompressionLevelMetadata(task, DOM, int64(task.domRawSizes[i]), partMetadata)
+		if i == 0 {
+			level = partMetadata[compressionLevelMetadataKey]
+		} else if level != partMetadata[compressionLevelMetadataKey] {
+			level = ""
+		}
+	}
+	metadata := map[string]string{domIndexMetadataKey: encodeDomIndex(index)}
+	if level != "" {
+		metadata[compressionLevelMetadataKey] = level
+	}
+	return s.uploadWithRetry(task, joined, s.objectKey(task.base, DOM), DOM, metadata)
+}
+
+// downloadIndexed reads DOM parts of the indexed object with ranged GETs, the object without the index is a streamed
+// DOM file uploaded as a single part
+func (s *Storage) downloadIndexed(key string, sessionID uint64, encryptionKey string) (*bytes.Buffer, error) {
+	info, err := s.objStorage.Head(key)
+	if err != nil {
+		return nil, fmt.Errorf("can't get %s info: %s", key, err)
+	}
+	if err := s.checkFormatVersion(key, info.Metadata[formatVersionMetadataKey]); err != nil {
+		return nil, err
+	}
+	enc, err := s.objectEncoding(info)
+	if err != nil {
+		return nil, err
+	}
+	id := strconv.FormatUint(sessionID, 10)
+	rawIndex, ok := info.Metadata[domIndexMetadataKey]
+	if !ok {
+		part, err := s.downloadPart(id, key, encryptionKey, enc)
+		if err != nil {
+			return nil, fmt.Errorf("can't download %s: %s", key, err)
+		}
+		return bytes.NewBuffer(part), nil
+	}
+	index, err := parseDomIndex(rawIndex)
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]io.Reader, len(index))
+	endOffsets := make([]int64, len(index))
+	for i, entry := range index {
+		data, err := s.getRange(key, entry.Offset, entry.Size)
+		if err != nil {
+			return nil, fmt.Errorf("can't download part %d of %s: %s", i, key, err)
+		}
+		part, err := s.decodePart(id, data, encryptionKey, enc)
+		if err != nil {
+			return nil, fmt.Errorf("can't decode part %d of %s: %s", i, key, err)
+		}
+		parts[i], endOffsets[i] = bytes.NewReader(part), entry.EndOffset
+	}
+	mob := new(bytes.Buffer)
+	if _, err := io.Copy(mob, Reassemble(endOffsets, parts...)); err != nil {
+		return nil, fmt.Errorf("can't reassemble dom file: %s", err)
+	}
+	return mob, nil
+}
+
+func (s *Storage) getRange(key string, offset, size int64) ([]byte, error) {
+	reader, err := s.objStorage.GetRange(key, offset, size)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
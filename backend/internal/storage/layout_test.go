@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+)
+
+func TestIndexedLayout(t *testing.T) {
+	for _, manifest := range []bool{false, true} {
+		s, objStorage := newTestStorage(t, &config.Config{CompressionAlgo: "gzip", LayoutMode: layoutIndexed,
+			WriteManifest: manifest})
+		raw := [][]byte{bytes.Repeat([]byte("dom start "), 100), bytes.Repeat([]byte("dom end "), 50)}
+		task := &Task{ctx: context.Background(), id: "40", base: "40", compression: s.compression}
+		for _, part := range raw {
+			packed, err := s.compress(part, s.compression)
+			if err != nil {
+				t.Fatal(err)
+			}
+			task.doms = append(task.doms, packed)
+			task.domRawSizes = append(task.domRawSizes, float64(len(part)))
+		}
+		if err := s.uploadParts(task); err != nil {
+			t.Fatal(err)
+		}
+		if manifest {
+			if err := s.uploadManifest(task); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !objStorage.Exists("40"+string(DOM)) || objStorage.Exists("40"+string(DOM)+"s") {
+			t.Fatalf("dom parts should be uploaded as a single object: %v", objStorage.Keys())
+		}
+		reader, err := s.Download(40, 0, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res, _ := io.ReadAll(reader); !bytes.Equal(res, bytes.Join(raw, nil)) {
+			t.Errorf("downloaded data mismatch, manifest: %t", manifest)
+		}
+	}
+	if _, err := parseDomIndex("0:10"); err == nil {
+		t.Error("wrong index entry should fail")
+	}
+}
@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+)
+
+// sessionObjects locates the uploaded session: the manifest if it was written, otherwise DOM objects found in
+// the bucket in either layout, so sessions are read regardless of the layout they were uploaded with
+type sessionObjects struct {
+	base     string
+	manifest *sessionManifest
+	indexed  bool     // DOM parts are stored in the single indexed object, domKeys has only its key
+	domKeys  []string // DOM objects in playback order, found only if the session has no manifest
+	batched  bool     // parts are stored in the batch object shared with other sessions
+}
+
+// errBatched is returned for operations which would modify or expose the batch object of other sessions
+var errBatched = errors.New("session is stored in the batch object")
+
+// locateSession finds objects of the session, the project id is used by the v2 key scheme only. The manifest
+// download error is returned with the base set, so callers can fall back to findDomKeys.
+func (s *Storage) locateSession(projectID string, sessionID, timestamp uint64) (*sessionObjects, error) {
+	loc := &sessionObjects{base: s.projectKeyBase(projectID, sessionID, timestamp)}
+	manifest, err := s.downloadManifest(loc.base)
+	if err != nil {
+		return loc, fmt.Errorf("can't download manifest: %s", err)
+	}
+	if manifest != nil {
+		loc.manifest = manifest
+		for _, part := range manifest.Parts {
+			loc.batched = loc.batched || part.Batch
+		}
+		return loc, nil
+	}
+	s.findDomKeys(loc)
+	return loc, nil
+}
+
+// findDomKeys looks for the indexed DOM object or DOM parts, the first part is always returned to report
+// the missing session on read
+func (s *Storage) findDomKeys(loc *sessionObjects) {
+	if key := s.objectKey(loc.base, DOM); s.objStorage.Exists(key) {
+		loc.indexed, loc.domKeys = true, []string{key}
+		return
+	}
+	loc.domKeys = []string{s.objectKey(loc.base, DOM) + domPartSuffix(0)}
+	for part := 1; ; part++ {
+		key := s.objectKey(loc.base, DOM) + domPartSuffix(part)
+		if !s.objStorage.Exists(key) {
+			break
+		}
+		loc.domKeys = append(loc.domKeys, key)
+	}
+}
+
+// sessionKeys returns keys of the session's objects of the file type, DOM parts of the indexed object share the key
+// which is returned once
+func (s *Storage) sessionKeys(loc *sessionObjects, tp FileType) []string {
+	if tp != DOM {
+		return []string{s.objectKey(loc.base, tp)}
+	}
+	if loc.manifest == nil {
+		return loc.domKeys
+	}
+	var keys []string
+	seen := make(map[string]bool)
+	for _, part := range loc.manifest.Parts {
+		if part.FileType == DOM.String() && !seen[part.Key] {
+			seen[part.Key] = true
+			keys = append(keys, part.Key)
+		}
+	}
+	return keys
+}
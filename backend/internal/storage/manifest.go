@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"openreplay/backend/pkg/objectstorage"
+)
+
+const manifestName = "/manifest.json"
+
+// sessionManifest describes the uploaded session objects, it's stored as <base>/manifest.json if WriteManifest is set
+type sessionManifest struct {
+	SessionID   string         `json:"session_id"`
+	Parts       []manifestPart `json:"parts"`
+	Compression string         `json:"compression"`
+	Encryption  string         `json:"encryption"` // empty for not encrypted sessions
+	KeyID       string         `json:"key_id,omitempty"`
+	Version     string         `json:"format_version,omitempty"`
+	SplitOffset int64          `json:"split_offset"`
+	SessionEnd  uint64         `json:"session_end"` // session end timestamp in milliseconds
+	ProcessedAt time.Time      `json:"processed_at"`
+	UploadedAt  time.Time      `json:"uploaded_at"`
+}
+
+// manifestPart describes one uploaded object, size and checksum are unknown for DOM files streamed from disk
+type manifestPart struct {
+	Key         string `json:"key"`
+	FileType    string `json:"file_type"`
+	Size        int64  `json:"size,omitempty"`
+	RawSize     int64  `json:"raw_size,omitempty"`
+	Checksum    string `json:"checksum,omitempty"`
+	Compression string `json:"compression"`
+	EndOffset   int64  `json:"end_offset,omitempty"` // end of the DOM part in the whole DOM file
+	Offset      int64  `json:"offset,omitempty"`     // position of the DOM part in the indexed object
+	Indexed     bool   `json:"indexed,omitempty"`    // the part is read from the indexed object by offset and size
+	Store       string `json:"store,omitempty"`      // cold for DOM parts in COLD_BUCKET_NAME, empty for the primary bucket
+	Batch       bool   `json:"batch,omitempty"`      // the part is stored in the batch tar object shared with other sessions
+	Unsorted    bool   `json:"unsorted,omitempty"`   // the DOM file was streamed as is, without sorting and splitting
+}
+
+func (s *Storage) newManifest(task *Task) *sessionManifest {
+	manifest := &sessionManifest{
+		SessionID:   task.id,
+		Compression: task.compression.String(),
+		Version:     s.formatVersion,
+		SessionEnd:  task.timestamp,
+		ProcessedAt: task.startedAt,
+		UploadedAt:  time.Now(),
+	}
+	if task.encrypted() {
+		manifest.KeyID = encryptionKeyID(task.key)
+		manifest.Encryption = s.encryptionOf(task)
+	}
+	addPart := func(key string, tp FileType, buf *bytes.Buffer, rawSize, endOffset int64) {
+		part := manifestPart{
+			Key:         key,
+			FileType:    tp.String(),
+			RawSize:     rawSize,
+			Compression: task.compressionOf(tp).String(),
+			EndOffset:   endOffset,
+		}
+		if s.cold != nil && isColdKey(key) {
+			part.Store = coldStore
+		}
+		if buf != nil {
+			part.Size = int64(buf.Len())
+			part.Checksum = checksum(buf.Bytes())
+		}
+		manifest.Parts = append(manifest.Parts, part)
+	}
+	var offset, indexedOffset int64
+	for i, dom := range task.doms {
+		offset += int64(task.domRawSizes[i])
+		if i == 0 && len(task.doms) > 1 {
+			manifest.SplitOffset = offset
+		}
+		addPart(s.domKey(task.base, i), DOM, dom, int64(task.domRawSizes[i]), offset)
+		if s.cfg.LayoutMode == layoutIndexed {
+			part := &manifest.Parts[len(manifest.Parts)-1]
+			part.Offset, part.Indexed = indexedOffset, true
+			indexedOffset += int64(dom.Len())
+		}
+	}
+	if task.domPath != "" {
+		addPart(s.domKey(task.base, 0), DOM, nil, 0, 0)
+		manifest.Parts[len(manifest.Parts)-1].Unsorted = true
+	}
+	if task.dev != nil {
+		addPart(s.objectKey(task.base, DEV), DEV, task.dev, int64(task.devRawSize), 0)
+	}
+	if task.canvas != nil {
+		addPart(s.objectKey(task.base, CANVAS), CANVAS, task.canvas, int64(task.canvasRawSize), 0)
+	}
+	return manifest
+}
+
+// uploadManifest uploads the session manifest, it should be called after all session files are uploaded
+func (s *Storage) uploadManifest(task *Task) error {
+	return s.putManifest(task, s.newManifest(task))
+}
+
+func (s *Storage) putManifest(task *Task, manifest *sessionManifest) error {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("can't marshal manifest: %s", err)
+	}
+	key := task.base + manifestName
+	return s.withRetry(task, key, DOM, func(ctx context.Context) error {
+		opts := &objectstorage.UploadOptions{Metadata: task.metadata, ACL: s.acl, Tags: s.objectTags(task), Context: ctx}
+		return s.objStorage.UploadWithOptions(bytes.NewReader(data), key, "application/json", objectstorage.NoCompression, opts)
+	})
+}
+
+// downloadManifest returns the session manifest or nil if the session was uploaded without it
+func (s *Storage) downloadManifest(base string) (*sessionManifest, error) {
+	key := base + manifestName
+	if !s.objStorage.Exists(key) {
+		return nil, nil
+	}
+	reader, err := s.objStorage.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	manifest := &sessionManifest{}
+	if err := json.Unmarshal(data, manifest); err != nil {
+		return nil, fmt.Errorf("can't parse manifest: %s", err)
+	}
+	return manifest, nil
+}
+
+// downloadFromManifest joins DOM parts listed in the manifest, each part is checked, decrypted and decompressed
+// with the settings it was uploaded with. Part sizes are validated if their offsets are known (not streamed files).
+func (s *Storage) downloadFromManifest(manifest *sessionManifest, sessionID uint64, encryptionKey string) (*bytes.Buffer, error) {
+	if err := s.checkFormatVersion("manifest", manifest.Version); err != nil {
+		return nil, err
+	}
+	var (
+		parts      []io.Reader
+		endOffsets []int64
+		streamed   bool
+	)
+	for _, part := range manifest.Parts {
+		if part.FileType != DOM.String() {
+			continue
+		}
+		compression, err := objectstorage.ParseCompressionType(part.Compression)
+		if err != nil {
+			return nil, err
+		}
+		var data []byte
+		if part.Indexed {
+			data, err = s.getRange(part.Key, part.Offset, part.Size)
+		} else {
+			var objStorage objectstorage.ObjectStorage
+			if objStorage, err = s.manifestStore(part); err == nil {
+				data, err = s.readObject(objStorage, part.Key)
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can't download %s: %s", part.Key, err)
+		}
+		if part.Checksum != "" && checksum(data) != part.Checksum {
+			return nil, fmt.Errorf("checksum mismatch of %s", part.Key)
+		}
+		if encryptionKey != "" && manifest.Encryption != "" {
+			if data, err = s.decrypt(manifest.Encryption, strconv.FormatUint(sessionID, 10), data, encryptionKey); err != nil {
+				return nil, fmt.Errorf("can't decrypt %s: %s", part.Key, err)
+			}
+		}
+		if data, err = s.decompress(data, compression); err != nil {
+			return nil, fmt.Errorf("can't decompress %s: %s", part.Key, err)
+		}
+		parts = append(parts, bytes.NewReader(data))
+		endOffsets = append(endOffsets, part.EndOffset)
+		streamed = streamed || part.Checksum == ""
+	}
+	mob := new(bytes.Buffer)
+	if !streamed {
+		if _, err := io.Copy(mob, Reassemble(endOffsets, parts...)); err != nil {
+			return nil, fmt.Errorf("can't reassemble dom file: %s", err)
+		}
+		return mob, nil
+	}
+	for _, part := range parts {
+		io.Copy(mob, part)
+	}
+	return mob, nil
+}
@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/messages"
+	"openreplay/backend/pkg/objectstorage"
+)
+
+func TestSessionManifest(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{CompressionAlgo: "gzip", WriteManifest: true})
+	dom := bytes.Repeat([]byte("dom"), 100)
+	if err := os.WriteFile(s.cfg.FSDir+"/23", dom, 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{Timestamp: 1700000000000}
+	msg.SetSessionID(23)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	obj, ok := objStorage.Object("23" + manifestName)
+	if !ok {
+		t.Fatal("manifest wasn't uploaded")
+	}
+	manifest := &sessionManifest{}
+	if err := json.Unmarshal(obj.Data, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Parts) != 1 || manifest.Compression != "gzip" || manifest.Encryption != "" || manifest.SessionEnd != msg.Timestamp {
+		t.Fatalf("wrong manifest: %+v", manifest)
+	}
+	// Compression is taken from the manifest instead of the config
+	s.compression = objectstorage.NoCompression
+	reader, err := s.Download(23, msg.Timestamp, "")
+	if err != nil {
+		t.Fatalf("can't download session: %s", err)
+	}
+	if res, _ := io.ReadAll(reader); !bytes.Equal(res, dom) {
+		t.Error("downloaded data mismatch")
+	}
+}
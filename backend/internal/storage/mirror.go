@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	config "openreplay/backend/internal/config/storage"
+	metrics "openreplay/backend/pkg/metrics/storage"
+	"openreplay/backend/pkg/objectstorage"
+	"openreplay/backend/pkg/objectstorage/store"
+)
+
+const mirrorPool = "mirror"
+
+// newMirror returns the secondary object storage for uploaded sessions or nil if mirroring is disabled
+func newMirror(cfg *config.Config) (objectstorage.ObjectStorage, error) {
+	if cfg.MirrorBucketName == "" {
+		return nil, nil
+	}
+	mirrorCfg := cfg.ObjectsConfig
+	mirrorCfg.BucketName = cfg.MirrorBucketName
+	if cfg.MirrorRegion != "" {
+		mirrorCfg.AWSRegion = cfg.MirrorRegion
+	}
+	objStorage, err := store.NewStore(&mirrorCfg)
+	if err != nil {
+		return nil, fmt.Errorf("can't init mirror object storage: %s", err)
+	}
+	return objStorage, nil
+}
+
+// mirrorSession copies already uploaded session files to the mirror storage. Failures are only logged and counted,
+// the session is already stored in the primary storage. Streamed DOM files and manifests are copied from the primary
+// storage, other files are uploaded from the task's buffers.
+func (s *Storage) mirrorSession(task *Task) {
+	if s.cfg.LayoutMode == layoutIndexed && len(task.doms) > 0 {
+		s.mirrorObject(task, s.domKey(task.base, 0), DOM, nil)
+	} else {
+		for i, dom := range task.doms {
+			s.mirrorObject(task, s.domKey(task.base, i), DOM, dom)
+		}
+	}
+	if task.domPath != "" {
+		s.mirrorObject(task, s.domKey(task.base, 0), DOM, nil)
+	}
+	if task.dev != nil {
+		s.mirrorObject(task, s.objectKey(task.base, DEV), DEV, task.dev)
+	}
+	if task.canvas != nil {
+		s.mirrorObject(task, s.objectKey(task.base, CANVAS), CANVAS, task.canvas)
+	}
+	if s.cfg.WriteManifest {
+		s.mirrorObject(task, task.base+manifestName, "", nil)
+	}
+}
+
+// mirrorObject uploads the buffer or the copy of the primary object if the buffer is nil
+func (s *Storage) mirrorObject(task *Task, key string, tp FileType, data *bytes.Buffer) {
+	if err := s.uploadMirror(task, key, tp, data); err != nil {
+		label := "manifest"
+		if tp != "" {
+			label = tp.String()
+		}
+		metrics.IncreaseStorageMirrorFailures(label)
+		s.log.Warn(task.ctx, "can't mirror %s: %s", key, err)
+	}
+}
+
+// uploadMirror uploads the object to the mirror storage with MirrorMaxRetries retries, tp is empty for the manifest
+func (s *Storage) uploadMirror(task *Task, key string, tp FileType, data *bytes.Buffer) error {
+	contentType, compression := "application/json", objectstorage.NoCompression
+	opts := &objectstorage.UploadOptions{Metadata: make(map[string]string), ACL: s.acl, Tags: s.objectTags(task)}
+	if tp != "" {
+		contentType, compression = s.contentType[tp], task.compressionOf(tp)
+		opts.StorageClass = s.storageClass[tp]
+		opts.Metadata[compressionMetadataKey] = compression.String()
+		s.setDictionaryMetadata(task, tp, opts.Metadata)
+	}
+	for k, v := range task.metadata {
+		opts.Metadata[k] = v
+	}
+	upload := func() error {
+		if data != nil {
+			return s.mirror.UploadWithOptions(bytes.NewReader(data.Bytes()), key, contentType, compression, opts)
+		}
+		// Metadata of the primary object is kept, for example the index of the indexed DOM object
+		if info, err := s.objStorage.Head(key); err == nil {
+			for k, v := range info.Metadata {
+				opts.Metadata[k] = v
+			}
+			if stored, err := objectstorage.ParseCompressionType(info.Metadata[compressionMetadataKey]); err == nil {
+				compression = stored
+			}
+		}
+		primary, err := s.objStorage.Get(key)
+		if err != nil {
+			return fmt.Errorf("can't read primary object: %s", err)
+		}
+		defer primary.Close()
+		return s.mirror.UploadWithOptions(primary, key, contentType, compression, opts)
+	}
+	var err error
+	for attempt := 0; attempt <= s.cfg.MirrorMaxRetries; attempt++ {
+		if attempt > 0 {
+			time.Sleep(s.retryDelay(attempt))
+		}
+		if err = upload(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// mirrorUploaded mirrors the uploaded session in the background if async mirroring is enabled, buffers are
+// released once the session is mirrored
+func (s *Storage) mirrorUploaded(payload interface{}) {
+	task := payload.(*Task)
+	s.mirrorSession(task)
+	s.releaseBuffers(task)
+}
@@ -0,0 +1,88 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/messages"
+	"openreplay/backend/pkg/objectstorage/memory"
+	"openreplay/backend/pkg/pool"
+)
+
+func TestMirrorQueueFull(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{})
+	mirror := memory.New()
+	s.mirror = mirror
+	started, release := make(chan struct{}), make(chan struct{})
+	s.mirrorPool = pool.NewPool(1, 0, s.recoverWorker(mirrorPool, func(payload interface{}) {
+		close(started)
+		<-release
+		// The mirror worker survives the panic
+		var buf *bytes.Buffer
+		buf.Reset()
+	}))
+	s.mirrorPool.Submit(&Task{ctx: context.Background(), id: "busy"})
+	<-started
+	if err := os.WriteFile(s.cfg.FSDir+"/33", []byte("dom"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(33)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	// Uploader isn't blocked by the busy mirror worker
+	s.processorPool.Pause()
+	s.uploaderPool.Pause()
+	if !objStorage.Exists("33" + string(DOM) + "s") {
+		t.Error("session wasn't uploaded")
+	}
+	if mirror.Exists("33" + string(DOM) + "s") {
+		t.Error("session should be dropped from the full mirror queue")
+	}
+	close(release)
+	s.mirrorPool.Pause()
+}
+
+func TestMirror(t *testing.T) {
+	for _, async := range []bool{false, true} {
+		s, _ := newTestStorage(t, &config.Config{})
+		mirror := memory.New()
+		s.mirror = mirror
+		if async {
+			s.mirrorPool = pool.NewPool(1, 1, s.mirrorUploaded)
+		}
+		if err := os.WriteFile(s.cfg.FSDir+"/29", []byte("dom"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		msg := &messages.SessionEnd{}
+		msg.SetSessionID(29)
+		if err := s.Process(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+		s.Wait()
+		if !mirror.Exists("29" + string(DOM) + "s") {
+			t.Errorf("dom file wasn't mirrored, async: %t", async)
+		}
+	}
+	s, objStorage := newTestStorage(t, &config.Config{})
+	mirror := memory.New()
+	mirror.SetError(errors.New("mirror is unavailable"))
+	s.mirror = mirror
+	if err := os.WriteFile(s.cfg.FSDir+"/30", []byte("dom"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(30)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	if !objStorage.Exists("30" + string(DOM) + "s") {
+		t.Error("mirror failure shouldn't affect the primary upload")
+	}
+}
@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"context"
+	"runtime/debug"
+	"strconv"
+
+	metrics "openreplay/backend/pkg/metrics/storage"
+)
+
+// UploadedCallback is called for every stored session with the keys of its objects: DOM parts in playback order,
+// devtools, canvas and the manifest if it's written, so callers can index sessions stored with templated keys and
+// any number of DOM parts. Uploads are asynchronous, it's the only way to get the keys. Callbacks run one by one in
+// a separate goroutine, so the order of sessions isn't guaranteed relative to the uploads: sessions are uploaded by
+// several workers and the callback of a later session can be called first. A panic in the callback is logged.
+type UploadedCallback func(sessionID uint64, keys []string)
+
+type uploadedEvent struct {
+	ctx       context.Context
+	sessionID uint64
+	keys      []string
+}
+
+// uploadNotifier calls the callback for uploaded sessions without blocking uploaders, events are dropped if
+// the queue is full because of the slow callback
+type uploadNotifier struct {
+	s        *Storage
+	callback UploadedCallback
+	events   chan uploadedEvent
+	done     chan struct{}
+}
+
+// SetOnUploaded sets the callback for stored sessions, it should be called before the first Process call.
+// Batched sessions are reported with their original keys, the objects are stored inside the batch.
+func (s *Storage) SetOnUploaded(callback UploadedCallback) {
+	capacity := s.cfg.UploadedQueueCapacity
+	if capacity <= 0 {
+		capacity = 1
+	}
+	n := &uploadNotifier{
+		s:        s,
+		callback: callback,
+		events:   make(chan uploadedEvent, capacity),
+		done:     make(chan struct{}),
+	}
+	go n.run()
+	s.notifier = n
+}
+
+func (n *uploadNotifier) notify(task *Task) {
+	sessionID, err := strconv.ParseUint(task.id, 10, 64)
+	if err != nil {
+		n.s.log.Warn(task.ctx, "can't parse session id for the uploaded callback: %s", err)
+		return
+	}
+	select {
+	case n.events <- uploadedEvent{ctx: task.ctx, sessionID: sessionID, keys: n.s.uploadedKeys(task)}:
+	default:
+		metrics.IncreaseStorageUploadedCallbacksDropped()
+		n.s.log.Warn(task.ctx, "uploaded callback queue is full, session is skipped")
+	}
+}
+
+func (n *uploadNotifier) run() {
+	defer close(n.done)
+	for event := range n.events {
+		n.call(event)
+	}
+}
+
+func (n *uploadNotifier) call(event uploadedEvent) {
+	defer func() {
+		if r := recover(); r != nil {
+			n.s.log.Error(event.ctx, "uploaded callback panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	n.callback(event.sessionID, event.keys)
+}
+
+// stop waits for the queued callbacks, it should be called after all sessions are uploaded
+func (n *uploadNotifier) stop() {
+	close(n.events)
+	<-n.done
+}
+
+// uploadedKeys returns the keys of all uploaded session objects, DOM parts go first in playback order
+func (s *Storage) uploadedKeys(task *Task) []string {
+	var keys []string
+	for i := range task.doms {
+		if key := s.domKey(task.base, i); i == 0 || key != keys[len(keys)-1] {
+			keys = append(keys, key)
+		}
+	}
+	if task.domPath != "" {
+		keys = append(keys, s.domKey(task.base, 0))
+	}
+	if task.dev != nil {
+		keys = append(keys, s.objectKey(task.base, DEV))
+	}
+	if task.canvas != nil {
+		keys = append(keys, s.objectKey(task.base, CANVAS))
+	}
+	if s.cfg.WriteManifest {
+		keys = append(keys, task.base+manifestName)
+	}
+	return keys
+}
@@ -0,0 +1,52 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/messages"
+)
+
+func TestOnUploaded(t *testing.T) {
+	s, _ := newTestStorage(t, &config.Config{UploadedQueueCapacity: 10})
+	var (
+		mu       sync.Mutex
+		uploaded = make(map[uint64][]string)
+	)
+	s.SetOnUploaded(func(sessionID uint64, keys []string) {
+		mu.Lock()
+		uploaded[sessionID] = keys
+		mu.Unlock()
+		if sessionID == 43 {
+			panic("callback failed")
+		}
+	})
+	for _, id := range []uint64{43, 44} {
+		path := s.cfg.FSDir + "/" + strconv.FormatUint(id, 10)
+		if err := os.WriteFile(path, []byte("dom"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(s.localPath(path, DEV), []byte("devtools"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		msg := &messages.SessionEnd{}
+		msg.SetSessionID(id)
+		if err := s.Process(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if keys := strings.Join(uploaded[44], ","); keys != "44/dom.mobs,44/devtools.mob" {
+		t.Errorf("wrong uploaded keys: %s", keys)
+	}
+	if len(uploaded) != 2 {
+		t.Errorf("callback panic shouldn't stop other callbacks: %v", uploaded)
+	}
+}
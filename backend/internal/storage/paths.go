@@ -0,0 +1,28 @@
+package storage
+
+import "strconv"
+
+// PathResolver returns the local path of the session file, it allows to read session files from the capture node's
+// own directory layout, e.g. sharded by project. The project id is looked up in the sessions table, resolvers that
+// depend on it require PROJECT_LOOKUP, otherwise it is always empty.
+type PathResolver interface {
+	Path(projectID string, sessionID uint64, tp FileType) string
+}
+
+// defaultPathResolver keeps session files in FS_DIR named by the session id with the file type suffix
+type defaultPathResolver struct {
+	s *Storage
+}
+
+func (r *defaultPathResolver) Path(projectID string, sessionID uint64, tp FileType) string {
+	return r.s.localPath(r.s.cfg.FSDir+"/"+strconv.FormatUint(sessionID, 10), tp)
+}
+
+// sessionPaths resolves local paths of all session files
+func (s *Storage) sessionPaths(projectID string, sessionID uint64) map[FileType]string {
+	paths := make(map[FileType]string, len(fileTypes))
+	for _, tp := range fileTypes {
+		paths[tp] = s.paths.Path(projectID, sessionID, tp)
+	}
+	return paths
+}
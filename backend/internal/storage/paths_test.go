@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/logger"
+	"openreplay/backend/pkg/messages"
+	"openreplay/backend/pkg/objectstorage/memory"
+)
+
+// shardedResolver keeps session files in <dir>/<projectID>/<sessionID>/<file type>.mob
+type shardedResolver struct {
+	dir string
+}
+
+func (r *shardedResolver) Path(projectID string, sessionID uint64, tp FileType) string {
+	return filepath.Join(r.dir, projectID, strconv.FormatUint(sessionID, 10), tp.String()+".mob")
+}
+
+func TestPathResolver(t *testing.T) {
+	resolver := &shardedResolver{dir: t.TempDir()}
+	if err := os.MkdirAll(filepath.Join(resolver.dir, "7", "47"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for tp, data := range map[FileType]string{DOM: "dom file", DEV: "devtools file"} {
+		if err := os.WriteFile(resolver.Path("7", 47, tp), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	objStorage := memory.New()
+	s, err := New(&config.Config{FSDir: t.TempDir(), FileSplitSize: 1000, MaxFileSize: 1 << 20, Workers: 1,
+		CompressionAlgo: "none", SampleRate: 1, ProcessDevTools: true, DeleteAfterUpload: true, ProjectLookup: true},
+		logger.New(), objStorage, resolver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(47)
+	if err := s.Process(WithProject(context.Background(), "7", ""), msg); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	for key, expected := range map[string]string{"47/dom.mobs": "dom file", "47/devtools.mob": "devtools file"} {
+		if data, err := s.getObject(key); err != nil || string(data) != expected {
+			t.Errorf("wrong %s: %q, err: %v, keys: %v", key, data, err, objStorage.Keys())
+		}
+	}
+	for _, tp := range []FileType{DOM, DEV} {
+		if _, err := os.Stat(resolver.Path("7", 47, tp)); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s file should be deleted after upload, err: %v", tp.String(), err)
+		}
+	}
+	s, _ = newTestStorage(t, &config.Config{})
+	if path := s.paths.Path("7", 47, DEV); path != s.cfg.FSDir+"/47devtools" {
+		t.Errorf("wrong default devtools path: %s", path)
+	}
+}
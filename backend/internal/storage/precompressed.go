@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"bytes"
+
+	"openreplay/backend/pkg/objectstorage"
+)
+
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// isGzip checks the gzip magic bytes of session files which were already compressed by the tracker
+func isGzip(data []byte) bool {
+	return bytes.HasPrefix(data, gzipMagic)
+}
+
+func (t *Task) setPrecompressed(tp FileType) {
+	switch tp {
+	case DOM:
+		t.domPrecompressed = true
+	case CANVAS:
+		t.canvasPrecompressed = true
+	default:
+		t.devPrecompressed = true
+	}
+}
+
+func (t *Task) isPrecompressed(tp FileType) bool {
+	switch tp {
+	case DOM:
+		return t.domPrecompressed
+	case CANVAS:
+		return t.canvasPrecompressed
+	default:
+		return t.devPrecompressed
+	}
+}
+
+// compressionOf returns the compression of the uploaded file, already compressed files are uploaded as is
+func (t *Task) compressionOf(tp FileType) objectstorage.CompressionType {
+	if t.isPrecompressed(tp) {
+		return objectstorage.Gzip
+	}
+	if compression, ok := t.compressions[tp]; ok {
+		return compression
+	}
+	return t.compression
+}
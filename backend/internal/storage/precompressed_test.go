@@ -0,0 +1,41 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	gzip "github.com/klauspost/pgzip"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/messages"
+	"openreplay/backend/pkg/objectstorage"
+)
+
+func TestDetectPrecompressed(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{CompressionAlgo: "zstd", DetectPrecompressed: true, UseSort: true})
+	gzipped := new(bytes.Buffer)
+	gw := gzip.NewWriter(gzipped)
+	gw.Write(bytes.Repeat([]byte("dom"), 100))
+	gw.Close()
+	if err := os.WriteFile(s.cfg.FSDir+"/17", gzipped.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.cfg.FSDir+"/17devtools", []byte("devtools"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(17)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	dom, ok := objStorage.Object("17" + string(DOM) + "s")
+	if !ok || !bytes.Equal(dom.Data, gzipped.Bytes()) || dom.Compression != objectstorage.Gzip {
+		t.Error("gzipped dom file wasn't uploaded as is")
+	}
+	if dev, ok := objStorage.Object("17" + string(DEV)); !ok || dev.Compression != objectstorage.Zstd {
+		t.Error("devtools file wasn't compressed")
+	}
+}
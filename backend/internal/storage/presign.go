@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"openreplay/backend/pkg/objectstorage"
+)
+
+// PresignedURLs returns time-limited GET urls of the session file objects in playback order, DOM files can have
+// several parts. Urls set the content encoding of the stored compression, so browsers decompress gzip and brotli
+// files on the fly. Objects are located the same way as in DownloadProjectSession, the project id is used by the v2
+// key scheme only. Backends without pre-signed urls and sessions uploaded with BATCH_UPLOADS return an error.
+func (s *Storage) PresignedURLs(projectID string, sessionID uint64, timestamp uint64, tp FileType, ttl time.Duration) ([]string, error) {
+	loc, err := s.locateSession(projectID, sessionID, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	if loc.batched {
+		return nil, errBatched
+	}
+	keys := s.sessionKeys(loc, tp)
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("session %d has no %s objects", sessionID, tp.String())
+	}
+	urls := make([]string, 0, len(keys))
+	for _, key := range keys {
+		info, err := s.objStorage.Head(key)
+		if err != nil {
+			return nil, fmt.Errorf("can't get %s info: %s", key, err)
+		}
+		// Joined parts can't be decompressed by the browser as a single file
+		if strings.Contains(info.Metadata[domIndexMetadataKey], ",") {
+			return nil, fmt.Errorf("dom file of %d has several parts in the indexed layout, use Download", sessionID)
+		}
+		// Compression metadata of the deduplicated object is stored with the object, not with its pointer
+		if target, ok := info.Metadata[dedupMetadataKey]; ok {
+			key = target
+			if info, err = s.objStorage.Head(key); err != nil {
+				return nil, fmt.Errorf("can't get %s info: %s", key, err)
+			}
+		}
+		// Compression of the object can differ from the current config, for example for precompressed files
+		compression := s.compressionFor(tp)
+		if stored, err := objectstorage.ParseCompressionType(info.Metadata[compressionMetadataKey]); err == nil {
+			compression = stored
+		}
+		url, err := s.objStorage.GetPreSignedDownloadUrl(key, ttl, compression.ContentEncoding())
+		if err != nil {
+			return nil, fmt.Errorf("can't presign %s: %s", key, err)
+		}
+		urls = append(urls, url)
+	}
+	return urls, nil
+}
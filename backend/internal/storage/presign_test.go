@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/messages"
+	"openreplay/backend/pkg/objectstorage/memory"
+)
+
+// presignStorage returns the key and the content encoding instead of the pre-signed url
+type presignStorage struct {
+	*memory.Storage
+}
+
+func (p *presignStorage) GetPreSignedDownloadUrl(key string, ttl time.Duration, contentEncoding string) (string, error) {
+	return key + "?encoding=" + contentEncoding, nil
+}
+
+func TestPresignedURLs(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{CompressionAlgo: "gzip"})
+	if err := os.WriteFile(s.cfg.FSDir+"/32", []byte("dom"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(32)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	s.objStorage = &presignStorage{objStorage}
+	urls, err := s.PresignedURLs("", 32, 0, DOM, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 1 || urls[0] != "32"+string(DOM)+"s?encoding=gzip" {
+		t.Errorf("wrong urls: %v", urls)
+	}
+	if _, err := s.PresignedURLs("", 32, 0, DEV, time.Minute); err == nil {
+		t.Error("missing devtools file should fail")
+	}
+}
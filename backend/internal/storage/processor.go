@@ -0,0 +1,40 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+)
+
+// Processor is a custom step (scrubbing, sampling, tagging) which runs for every session after compression and
+// before upload. An error fails the session upload.
+type Processor interface {
+	Process(task *Task) error
+}
+
+// ID returns the session id
+func (t *Task) ID() string {
+	return t.id
+}
+
+// Context returns the session's context, project id is available by "projectID" key if it was set by the caller
+func (t *Task) Context() context.Context {
+	return t.ctx
+}
+
+// SetMetadata adds metadata to all session objects, key should contain only lowercase letters, digits and underscores
+func (t *Task) SetMetadata(key, value string) {
+	if t.metadata == nil {
+		t.metadata = make(map[string]string)
+	}
+	t.metadata[key] = value
+}
+
+// runProcessors runs all processors in the order they were passed to New and stops on the first error
+func (s *Storage) runProcessors(task *Task) error {
+	for i, processor := range s.processors {
+		if err := processor.Process(task); err != nil {
+			return fmt.Errorf("processor %d failed: %s", i, err)
+		}
+	}
+	return nil
+}
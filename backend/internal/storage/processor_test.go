@@ -0,0 +1,63 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/logger"
+	"openreplay/backend/pkg/messages"
+	"openreplay/backend/pkg/objectstorage/memory"
+)
+
+type testProcessor func(task *Task) error
+
+func (p testProcessor) Process(task *Task) error {
+	return p(task)
+}
+
+func TestProcessors(t *testing.T) {
+	var calls []string
+	tagger := testProcessor(func(task *Task) error {
+		calls = append(calls, "tagger")
+		task.SetMetadata("tenant", "t"+task.ID())
+		return nil
+	})
+	sampler := testProcessor(func(task *Task) error {
+		calls = append(calls, "sampler")
+		if task.ID() == "15" {
+			return errors.New("session is not sampled")
+		}
+		return nil
+	})
+	objStorage := memory.New()
+	s, err := New(&config.Config{FSDir: t.TempDir(), FileSplitSize: 1000, MaxFileSize: 1 << 20, Workers: 1,
+		CompressionAlgo: "none"}, logger.New(), objStorage, nil, tagger, sampler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []uint64{14, 15} {
+		if err := os.WriteFile(fmt.Sprintf("%s/%d", s.cfg.FSDir, id), []byte("dom"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		msg := &messages.SessionEnd{}
+		msg.SetSessionID(id)
+		if err := s.Process(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+		s.Wait()
+	}
+	if strings.Join(calls, ",") != "tagger,sampler,tagger,sampler" {
+		t.Errorf("wrong processors order: %v", calls)
+	}
+	if objectMetadata(objStorage, "14"+string(DOM)+"s")["tenant"] != "t14" {
+		t.Error("processor metadata wasn't saved")
+	}
+	if objStorage.Exists("15" + string(DOM) + "s") {
+		t.Error("session failed by processor shouldn't be uploaded")
+	}
+}
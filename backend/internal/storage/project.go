@@ -0,0 +1,30 @@
+package storage
+
+import "context"
+
+// sessionKey is the type of the session's context keys, it doesn't collide with keys of other packages
+type sessionKey int
+
+const (
+	projectIDKey sessionKey = iota
+	trackerKey
+)
+
+// WithProject returns the session's context with its project id and tracker version. SessionEnd doesn't contain them,
+// the storage service reads them from the sessions table if PROJECT_LOOKUP is enabled.
+func WithProject(ctx context.Context, projectID, tracker string) context.Context {
+	ctx = context.WithValue(ctx, projectIDKey, projectID)
+	return context.WithValue(ctx, trackerKey, tracker)
+}
+
+// projectIDOf returns the project id of the session, empty if it wasn't set with WithProject
+func projectIDOf(ctx context.Context) string {
+	projectID, _ := ctx.Value(projectIDKey).(string)
+	return projectID
+}
+
+// trackerOf returns the tracker version of the session, empty if it wasn't set with WithProject
+func trackerOf(ctx context.Context) string {
+	tracker, _ := ctx.Value(trackerKey).(string)
+	return tracker
+}
@@ -0,0 +1,186 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+
+	"openreplay/backend/pkg/objectstorage"
+)
+
+// rangePart is the DOM part with its position in the whole DOM file, end is 0 if the part was uploaded without
+// its end offset (streamed files, parts without split_offset metadata)
+type rangePart struct {
+	key         string
+	indexed     bool  // the part is read from the indexed object by offset and size
+	offset      int64 // position of the part in the indexed object
+	size        int64
+	start, end  int64 // position of the part in the whole DOM file
+	checksum    string
+	compression objectstorage.CompressionType
+	encryption  string
+}
+
+// DownloadRange returns bytes [startByte, endByte) of the original (sorted) DOM mob file of the session, endByte is
+// limited by the file size. Only the parts overlapping the range are downloaded and decoded, the range can span
+// the split boundary. Parts are compressed and encrypted as a whole, so each needed part is read and decompressed
+// from its start even for a short range. Streamed DOM files are uploaded as a single part and are read completely.
+// The project id is used by the v2 key scheme only.
+func (s *Storage) DownloadRange(projectID string, sessionID, timestamp uint64, encryptionKey string, startByte, endByte int64) ([]byte, error) {
+	if startByte < 0 || endByte <= startByte {
+		return nil, fmt.Errorf("wrong range: %d-%d", startByte, endByte)
+	}
+	loc, err := s.locateSession(projectID, sessionID, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	parts, err := s.rangeParts(loc)
+	if err != nil {
+		return nil, err
+	}
+	// Positions of parts are unknown if any part was uploaded without its end offset, all parts are read then
+	sized := true
+	for _, part := range parts {
+		sized = sized && part.end != 0
+	}
+	id := strconv.FormatUint(sessionID, 10)
+	var (
+		res        []byte
+		partsStart int64 = -1
+	)
+	for _, part := range parts {
+		if !sized {
+			part.start, part.end = 0, 0
+		} else if part.end <= startByte || part.start >= endByte {
+			continue
+		}
+		data, err := s.downloadRangePart(id, part, encryptionKey)
+		if err != nil {
+			return nil, err
+		}
+		if partsStart < 0 {
+			partsStart = part.start
+		}
+		res = append(res, data...)
+	}
+	if partsStart < 0 || startByte-partsStart >= int64(len(res)) {
+		return nil, fmt.Errorf("range %d-%d is out of the dom file", startByte, endByte)
+	}
+	end := endByte - partsStart
+	if end > int64(len(res)) {
+		end = int64(len(res))
+	}
+	return res[startByte-partsStart : end], nil
+}
+
+// rangeParts returns DOM parts of the session from the manifest or object metadata in any layout
+func (s *Storage) rangeParts(loc *sessionObjects) ([]rangePart, error) {
+	if loc.manifest != nil {
+		return s.manifestRangeParts(loc.manifest)
+	}
+	if loc.indexed {
+		key := loc.domKeys[0]
+		info, err := s.objStorage.Head(key)
+		if err != nil {
+			return nil, fmt.Errorf("can't get %s info: %s", key, err)
+		}
+		if err := s.checkFormatVersion(key, info.Metadata[formatVersionMetadataKey]); err != nil {
+			return nil, err
+		}
+		enc, err := s.objectEncoding(info)
+		if err != nil {
+			return nil, err
+		}
+		rawIndex, ok := info.Metadata[domIndexMetadataKey]
+		if !ok {
+			return []rangePart{{key: key, compression: enc.compression, encryption: enc.encryption}}, nil
+		}
+		index, err := parseDomIndex(rawIndex)
+		if err != nil {
+			return nil, err
+		}
+		parts := make([]rangePart, len(index))
+		var start int64
+		for i, entry := range index {
+			parts[i] = rangePart{key: key, indexed: true, offset: entry.Offset, size: entry.Size, start: start,
+				end: entry.EndOffset, compression: enc.compression, encryption: enc.encryption}
+			start = entry.EndOffset
+		}
+		return parts, nil
+	}
+	var (
+		parts []rangePart
+		start int64
+	)
+	for _, key := range loc.domKeys {
+		info, err := s.objStorage.Head(key)
+		if err != nil {
+			return nil, fmt.Errorf("can't get %s info: %s", key, err)
+		}
+		if err := s.checkFormatVersion(key, info.Metadata[formatVersionMetadataKey]); err != nil {
+			return nil, err
+		}
+		enc, err := s.objectEncoding(info)
+		if err != nil {
+			return nil, err
+		}
+		end, _ := strconv.ParseInt(info.Metadata[splitOffsetMetadataKey], 10, 64)
+		parts = append(parts, rangePart{key: key, start: start, end: end, compression: enc.compression,
+			encryption: enc.encryption})
+		start = end
+	}
+	return parts, nil
+}
+
+func (s *Storage) manifestRangeParts(manifest *sessionManifest) ([]rangePart, error) {
+	if err := s.checkFormatVersion("manifest", manifest.Version); err != nil {
+		return nil, err
+	}
+	var (
+		parts []rangePart
+		start int64
+	)
+	for _, part := range manifest.Parts {
+		if part.FileType != DOM.String() {
+			continue
+		}
+		compression, err := objectstorage.ParseCompressionType(part.Compression)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, rangePart{key: part.Key, indexed: part.Indexed, offset: part.Offset, size: part.Size,
+			start: start, end: part.EndOffset, checksum: part.Checksum, compression: compression,
+			encryption: manifest.Encryption})
+		start = part.EndOffset
+	}
+	return parts, nil
+}
+
+func (s *Storage) downloadRangePart(sessionID string, part rangePart, encryptionKey string) ([]byte, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if part.indexed {
+		data, err = s.getRange(part.key, part.offset, part.size)
+	} else {
+		data, err = s.getObject(part.key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("can't download %s: %s", part.key, err)
+	}
+	if part.checksum != "" && checksum(data) != part.checksum {
+		return nil, fmt.Errorf("checksum mismatch of %s", part.key)
+	}
+	if encryptionKey != "" && part.encryption != "" {
+		if data, err = s.decrypt(part.encryption, sessionID, data, encryptionKey); err != nil {
+			return nil, fmt.Errorf("can't decrypt %s: %s", part.key, err)
+		}
+	}
+	if data, err = s.decompress(data, part.compression); err != nil {
+		return nil, fmt.Errorf("can't decompress %s: %s", part.key, err)
+	}
+	if part.end != 0 && int64(len(data)) != part.end-part.start {
+		return nil, fmt.Errorf("%s size mismatch: %d, expected: %d", part.key, len(data), part.end-part.start)
+	}
+	return data, nil
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+)
+
+func TestDownloadRange(t *testing.T) {
+	raw := [][]byte{bytes.Repeat([]byte("dom start "), 100), bytes.Repeat([]byte("dom end "), 50)}
+	mob := bytes.Join(raw, nil)
+	for _, layout := range []string{layoutSplit, layoutIndexed} {
+		for _, manifest := range []bool{false, true} {
+			s, objStorage := newTestStorage(t, &config.Config{CompressionAlgo: "zstd", LayoutMode: layout,
+				WriteManifest: manifest})
+			task := &Task{ctx: context.Background(), id: "42", base: "42", compression: s.compression}
+			for _, part := range raw {
+				packed, err := s.compress(part, s.compression)
+				if err != nil {
+					t.Fatal(err)
+				}
+				task.doms = append(task.doms, packed)
+				task.domRawSizes = append(task.domRawSizes, float64(len(part)))
+			}
+			if err := s.uploadParts(task); err != nil {
+				t.Fatal(err)
+			}
+			if manifest {
+				if err := s.uploadManifest(task); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for _, r := range [][2]int64{{10, 20}, {990, 1010}, {1200, 2000}} {
+				res, err := s.DownloadRange("", 42, 0, "", r[0], r[1])
+				if err != nil {
+					t.Fatal(err)
+				}
+				end := min(r[1], int64(len(mob)))
+				if !bytes.Equal(res, mob[r[0]:end]) {
+					t.Errorf("range %v mismatch, layout: %s, manifest: %t", r, layout, manifest)
+				}
+			}
+			// The range inside the first part doesn't need the second one
+			if layout == layoutSplit {
+				objStorage.Delete("42" + string(DOM) + "e")
+				if _, err := s.DownloadRange("", 42, 0, "", 0, 100); err != nil {
+					t.Errorf("first part should be enough: %s", err)
+				}
+			}
+			if _, err := s.DownloadRange("", 42, 0, "", 5000, 5010); err == nil {
+				t.Error("range out of the file should fail")
+			}
+		}
+	}
+}
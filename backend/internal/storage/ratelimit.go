@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	metrics "openreplay/backend/pkg/metrics/storage"
+)
+
+// ErrRateLimited is returned by Process if the session rate limit is exceeded and RATE_LIMIT_POLICY is reject
+var ErrRateLimited = errors.New("storage rate limit exceeded")
+
+// waitRateLimit takes a token for the new session, it waits for the token or fails without it depending on the policy
+func (s *Storage) waitRateLimit(ctx context.Context) error {
+	if s.limiter == nil || s.limiter.Allow() {
+		return nil
+	}
+	metrics.IncreaseStorageRateLimited(s.cfg.RateLimitPolicy)
+	if s.cfg.RateLimitPolicy == queueReject {
+		return ErrRateLimited
+	}
+	return s.limiter.Wait(ctx)
+}
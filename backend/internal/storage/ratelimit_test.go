@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/messages"
+)
+
+func TestRateLimit(t *testing.T) {
+	s, _ := newTestStorage(t, &config.Config{UploadsPerSecond: 0.1, UploadsBurst: 1, RateLimitPolicy: queueReject})
+	if err := os.WriteFile(s.cfg.FSDir+"/41", []byte("dom"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(41)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Process(context.Background(), msg); !errors.Is(err, ErrRateLimited) {
+		t.Errorf("expected rate limit error, got: %v", err)
+	}
+	// Blocked session waits until the context is done
+	s.cfg.RateLimitPolicy = queueBlock
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := s.Process(ctx, msg); err == nil {
+		t.Error("blocked session should fail with the context")
+	}
+	s.Wait()
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metrics "openreplay/backend/pkg/metrics/storage"
+)
+
+type readResult struct {
+	data []byte
+	err  error
+}
+
+// readFile reads the session file and aborts waiting if it takes longer than ReadTimeout, for example on a stalled
+// network mount. The stuck read keeps its goroutine, but the worker is released.
+func (s *Storage) readFile(ctx context.Context, filePath string, tp FileType) ([]byte, error) {
+	start := time.Now()
+	defer func() {
+		if s.cfg.SlowReadThreshold > 0 && time.Since(start) > s.cfg.SlowReadThreshold {
+			metrics.IncreaseStorageSlowReads(tp.String())
+			s.log.Warn(ctx, "slow %s file read: %s", tp.String(), time.Since(start))
+		}
+	}()
+	if s.cfg.ReadTimeout <= 0 {
+		return s.source.Read(filePath)
+	}
+	res := make(chan readResult, 1)
+	go func() {
+		data, err := s.source.Read(filePath)
+		res <- readResult{data, err}
+	}()
+	timer := time.NewTimer(s.cfg.ReadTimeout)
+	defer timer.Stop()
+	select {
+	case r := <-res:
+		return r.data, r.err
+	case <-timer.C:
+		return nil, fmt.Errorf("%w: %s", errReadTimeout, s.cfg.ReadTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
@@ -0,0 +1,32 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	config "openreplay/backend/internal/config/storage"
+)
+
+// stalledSource blocks reads until the test ends
+type stalledSource struct {
+	localSource
+	release chan struct{}
+}
+
+func (s *stalledSource) Read(path string) ([]byte, error) {
+	<-s.release
+	return nil, os.ErrClosed
+}
+
+func TestReadTimeout(t *testing.T) {
+	s, _ := newTestStorage(t, &config.Config{ReadTimeout: 50 * time.Millisecond})
+	source := &stalledSource{release: make(chan struct{})}
+	defer close(source.release)
+	s.source = source
+	if _, err := s.readFile(context.Background(), s.cfg.FSDir+"/1", DOM); !errors.Is(err, errReadTimeout) {
+		t.Fatalf("expected read timeout, got: %v", err)
+	}
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+)
+
+// Reassemble joins decrypted and decompressed DOM parts into the original DOM file. End offsets of parts in
+// the whole file are taken from the manifest (end_offset) or from the split_offset metadata of each object.
+// Reading fails if a part is missing, has an unexpected size or parts are passed out of order.
+func Reassemble(endOffsets []int64, parts ...io.Reader) io.Reader {
+	return &reassembler{endOffsets: endOffsets, parts: parts}
+}
+
+type reassembler struct {
+	endOffsets []int64
+	parts      []io.Reader
+	part       int
+	offset     int64 // position in the whole file
+	err        error
+}
+
+func (r *reassembler) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	if len(r.parts) != len(r.endOffsets) {
+		r.err = fmt.Errorf("wrong number of parts: %d, expected: %d", len(r.parts), len(r.endOffsets))
+		return 0, r.err
+	}
+	for r.part < len(r.parts) {
+		end := r.endOffsets[r.part]
+		if r.offset > end || (r.part > 0 && end < r.endOffsets[r.part-1]) {
+			r.err = fmt.Errorf("parts are out of order, part %d ends at %d before offset %d", r.part, end, r.offset)
+			return 0, r.err
+		}
+		// Read one byte more to detect parts bigger than expected
+		limit := end - r.offset + 1
+		if int64(len(p)) < limit {
+			limit = int64(len(p))
+		}
+		n, err := r.parts[r.part].Read(p[:limit])
+		r.offset += int64(n)
+		if r.offset > end {
+			r.err = fmt.Errorf("part %d is bigger than expected, parts are out of order or corrupted", r.part)
+			return 0, r.err
+		}
+		if err == io.EOF {
+			if r.offset != end {
+				r.err = fmt.Errorf("part %d is truncated, size: %d, expected end: %d", r.part, r.offset, end)
+				return n, r.err
+			}
+			r.part++
+			if n == 0 {
+				continue
+			}
+			return n, nil
+		}
+		if err != nil {
+			r.err = err
+		}
+		return n, err
+	}
+	return 0, io.EOF
+}
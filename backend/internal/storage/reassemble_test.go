@@ -0,0 +1,37 @@
+package storage
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReassemble(t *testing.T) {
+	for _, tc := range []struct {
+		name       string
+		endOffsets []int64
+		parts      []string
+		result     string
+		ok         bool
+	}{
+		{name: "single part", endOffsets: []int64{5}, parts: []string{"start"}, result: "start", ok: true},
+		{name: "split", endOffsets: []int64{5, 8}, parts: []string{"start", "end"}, result: "startend", ok: true},
+		{name: "extra parts", endOffsets: []int64{5, 8, 13}, parts: []string{"start", "end", "extra"}, result: "startendextra", ok: true},
+		{name: "out of order", endOffsets: []int64{5, 8}, parts: []string{"end", "start"}},
+		{name: "missing part", endOffsets: []int64{5, 8}, parts: []string{"start"}},
+		{name: "truncated part", endOffsets: []int64{5, 8}, parts: []string{"start", "en"}},
+	} {
+		readers := make([]io.Reader, len(tc.parts))
+		for i, part := range tc.parts {
+			readers[i] = strings.NewReader(part)
+		}
+		res, err := io.ReadAll(Reassemble(tc.endOffsets, readers...))
+		if (err == nil) != tc.ok {
+			t.Errorf("%s: unexpected err: %v", tc.name, err)
+			continue
+		}
+		if tc.ok && string(res) != tc.result {
+			t.Errorf("%s: wrong result: %s", tc.name, res)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+
+	metrics "openreplay/backend/pkg/metrics/storage"
+	"openreplay/backend/pkg/objectstorage"
+)
+
+// encryptionKeyIDMetadataKey is the object metadata key with the id of the key the object is encrypted with
+const encryptionKeyIDMetadataKey = "encryption_key_id"
+
+// errNotEncrypted is returned by Reencrypt for sessions uploaded without encryption
+var errNotEncrypted = errors.New("session isn't encrypted")
+
+// encryptionKeyID identifies the encryption key in metadata and manifests without revealing it
+func encryptionKeyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:8])
+}
+
+// Reencrypt re-encrypts all objects of the session with the new key after the key rotation: each DOM part, devtools
+// and canvas file is downloaded, decrypted with the old key, encrypted with the new one and uploaded under the same key
+// with the same encryption mode, the manifest gets the new key id. Objects already encrypted with the new key are
+// skipped, so an interrupted rotation can be started again with the same keys. Only objects uploaded with the old key
+// id in metadata are re-encrypted, sessions which weren't actually encrypted are rejected. Sessions are located like
+// in Delete, sessions uploaded with BATCH_UPLOADS are rejected. Mirror copies are replaced with the re-encrypted
+// objects before the manifest is updated, so they stay readable after the old key is retired.
+func (s *Storage) Reencrypt(ctx context.Context, projectID string, sessionID uint64, timestamp uint64, oldKey, newKey string) error {
+	if oldKey == "" || newKey == "" {
+		return fmt.Errorf("encryption keys must not be empty")
+	}
+	ctx = WithProject(ctx, projectID, trackerOf(ctx))
+	loc, err := s.locateSession(projectID, sessionID, timestamp)
+	if err != nil {
+		return err
+	}
+	if loc.batched {
+		return errBatched
+	}
+	manifest := loc.manifest
+	if manifest != nil && manifest.KeyID == "" {
+		return errNotEncrypted
+	}
+	task := &Task{ctx: ctx, id: strconv.FormatUint(sessionID, 10), key: newKey, base: loc.base, timestamp: timestamp}
+	// Manifest is updated last, so the session with the new key id in the manifest is already re-encrypted, only
+	// the mirror copy of the manifest could be left behind
+	if manifest != nil && manifest.KeyID == encryptionKeyID(newKey) {
+		return s.reencryptMirror(task, map[string]FileType{loc.base + manifestName: ""})
+	}
+	mode := s.cfg.EncryptionMode
+	if manifest != nil && manifest.Encryption != "" {
+		mode = manifest.Encryption
+	}
+	keys := make(map[string]FileType)
+	for _, tp := range fileTypes {
+		for _, key := range s.sessionKeys(loc, tp) {
+			keys[key] = tp
+		}
+	}
+	checksums := make(map[string][]string)
+	var errs []error
+	for key, tp := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !s.objStorage.Exists(key) {
+			continue
+		}
+		sums, err := s.reencryptObject(task, key, tp, mode, oldKey)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("can't re-encrypt %s: %w", key, err))
+			continue
+		}
+		checksums[key] = sums
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	reencrypted := make(map[string]FileType, len(checksums))
+	for key := range checksums {
+		reencrypted[key] = keys[key]
+	}
+	if err := s.reencryptMirror(task, reencrypted); err != nil {
+		return err
+	}
+	if manifest == nil {
+		return nil
+	}
+	if err := s.reencryptManifest(task, manifest, checksums); err != nil {
+		return err
+	}
+	return s.reencryptMirror(task, map[string]FileType{loc.base + manifestName: ""})
+}
+
+// reencryptMirror replaces mirror copies of the objects with the re-encrypted primary objects, tp is empty for
+// the manifest
+func (s *Storage) reencryptMirror(task *Task, keys map[string]FileType) error {
+	if s.mirror == nil {
+		return nil
+	}
+	var errs []error
+	for key, tp := range keys {
+		if err := s.uploadMirror(task, key, tp, nil); err != nil {
+			errs = append(errs, fmt.Errorf("can't mirror re-encrypted %s: %s", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// reencryptObject re-encrypts the object and returns checksums of its parts for the manifest, the object already
+// encrypted with the new key isn't uploaded again. Parts of the indexed DOM object are encrypted separately.
+func (s *Storage) reencryptObject(task *Task, key string, tp FileType, mode, oldKey string) ([]string, error) {
+	info, err := s.objStorage.Head(key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.getObject(key)
+	if err != nil {
+		return nil, err
+	}
+	index := []domIndexEntry{{Size: int64(len(data))}}
+	rawIndex, indexed := info.Metadata[domIndexMetadataKey]
+	if indexed {
+		if index, err = parseDomIndex(rawIndex); err != nil {
+			return nil, err
+		}
+	}
+	for i, entry := range index {
+		if entry.Offset+entry.Size > int64(len(data)) {
+			return nil, fmt.Errorf("part %d is out of the object", i)
+		}
+	}
+	sums := make([]string, len(index))
+	newKeyID := encryptionKeyID(task.key)
+	switch info.Metadata[encryptionKeyIDMetadataKey] {
+	case newKeyID:
+		for i, entry := range index {
+			sums[i] = checksum(data[entry.Offset : entry.Offset+entry.Size])
+		}
+		return sums, nil
+	case encryptionKeyID(oldKey):
+	case "":
+		return nil, errNotEncrypted
+	default:
+		return nil, fmt.Errorf("object is encrypted with another key")
+	}
+	reencrypted := new(bytes.Buffer)
+	for i, entry := range index {
+		decrypted, err := s.decrypt(mode, task.id, data[entry.Offset:entry.Offset+entry.Size], oldKey)
+		if err != nil {
+			return nil, err
+		}
+		encrypted, err := s.encrypt(mode, task.id, decrypted, task.key)
+		if err != nil {
+			return nil, err
+		}
+		index[i].Offset, index[i].Size = int64(reencrypted.Len()), int64(len(encrypted))
+		reencrypted.Write(encrypted)
+		sums[i] = checksum(encrypted)
+	}
+	opts := &objectstorage.UploadOptions{
+		Metadata:     make(map[string]string),
+		StorageClass: s.storageClass[tp],
+		ACL:          s.acl,
+		Tags:         s.objectTags(task),
+	}
+	for k, v := range info.Metadata {
+		opts.Metadata[k] = v
+	}
+	opts.Metadata[checksumMetadataKey] = checksum(reencrypted.Bytes())
+	opts.Metadata[encryptionKeyIDMetadataKey] = newKeyID
+	if indexed {
+		opts.Metadata[domIndexMetadataKey] = encodeDomIndex(index)
+	}
+	compression, err := objectstorage.ParseCompressionType(info.Metadata[compressionMetadataKey])
+	if err != nil {
+		compression = s.compressionFor(tp)
+	}
+	err = s.withRetry(task, key, tp, func(ctx context.Context) error {
+		opts.Context = ctx
+		return s.objStorage.UploadWithOptions(bytes.NewReader(reencrypted.Bytes()), key, s.contentType[tp], compression, opts)
+	})
+	if err != nil {
+		return nil, err
+	}
+	metrics.IncreaseStorageReencryptedObjects(tp.String())
+	return sums, nil
+}
+
+// reencryptManifest updates checksums of re-encrypted parts and the key id of the manifest
+func (s *Storage) reencryptManifest(task *Task, manifest *sessionManifest, checksums map[string][]string) error {
+	partIndexes := make(map[string]int)
+	for i, part := range manifest.Parts {
+		sums := checksums[part.Key]
+		// Streamed parts have no checksum, indexed DOM parts follow each other in the manifest
+		if part.Checksum != "" && partIndexes[part.Key] < len(sums) {
+			manifest.Parts[i].Checksum = sums[partIndexes[part.Key]]
+		}
+		partIndexes[part.Key]++
+	}
+	manifest.KeyID = encryptionKeyID(task.key)
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("can't marshal manifest: %s", err)
+	}
+	key := task.base + manifestName
+	opts := &objectstorage.UploadOptions{ACL: s.acl, Tags: s.objectTags(task)}
+	if info, err := s.objStorage.Head(key); err == nil {
+		opts.Metadata = info.Metadata
+	}
+	return s.withRetry(task, key, DOM, func(ctx context.Context) error {
+		opts.Context = ctx
+		return s.objStorage.UploadWithOptions(bytes.NewReader(data), key, "application/json", objectstorage.NoCompression, opts)
+	})
+}
+
+// encrypt is the counterpart of decrypt, unlike encryptSession it doesn't fall back to not encrypted data
+func (s *Storage) encrypt(mode, sessionID string, data []byte, encryptionKey string) ([]byte, error) {
+	if mode == encryptionGCM {
+		return encryptGCM(data, []byte(encryptionKey), sessionID)
+	}
+	return EncryptData(data, []byte(encryptionKey))
+}
@@ -0,0 +1,39 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/messages"
+)
+
+func TestReencryptNotEncrypted(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{WriteManifest: true})
+	dom := bytes.Repeat([]byte("dom"), 100)
+	if err := os.WriteFile(s.cfg.FSDir+"/48", dom, 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(48)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	if err := s.Reencrypt(context.Background(), "", 48, 0, "old key material", "new key material"); !errors.Is(err, errNotEncrypted) {
+		t.Fatalf("not encrypted session shouldn't be re-encrypted, got: %v", err)
+	}
+	// Objects without the key id are rejected even if the manifest wasn't written
+	if err := objStorage.Delete("48" + manifestName); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Reencrypt(context.Background(), "", 48, 0, "old key material", "new key material"); !errors.Is(err, errNotEncrypted) {
+		t.Fatalf("not encrypted objects shouldn't be re-encrypted, got: %v", err)
+	}
+	if obj, _ := objStorage.Object("48/dom.mobs"); !bytes.Equal(obj.Data, dom) {
+		t.Error("not encrypted object was modified")
+	}
+}
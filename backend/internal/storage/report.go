@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"time"
+
+	"openreplay/backend/pkg/logger"
+)
+
+// logReport writes one structured log line with the upload result of the session. Project id isn't a part of
+// the SessionEnd message, so it's taken from the task's context by logger if set.
+func (s *Storage) logReport(task *Task, uploadErr error) {
+	var domSize, domCompressed float64
+	for i, dom := range task.doms {
+		domSize += task.domRawSizes[i]
+		domCompressed += float64(dom.Len())
+	}
+	var devCompressed float64
+	if task.dev != nil {
+		devCompressed = float64(task.dev.Len())
+	}
+	var canvasCompressed float64
+	if task.canvas != nil {
+		canvasCompressed = float64(task.canvas.Len())
+	}
+	fields := map[string]interface{}{
+		"domSize":              domSize,
+		"devSize":              task.devRawSize,
+		"domCompressedSize":    domCompressed,
+		"devCompressedSize":    devCompressed,
+		"canvasSize":           task.canvasRawSize,
+		"canvasCompressedSize": canvasCompressed,
+		"durationMs":           time.Since(task.startedAt).Milliseconds(),
+		"retries":              task.retries.Load(),
+		"success":              uploadErr == nil,
+	}
+	if task.domPath != "" {
+		fields["domStreamed"] = true
+	}
+	if uploadErr != nil {
+		fields["error"] = uploadErr.Error()
+		s.log.Error(logger.WithFields(task.ctx, fields), "session upload report")
+		return
+	}
+	s.log.Info(logger.WithFields(task.ctx, fields), "session upload report")
+}
@@ -0,0 +1,173 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"time"
+
+	metrics "openreplay/backend/pkg/metrics/storage"
+	"openreplay/backend/pkg/objectstorage"
+)
+
+func (s *Storage) uploadWithRetry(task *Task, data *bytes.Buffer, key string, tp FileType, metadata map[string]string) error {
+	if s.shouldDedup(task, tp) {
+		return s.uploadDeduplicated(task, data, key, tp, metadata)
+	}
+	return s.uploadObject(task, data, key, tp, metadata)
+}
+
+func (s *Storage) uploadObject(task *Task, data *bytes.Buffer, key string, tp FileType, metadata map[string]string) error {
+	sum := checksum(data.Bytes())
+	opts := &objectstorage.UploadOptions{
+		Metadata:     map[string]string{checksumMetadataKey: sum},
+		StorageClass: s.storageClass[tp],
+		ACL:          s.acl,
+		Tags:         s.objectTags(task),
+	}
+	for k, v := range task.metadata {
+		opts.Metadata[k] = v
+	}
+	for k, v := range metadata {
+		opts.Metadata[k] = v
+	}
+	opts.Metadata[compressionMetadataKey] = task.compressionOf(tp).String()
+	opts.Metadata[formatVersionMetadataKey] = s.formatVersion
+	opts.Metadata[encryptionMetadataKey] = encryptionNone
+	if task.encrypted() {
+		opts.Metadata[encryptionMetadataKey] = s.encryptionOf(task)
+		opts.Metadata[encryptionKeyIDMetadataKey] = encryptionKeyID(task.key)
+	}
+	s.setDictionaryMetadata(task, tp, opts.Metadata)
+	if s.cfg.IdempotentUploads && !s.cfg.DryRun && s.isUploaded(key, int64(data.Len()), sum) {
+		metrics.IncreaseStorageUploadsSkippedExisting(tp.String())
+		return nil
+	}
+	attempt := 0
+	err := s.withRetry(task, key, tp, func(ctx context.Context) error {
+		// Use a new reader for each attempt to upload the whole buffer again
+		reader := newCtxReader(ctx, bytes.NewReader(data.Bytes()))
+		opts.Context = ctx
+		start := time.Now()
+		err := s.objStorage.UploadWithOptions(reader, key, s.contentType[tp], task.compressionOf(tp), opts)
+		metrics.RecordPutDuration(float64(time.Since(start).Milliseconds()), tp.String(), attempt)
+		attempt++
+		if err != nil {
+			return err
+		}
+		if s.cfg.VerifyUploads && !s.cfg.DryRun {
+			return s.verifyUpload(key, int64(data.Len()), sum)
+		}
+		return nil
+	})
+	// Retried uploads overwrite the same object, so the size is counted once
+	if err == nil && !s.cfg.DryRun {
+		metrics.IncreaseStorageStoredBytes(float64(data.Len()), tp.String())
+	}
+	return err
+}
+
+// withRetry calls upload until it succeeds, ctx of each attempt has its own UploadTimeout deadline
+func (s *Storage) withRetry(task *Task, key string, tp FileType, upload func(ctx context.Context) error) error {
+	var err error
+	for attempt := 0; attempt <= s.cfg.UploadMaxRetries; attempt++ {
+		if attempt > 0 {
+			metrics.IncreaseStorageUploadRetries(tp.String())
+			task.retries.Add(1)
+			delay := s.retryDelay(attempt)
+			s.log.Warn(task.ctx, "retrying upload of %s in %s, attempt: %d, err: %s", key, delay, attempt, err)
+			select {
+			case <-time.After(delay):
+			case <-task.ctx.Done():
+				return task.ctx.Err()
+			}
+		}
+		if ctxErr := task.ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		if slotErr := s.acquireUploadSlot(task.ctx, tp); slotErr != nil {
+			return slotErr
+		}
+		// Sessions go to the dead letter dir without retries while the object storage is unavailable
+		allowed, probe := true, false
+		if s.breaker != nil {
+			allowed, probe = s.breaker.allow()
+		}
+		if !allowed {
+			s.uploadSlots.Release(1)
+			metrics.IncreaseStorageBreakerRejections()
+			return errCircuitOpen
+		}
+		err = s.uploadWithTimeout(task, tp, upload)
+		s.uploadSlots.Release(1)
+		if s.breaker != nil {
+			s.breaker.record(probe, err == nil)
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("all %d attempts failed, last err: %w", s.cfg.UploadMaxRetries+1, err)
+}
+
+// uploadWithTimeout aborts the upload attempt if it takes longer than UploadTimeout, ctx is passed to the object
+// storage with UploadOptions. The attempt returns only when its request is aborted, so the upload slot and the data
+// buffer are held until then and the next attempt never overlaps with it.
+func (s *Storage) uploadWithTimeout(task *Task, tp FileType, upload func(ctx context.Context) error) error {
+	if s.cfg.UploadTimeout <= 0 {
+		return upload(task.ctx)
+	}
+	ctx, cancel := context.WithTimeout(task.ctx, s.cfg.UploadTimeout)
+	defer cancel()
+	err := upload(ctx)
+	if err == nil || ctx.Err() == nil || task.ctx.Err() != nil {
+		return err
+	}
+	metrics.IncreaseStorageUploadTimeouts(tp.String())
+	return fmt.Errorf("%w: %s", errUploadTimeout, s.cfg.UploadTimeout)
+}
+
+// acquireUploadSlot waits for a free upload slot, slots are shared by all workers to limit connections to the object storage
+func (s *Storage) acquireUploadSlot(ctx context.Context, tp FileType) error {
+	start := time.Now()
+	if err := s.uploadSlots.Acquire(ctx, 1); err != nil {
+		return err
+	}
+	metrics.RecordUploadSlotWaitDuration(float64(time.Since(start).Milliseconds()), tp.String())
+	return nil
+}
+
+// retryDelay returns exponential backoff with full jitter for the given attempt
+func (s *Storage) retryDelay(attempt int) time.Duration {
+	base, maxDelay := s.cfg.UploadRetryBaseDelay, s.cfg.UploadRetryMaxDelay
+	if base <= 0 {
+		return 0
+	}
+	delay := maxDelay
+	if shift := attempt - 1; shift < 32 && base<<shift > 0 && base<<shift < maxDelay {
+		delay = base << shift
+	}
+	if delay <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(delay)) + 1)
+}
+
+// ctxReader aborts the upload with the context error once the context is cancelled
+type ctxReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+func newCtxReader(ctx context.Context, reader io.Reader) io.Reader {
+	return &ctxReader{ctx: ctx, reader: reader}
+}
+
+func (r *ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
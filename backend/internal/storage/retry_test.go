@@ -0,0 +1,123 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/objectstorage"
+	"openreplay/backend/pkg/objectstorage/memory"
+)
+
+func TestVerifyUploads(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{VerifyUploads: true})
+	task := &Task{ctx: context.Background(), id: "3", base: "3"}
+	data := bytes.NewBufferString("compressed data")
+	if err := s.uploadWithRetry(task, data, "3"+string(DEV), DEV, nil); err != nil {
+		t.Fatalf("upload verification failed: %s", err)
+	}
+	if objectMetadata(objStorage, "3"+string(DEV))[checksumMetadataKey] != checksum(data.Bytes()) {
+		t.Error("checksum wasn't saved in object metadata")
+	}
+	objectMetadata(objStorage, "3"+string(DEV))[checksumMetadataKey] = "broken"
+	if err := s.verifyUpload("3"+string(DEV), int64(data.Len()), checksum(data.Bytes())); err == nil {
+		t.Error("expected checksum mismatch error")
+	}
+}
+
+func TestIdempotentUploads(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{IdempotentUploads: true})
+	task := &Task{ctx: context.Background(), id: "4", base: "4"}
+	data := bytes.NewBufferString("compressed data")
+	if err := s.uploadWithRetry(task, data, "4"+string(DEV), DEV, nil); err != nil {
+		t.Fatal(err)
+	}
+	objStorage.SetError(errors.New("object overwritten"))
+	if err := s.uploadWithRetry(task, data, "4"+string(DEV), DEV, nil); err != nil {
+		t.Errorf("upload of the same object wasn't skipped: %s", err)
+	}
+	if err := s.uploadWithRetry(task, bytes.NewBufferString("new data"), "4"+string(DEV), DEV, nil); err == nil {
+		t.Error("changed object should be uploaded again")
+	}
+}
+
+// failingKeyStorage fails uploads of keys with the given suffix
+type failingKeyStorage struct {
+	*memory.Storage
+	suffix string
+}
+
+func (f *failingKeyStorage) UploadWithOptions(reader io.Reader, key string, contentType string, compression objectstorage.CompressionType, opts *objectstorage.UploadOptions) error {
+	if strings.HasSuffix(key, f.suffix) {
+		return errors.New("upload failed")
+	}
+	return f.Storage.UploadWithOptions(reader, key, contentType, compression, opts)
+}
+
+func TestPartialUploadRollback(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{})
+	s.objStorage = &failingKeyStorage{Storage: objStorage, suffix: string(DOM) + "e"}
+	task := &Task{
+		ctx:         context.Background(),
+		id:          "24",
+		base:        "24",
+		doms:        []*bytes.Buffer{bytes.NewBufferString("start"), bytes.NewBufferString("end")},
+		domRawSizes: []float64{5, 3},
+		dev:         bytes.NewBufferString("devtools"),
+		devRawSize:  8,
+	}
+	if err := s.uploadParts(task); err == nil {
+		t.Fatal("upload of the end part should fail")
+	}
+	if objStorage.Exists("24" + string(DOM) + "s") {
+		t.Error("uploaded start part should be deleted")
+	}
+	if !objStorage.Exists("24" + string(DEV)) {
+		t.Error("devtools file shouldn't be deleted")
+	}
+}
+
+// stuckStorage blocks the first upload of each key until its context is done
+type stuckStorage struct {
+	*memory.Storage
+	keys   sync.Map
+	active atomic.Int32 // uploads in progress
+}
+
+func (s *stuckStorage) UploadWithOptions(reader io.Reader, key string, contentType string, compression objectstorage.CompressionType, opts *objectstorage.UploadOptions) error {
+	if s.active.Add(1) > 1 {
+		return errors.New("uploads overlap")
+	}
+	defer s.active.Add(-1)
+	if _, uploaded := s.keys.LoadOrStore(key, true); !uploaded {
+		ctx := objectstorage.UploadContext(opts)
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	return s.Storage.UploadWithOptions(reader, key, contentType, compression, opts)
+}
+
+func TestUploadTimeout(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{UploadTimeout: 50 * time.Millisecond})
+	s.objStorage = &stuckStorage{Storage: objStorage}
+	task := &Task{ctx: context.Background(), id: "48", compression: objectstorage.NoCompression}
+	err := s.uploadWithRetry(task, bytes.NewBufferString("data"), "48"+string(DEV), DEV, nil)
+	if !errors.Is(err, errUploadTimeout) {
+		t.Fatalf("stuck upload should time out, err: %v", err)
+	}
+	// Retry starts after the stuck attempt is aborted and gets a new deadline
+	s.cfg.UploadMaxRetries = 1
+	if err := s.uploadWithRetry(task, bytes.NewBufferString("data"), "48"+string(DOM), DOM, nil); err != nil {
+		t.Fatalf("retried upload should succeed: %s", err)
+	}
+	if data, err := s.getObject("48" + string(DOM)); err != nil || string(data) != "data" {
+		t.Errorf("wrong uploaded data: %q, err: %v", data, err)
+	}
+}
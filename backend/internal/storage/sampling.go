@@ -0,0 +1,24 @@
+package storage
+
+import (
+	"context"
+	"hash/fnv"
+)
+
+// isSampled returns a deterministic sampling decision, the same session is always either stored or skipped.
+// Per-project rate is used if the project id is set in the session's context with WithProject.
+func (s *Storage) isSampled(ctx context.Context, sessionID string) bool {
+	rate := s.sampleRate
+	if projectRate, ok := s.cfg.ProjectSampleRates[projectIDOf(ctx)]; ok {
+		rate = projectRate
+	}
+	switch {
+	case rate >= 1:
+		return true
+	case rate <= 0:
+		return false
+	}
+	hash := fnv.New64a()
+	hash.Write([]byte(sessionID))
+	return float64(hash.Sum64()%10000) < rate*10000
+}
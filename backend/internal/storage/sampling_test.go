@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+)
+
+func TestSampling(t *testing.T) {
+	s, _ := newTestStorage(t, &config.Config{SampleRate: 0.5, ProjectSampleRates: map[string]float64{"7": 0},
+		ProjectLookup: true})
+	sampled := 0
+	for id := 0; id < 1000; id++ {
+		sessionID := strconv.Itoa(id)
+		decision := s.isSampled(context.Background(), sessionID)
+		if decision != s.isSampled(context.Background(), sessionID) {
+			t.Fatalf("sampling decision isn't deterministic for session %s", sessionID)
+		}
+		if decision {
+			sampled++
+		}
+	}
+	if sampled < 400 || sampled > 600 {
+		t.Errorf("expected about 500 sampled sessions, got %d", sampled)
+	}
+	if s.isSampled(WithProject(context.Background(), "7", ""), "1") {
+		t.Error("project sample rate wasn't used")
+	}
+}
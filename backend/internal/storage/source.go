@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/objectstorage"
+	"openreplay/backend/pkg/objectstorage/store"
+)
+
+// SourceReader reads raw session files written by the capture nodes
+type SourceReader interface {
+	// Size returns the size of the file or an error which matches os.ErrNotExist if the file doesn't exist
+	Size(path string) (int64, error)
+	Read(path string) ([]byte, error)
+	Open(path string) (io.ReadCloser, error)
+	Remove(path string) error
+}
+
+func newSource(cfg *config.Config) (SourceReader, error) {
+	switch cfg.Source {
+	case "", "local":
+		return &localSource{}, nil
+	case "objectstorage":
+		if cfg.SourceBucketName == "" {
+			return nil, fmt.Errorf("source bucket name is empty")
+		}
+		sourceCfg := cfg.ObjectsConfig
+		sourceCfg.BucketName = cfg.SourceBucketName
+		objStorage, err := store.NewStore(&sourceCfg)
+		if err != nil {
+			return nil, fmt.Errorf("can't init source object storage: %s", err)
+		}
+		return &objectSource{objStorage: objStorage}, nil
+	default:
+		return nil, fmt.Errorf("unknown session files source: %s", cfg.Source)
+	}
+}
+
+// localSource reads session files from the local (or shared) disk
+type localSource struct{}
+
+func (l *localSource) Size(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+func (l *localSource) Read(path string) ([]byte, error) {
+	return os.ReadFile(path)
+}
+
+func (l *localSource) Open(path string) (io.ReadCloser, error) {
+	return os.Open(path)
+}
+
+func (l *localSource) Remove(path string) error {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// objectSource reads session files from the object storage, FS_DIR is used as the key prefix
+type objectSource struct {
+	objStorage objectstorage.ObjectStorage
+}
+
+func (o *objectSource) key(path string) string {
+	return strings.TrimPrefix(path, "/")
+}
+
+func (o *objectSource) Size(path string) (int64, error) {
+	if !o.objStorage.Exists(o.key(path)) {
+		return 0, os.ErrNotExist
+	}
+	info, err := o.objStorage.Head(o.key(path))
+	if err != nil {
+		return 0, err
+	}
+	return info.Size, nil
+}
+
+func (o *objectSource) Read(path string) ([]byte, error) {
+	reader, err := o.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+func (o *objectSource) Open(path string) (io.ReadCloser, error) {
+	return o.objStorage.Get(o.key(path))
+}
+
+// Remove keeps the source objects, they should be removed by the bucket's lifecycle rules
+func (o *objectSource) Remove(path string) error {
+	return nil
+}
@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/messages"
+	"openreplay/backend/pkg/objectstorage"
+	"openreplay/backend/pkg/objectstorage/memory"
+)
+
+func TestObjectSource(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{FileSplitSize: 5, MaxFileSize: 10, DropOversized: true})
+	source := memory.New()
+	s.cfg.FSDir, s.source = "/mobs", &objectSource{objStorage: source}
+	for id, dom := range map[uint64]string{17: "dom", 18: "oversized dom"} {
+		if err := source.Upload(strings.NewReader(dom), fmt.Sprintf("mobs/%d", id), "", objectstorage.NoCompression); err != nil {
+			t.Fatal(err)
+		}
+		msg := &messages.SessionEnd{}
+		msg.SetSessionID(id)
+		if err := s.Process(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Wait()
+	if !objStorage.Exists("17" + string(DOM) + "s") {
+		t.Error("dom file from object source wasn't uploaded")
+	}
+	if objStorage.Exists("18" + string(DOM) + "s") {
+		t.Error("oversized dom file from object source shouldn't be uploaded")
+	}
+}
@@ -0,0 +1,114 @@
+package storage
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	metrics "openreplay/backend/pkg/metrics/storage"
+)
+
+// splitStatsWindow is the number of the latest DOM sizes used to calculate percentiles
+const splitStatsWindow = 1000
+
+// splitStats collects DOM sizes and split decisions and periodically logs the summary, it helps to tune FileSplitSize
+type splitStats struct {
+	s      *Storage
+	mu     sync.Mutex
+	sizes  []int64 // ring buffer with the latest DOM sizes
+	next   int
+	total  int
+	splits int
+	done   chan struct{}
+}
+
+func newSplitStats(s *Storage) *splitStats {
+	st := &splitStats{
+		s:     s,
+		sizes: make([]int64, 0, splitStatsWindow),
+		done:  make(chan struct{}),
+	}
+	go st.run()
+	return st
+}
+
+// recordSplit records the split decision and part sizes of the DOM file
+func (s *Storage) recordSplit(parts ...int64) {
+	split := len(parts) > 1
+	metrics.IncreaseStorageDomSplits(split)
+	metrics.IncreaseStorageSessionsSplit(split)
+	var size int64
+	for i, part := range parts {
+		metrics.RecordStorageDomPartSize(float64(part), domPartLabel(i, len(parts)))
+		size += part
+	}
+	if s.splitStats != nil {
+		s.splitStats.add(size, split)
+	}
+}
+
+// domPartLabel returns the metric label of the DOM part, it follows the key suffixes: start, end and extra parts
+func domPartLabel(part, parts int) string {
+	switch {
+	case parts == 1:
+		return "whole"
+	case part == 0:
+		return "start"
+	case part == 1:
+		return "end"
+	default:
+		return "extra"
+	}
+}
+
+func (st *splitStats) add(size int64, split bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if len(st.sizes) < splitStatsWindow {
+		st.sizes = append(st.sizes, size)
+	} else {
+		st.sizes[st.next] = size
+	}
+	st.next = (st.next + 1) % splitStatsWindow
+	st.total++
+	if split {
+		st.splits++
+	}
+}
+
+// summary returns p50 and p95 of the latest DOM sizes with the number of sessions and splits since the last summary
+func (st *splitStats) summary() (p50, p95 int64, total, splits int) {
+	st.mu.Lock()
+	sizes := append([]int64(nil), st.sizes...)
+	total, splits = st.total, st.splits
+	st.total, st.splits = 0, 0
+	st.mu.Unlock()
+	if len(sizes) == 0 {
+		return 0, 0, total, splits
+	}
+	sort.Slice(sizes, func(i, j int) bool { return sizes[i] < sizes[j] })
+	return sizes[(len(sizes)-1)*50/100], sizes[(len(sizes)-1)*95/100], total, splits
+}
+
+func (st *splitStats) run() {
+	tick := time.NewTicker(st.s.cfg.SplitStatsInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			p50, p95, total, splits := st.summary()
+			if total == 0 {
+				continue
+			}
+			st.s.log.Info(context.Background(), "dom size p50: %d, p95: %d, split sessions: %d of %d, file split size: %d",
+				p50, p95, splits, total, st.s.cfg.FileSplitSize)
+		case <-st.done:
+			return
+		}
+	}
+}
+
+func (st *splitStats) stop() {
+	close(st.done)
+}
@@ -0,0 +1,19 @@
+package storage
+
+import (
+	"testing"
+)
+
+func TestSplitStats(t *testing.T) {
+	st := &splitStats{}
+	for i := 1; i <= 100; i++ {
+		st.add(int64(i), i > 90)
+	}
+	p50, p95, total, splits := st.summary()
+	if p50 != 50 || p95 != 95 || total != 100 || splits != 10 {
+		t.Fatalf("wrong summary: p50 %d, p95 %d, total %d, splits %d", p50, p95, total, splits)
+	}
+	if _, _, total, _ := st.summary(); total != 0 {
+		t.Fatalf("counters are not reset: %d", total)
+	}
+}
@@ -3,17 +3,22 @@ package storage
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"os"
+	"runtime"
 	"strconv"
-	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/andybalholm/brotli"
 	"github.com/klauspost/compress/zstd"
 	gzip "github.com/klauspost/pgzip"
+	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
 
 	config "openreplay/backend/internal/config/storage"
 	"openreplay/backend/pkg/logger"
@@ -23,78 +28,449 @@ import (
 	"openreplay/backend/pkg/pool"
 )
 
+var (
+	ErrStorageClosed  = errors.New("storage is closed")
+	ErrQueueFull      = errors.New("storage queue is full")
+	ErrInvalidMessage = errors.New("invalid session end message") // nil message or zero session id
+	errSmallFile      = errors.New("file is too small")
+	errReadTimeout    = errors.New("file read timeout")
+	errUploadTimeout  = errors.New("upload timeout")
+)
+
+// Policies of handling new sessions when the processing queue is full
+const (
+	queueBlock      = "block"
+	queueReject     = "reject"
+	queueDropOldest = "drop-oldest"
+)
+
 type FileType string
 
 const (
-	DOM FileType = "/dom.mob"
-	DEV FileType = "/devtools.mob"
+	DOM    FileType = "/dom.mob"
+	DEV    FileType = "/devtools.mob"
+	CANVAS FileType = "/canvas.mob" // canvas and webgl frames, optional like devtools
 )
 
+// fileTypes are all session file types
+var fileTypes = []FileType{DOM, DEV, CANVAS}
+
 func (t FileType) String() string {
-	if t == DOM {
+	switch t {
+	case DOM:
 		return "dom"
+	case CANVAS:
+		return "canvas"
+	default:
+		return "devtools"
+	}
+}
+
+const canvasFileName = "canvas"
+
+// fileName returns the suffix of the session file name on disk (appended to the session id) and the suffix
+// of the object key (appended to the session's key base), devtools names are configurable
+func (s *Storage) fileName(tp FileType) (string, string) {
+	switch tp {
+	case DEV:
+		return s.devFileName, s.devKey
+	case CANVAS:
+		return canvasFileName, string(CANVAS)
+	default:
+		return "", string(DOM)
+	}
+}
+
+// localPath returns the path of the session file on disk
+func (s *Storage) localPath(sessionPath string, tp FileType) string {
+	name, _ := s.fileName(tp)
+	return sessionPath + name
+}
+
+// objectKey returns the object key of the session file, DOM parts have additional suffixes
+func (s *Storage) objectKey(base string, tp FileType) string {
+	_, suffix := s.fileName(tp)
+	return base + suffix
+}
+
+const defaultContentType = "application/octet-stream"
+
+// splitOffsetMetadataKey is the object metadata key with the end offset of the DOM part in the whole DOM file
+const splitOffsetMetadataKey = "split_offset"
+
+// domPartSuffix returns the key suffix of the DOM part, the first two parts keep the original start/end naming
+func domPartSuffix(part int) string {
+	switch part {
+	case 0:
+		return "s"
+	case 1:
+		return "e"
+	default:
+		return strconv.Itoa(part)
+	}
+}
+
+func domPartName(part int) string {
+	switch part {
+	case 0:
+		return "dom start"
+	case 1:
+		return "dom end"
+	default:
+		return fmt.Sprintf("dom part %d", part)
 	}
-	return "devtools"
 }
 
 type Task struct {
-	ctx         context.Context
-	id          string
-	key         string
-	domRaw      []byte
-	devRaw      []byte
-	index       int
-	domsRawSize float64
-	domeRawSize float64
-	devRawSize  float64
-	doms        *bytes.Buffer
-	dome        *bytes.Buffer
-	dev         *bytes.Buffer
-	compression objectstorage.CompressionType
+	ctx           context.Context
+	id            string
+	key           string
+	base          string              // location of the session's objects in the bucket
+	timestamp     uint64              // session end timestamp
+	paths         map[FileType]string // local paths of the session files by type
+	domRaw        []byte
+	devRaw        []byte
+	canvasRaw     []byte
+	domPath       string // not empty if DOM file should be streamed directly from disk
+	index         int
+	domRawSizes   []float64
+	devRawSize    float64
+	canvasRawSize float64
+	doms          []*bytes.Buffer // DOM parts in playback order: start, end and optional extra parts
+	dev           *bytes.Buffer
+	canvas        *bytes.Buffer
+	// Files already compressed by the tracker are uploaded without compression
+	domPrecompressed    bool
+	devPrecompressed    bool
+	canvasPrecompressed bool
+	compression         objectstorage.CompressionType
+	compressions        map[FileType]objectstorage.CompressionType // overrides of the default compression by file type
+	startedAt           time.Time
+	enqueuedAt          time.Time
+	retries             atomic.Int32 // number of retried uploads of all session files
+	generation          uint64       // flush generation of the submitted session
+	inFlightBytes       atomic.Int64 // reserved memory budget of raw session files
+	metadata            map[string]string
+	packErr             error
+	deadLetterDir       string      // dead letter entry of the resubmitted session, removed after the upload
+	notEncrypted        atomic.Bool // encryption failed and session files are uploaded as is despite the key
+	processErr          error
 }
 
 func (t *Task) SetMob(mob []byte, index int, tp FileType) {
-	t.index = index
-	if tp == DOM {
+	switch tp {
+	case DOM:
 		t.domRaw = mob
-	} else {
+		t.index = index
+	case CANVAS:
+		t.canvasRaw = mob
+	default:
 		t.devRaw = mob
 	}
 }
 
 func (t *Task) Mob(tp FileType) ([]byte, int) {
-	if tp == DOM {
+	switch tp {
+	case DOM:
 		return t.domRaw, t.index
+	case CANVAS:
+		return t.canvasRaw, -1
+	default:
+		return t.devRaw, -1
+	}
+}
+
+// setPacked saves the packed not split file (devtools, canvas or short DOM) with its raw size
+func (t *Task) setPacked(tp FileType, buf *bytes.Buffer, rawSize float64) {
+	switch tp {
+	case DOM:
+		t.doms = []*bytes.Buffer{buf}
+		t.domRawSizes = []float64{rawSize}
+	case CANVAS:
+		t.canvas = buf
+		t.canvasRawSize = rawSize
+	default:
+		t.dev = buf
+		t.devRawSize = rawSize
 	}
-	return t.devRaw, -1
 }
 
 type Storage struct {
 	cfg           *config.Config
 	log           logger.Logger
 	objStorage    objectstorage.ObjectStorage
+	keyTemplate   string
+	devFileName   string // suffix of the devtools file name on disk
+	devKey        string // suffix of the devtools object key
+	formatVersion string // mob format version of uploaded files
 	startBytes    []byte
 	splitTime     uint64
+	compression   objectstorage.CompressionType
+	compressions  map[FileType]objectstorage.CompressionType // overrides of the default compression by file type
+	storageClass  map[FileType]objectstorage.StorageClass
+	acl           objectstorage.ACL
+	contentType   map[FileType]string
+	sampleRate    float64
+	gzipLevel     int
+	gzipBlockSize int
+	gzipBlocks    int
+	zstdDict      []byte
+	zstdDictID    uint32
 	processorPool pool.WorkerPool
 	uploaderPool  pool.WorkerPool
+	mirrorPool    pool.WorkerPool // nil if mirroring is disabled or synchronous
+	mirror        objectstorage.ObjectStorage
+	cold          objectstorage.ObjectStorage // storage of DOM parts after the start part, nil if not configured
+	source        SourceReader
+	paths         PathResolver // local paths of session files
+	batcher       *batcher
+	splitStats    *splitStats
+	processors    []Processor
+	mu            sync.RWMutex
+	closed        bool
+	pending       atomic.Int64 // number of submitted but not uploaded tasks
+	flushes       *flushState
+	breaker       *breaker // nil if disabled
+	health        *healthState
+	inFlight      *semaphore.Weighted // limits raw session files in memory, nil if not limited
+	uploadSlots   *semaphore.Weighted // limits object uploads in progress across all workers
+	packSlots     *semaphore.Weighted // limits compressions and encryptions in progress across all workers
+	dedup         *dedupIndex         // checksums of deduplicated objects, nil if deduplication is disabled
+	limiter       *rate.Limiter       // limits accepted sessions, nil if not limited
+	notifier      *uploadNotifier     // calls the uploaded callback, nil if it isn't set
+	retrying      sync.Map            // dead letter entries of resubmitted sessions in progress
+	inFlightBytes atomic.Int64
 }
 
-func New(cfg *config.Config, log logger.Logger, objStorage objectstorage.ObjectStorage) (*Storage, error) {
+// New creates the storage, paths resolves local paths of session files, nil keeps them in FS_DIR named by session ids.
+// Project ids passed to paths are set only if PROJECT_LOOKUP is enabled.
+func New(cfg *config.Config, log logger.Logger, objStorage objectstorage.ObjectStorage, paths PathResolver, processors ...Processor) (*Storage, error) {
 	switch {
 	case cfg == nil:
 		return nil, fmt.Errorf("config is empty")
 	case objStorage == nil:
 		return nil, fmt.Errorf("object storage is empty")
 	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("wrong config: %s", err)
+	}
 	s := &Storage{
 		cfg:        cfg,
 		log:        log,
 		objStorage: objStorage,
 		startBytes: make([]byte, cfg.FileSplitSize),
 		splitTime:  parseSplitTime(cfg.FileSplitTime),
+		processors: processors,
+		flushes:    newFlushState(),
+		health:     newHealthState(),
+		paths:      paths,
+	}
+	if s.paths == nil {
+		s.paths = &defaultPathResolver{s: s}
+	}
+	source, err := newSource(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s.source = source
+	switch cfg.KeyScheme {
+	case "", keySchemeV1, keySchemeV2:
+	default:
+		return nil, fmt.Errorf("unknown object key scheme: %s", cfg.KeyScheme)
+	}
+	switch cfg.LayoutMode {
+	case "", layoutSplit, layoutIndexed:
+	default:
+		return nil, fmt.Errorf("unknown object layout: %s", cfg.LayoutMode)
+	}
+	keyTemplate, err := parseKeyTemplate(cfg.KeyTemplate)
+	if err != nil {
+		return nil, err
+	}
+	s.keyTemplate = keyTemplate
+	s.formatVersion = cfg.FormatVersion
+	if s.formatVersion == "" {
+		s.formatVersion = mobFormatVersion
+	}
+	if s.devFileName, s.devKey, err = parseDevToolsNames(cfg.DevToolsFileName, cfg.DevToolsObjectKey, s.formatVersion); err != nil {
+		return nil, err
+	}
+	if err := validateTags(cfg.Tags); err != nil {
+		return nil, err
+	}
+	domClass, err := objectstorage.ParseStorageClass(cfg.StorageClass)
+	if err != nil {
+		return nil, err
+	}
+	devClass := domClass
+	if cfg.DevtoolsStorageClass != "" {
+		if devClass, err = objectstorage.ParseStorageClass(cfg.DevtoolsStorageClass); err != nil {
+			return nil, err
+		}
+	}
+	s.storageClass = map[FileType]objectstorage.StorageClass{DOM: domClass, DEV: devClass, CANVAS: devClass}
+	if s.acl, err = objectstorage.ParseACL(cfg.ObjectACL); err != nil {
+		return nil, err
+	}
+	if s.acl == objectstorage.PublicReadACL {
+		log.Warn(context.Background(), "session files are uploaded with public-read acl, they are readable without authentication")
+	}
+	s.contentType = map[FileType]string{DOM: cfg.DomContentType, DEV: cfg.DevtoolsContentType, CANVAS: defaultContentType}
+	for tp, contentType := range s.contentType {
+		if contentType == "" {
+			s.contentType[tp] = defaultContentType
+			continue
+		}
+		if _, _, err := mime.ParseMediaType(contentType); err != nil {
+			return nil, fmt.Errorf("wrong %s content type: %s, err: %s", tp.String(), contentType, err)
+		}
+	}
+	compression, err := objectstorage.ParseCompressionType(cfg.CompressionAlgo)
+	if err != nil {
+		log.Warn(context.Background(), "%s, session files will be uploaded without compression", err)
+	}
+	s.compression = compression
+	if s.compressions, err = parseFileCompressions(cfg.FileCompression); err != nil {
+		return nil, err
+	}
+	s.gzipLevel = cfg.GzipLevel
+	if s.gzipLevel < gzip.HuffmanOnly || s.gzipLevel > gzip.BestCompression {
+		log.Warn(context.Background(), "wrong gzip compression level: %d, using best speed", s.gzipLevel)
+		s.gzipLevel = gzip.BestSpeed
+	}
+	if s.gzipBlockSize, s.gzipBlocks, err = parseGzipConcurrency(cfg.GzipBlockSize, cfg.GzipBlocks); err != nil {
+		return nil, err
+	}
+	usesGzip := s.compression == objectstorage.Gzip
+	for _, compression := range s.compressions {
+		usesGzip = usesGzip || compression == objectstorage.Gzip
+	}
+	if usesGzip {
+		log.Info(context.Background(), "gzip block size: %d, parallel blocks: %d", s.gzipBlockSize, s.gzipBlocks)
+	}
+	switch cfg.EncryptionMode {
+	case "", encryptionCBC:
+	case encryptionGCM:
+		if !gcmSupported {
+			return nil, fmt.Errorf("%s encryption mode isn't supported in this edition", cfg.EncryptionMode)
+		}
+	default:
+		return nil, fmt.Errorf("unknown encryption mode: %s", cfg.EncryptionMode)
+	}
+	if cfg.GzipAdaptiveLevel && cfg.GzipSmallFileSize > cfg.GzipLargeFileSize {
+		return nil, fmt.Errorf("gzip small file size %d is bigger than large file size %d", cfg.GzipSmallFileSize, cfg.GzipLargeFileSize)
+	}
+	if cfg.ZstdDictPath != "" {
+		if s.zstdDict, s.zstdDictID, err = loadZstdDictionary(cfg.ZstdDictPath); err != nil {
+			return nil, err
+		}
+		if compression != objectstorage.Zstd {
+			log.Warn(context.Background(), "zstd dictionary is set, but session files are compressed with %s", compression)
+		}
+	}
+	s.sampleRate = cfg.SampleRate
+	if s.sampleRate <= 0 || s.sampleRate > 1 {
+		log.Warn(context.Background(), "wrong sample rate: %f, all sessions will be stored", s.sampleRate)
+		s.sampleRate = 1
+	}
+	log.Info(context.Background(), "session files compression algorithm: %s", compression)
+	workers := cfg.Workers
+	if workers < 1 {
+		log.Warn(context.Background(), "wrong number of workers: %d, using 1", workers)
+		workers = 1
+	}
+	if cfg.DryRun {
+		log.Warn(context.Background(), "dry run mode is enabled, session files will not be uploaded")
+		s.objStorage = newDryRunStorage(objStorage, log)
+	}
+	if cfg.BatchUploads {
+		s.batcher = newBatcher(s)
+	}
+	if cfg.BreakerErrorRate > 0 {
+		if cfg.BreakerErrorRate > 1 || cfg.BreakerWindow <= 0 {
+			return nil, fmt.Errorf("wrong circuit breaker config, error rate: %f, window: %s", cfg.BreakerErrorRate, cfg.BreakerWindow)
+		}
+		s.breaker = newBreaker(cfg.BreakerErrorRate, cfg.BreakerMinRequests, cfg.BreakerWindow, cfg.BreakerOpenTimeout)
+	}
+	if cfg.MaxInFlightBytes > 0 {
+		s.inFlight = semaphore.NewWeighted(cfg.MaxInFlightBytes)
+	}
+	if cfg.MaxConcurrentUploads < 0 {
+		return nil, fmt.Errorf("wrong max concurrent uploads: %d", cfg.MaxConcurrentUploads)
+	}
+	maxUploads := cfg.MaxConcurrentUploads
+	if maxUploads == 0 {
+		// Each uploader worker puts DOM, devtools and canvas files at the same time
+		maxUploads = workers * len(fileTypes)
+	}
+	s.uploadSlots = semaphore.NewWeighted(int64(maxUploads))
+	if cfg.MaxCompressionConcurrency < 0 {
+		return nil, fmt.Errorf("wrong max compression concurrency: %d", cfg.MaxCompressionConcurrency)
+	}
+	maxCompressions := cfg.MaxCompressionConcurrency
+	if maxCompressions == 0 {
+		maxCompressions = runtime.GOMAXPROCS(0)
+	}
+	s.packSlots = semaphore.NewWeighted(int64(maxCompressions))
+	if cfg.Dedup {
+		if cfg.DedupIndexSize <= 0 {
+			return nil, fmt.Errorf("wrong dedup index size: %d", cfg.DedupIndexSize)
+		}
+		s.dedup = newDedupIndex(cfg.DedupIndexSize)
+	}
+	queueCapacity := cfg.QueueCapacity
+	if queueCapacity <= 0 {
+		queueCapacity = workers
+	}
+	if cfg.UploadQueueCapacity < 0 {
+		return nil, fmt.Errorf("wrong upload queue capacity: %d", cfg.UploadQueueCapacity)
+	}
+	uploadQueueCapacity := cfg.UploadQueueCapacity
+	if uploadQueueCapacity == 0 {
+		uploadQueueCapacity = workers
+	}
+	switch cfg.QueueFullPolicy {
+	case "", queueBlock, queueReject, queueDropOldest:
+	default:
+		return nil, fmt.Errorf("unknown queue full policy: %s", cfg.QueueFullPolicy)
+	}
+	switch cfg.RateLimitPolicy {
+	case "", queueBlock, queueReject:
+	default:
+		return nil, fmt.Errorf("unknown rate limit policy: %s", cfg.RateLimitPolicy)
+	}
+	if cfg.UploadsPerSecond > 0 {
+		burst := cfg.UploadsBurst
+		if burst < 1 {
+			burst = 1
+		}
+		s.limiter = rate.NewLimiter(rate.Limit(cfg.UploadsPerSecond), burst)
+	}
+	if s.cold, err = newColdStorage(cfg); err != nil {
+		return nil, err
+	}
+	if s.cold != nil {
+		if cfg.DryRun {
+			s.cold = newDryRunStorage(s.cold, log)
+		}
+		s.objStorage = newTieredStorage(s.objStorage, s.cold)
+	}
+	if s.mirror, err = newMirror(cfg); err != nil {
+		return nil, err
+	}
+	if s.mirror != nil && cfg.DryRun {
+		s.mirror = newDryRunStorage(s.mirror, log)
+	}
+	s.processorPool = pool.NewPool(workers, queueCapacity,
+		newBusyWorkers(processorPool, workers).wrap(s.recoverWorker(processorPool, s.doCompression)))
+	s.uploaderPool = pool.NewPool(workers, uploadQueueCapacity,
+		newBusyWorkers(uploaderPool, workers).wrap(s.recoverWorker(uploaderPool, s.uploadSession)))
+	if s.mirror != nil && cfg.MirrorAsync {
+		s.mirrorPool = pool.NewPool(workers, workers, newBusyWorkers(mirrorPool, workers).wrap(s.recoverWorker(mirrorPool, s.mirrorUploaded)))
+	}
+	if cfg.SplitStatsInterval > 0 {
+		s.splitStats = newSplitStats(s)
 	}
-	s.processorPool = pool.NewPool(1, 1, s.doCompression)
-	s.uploaderPool = pool.NewPool(1, 1, s.uploadSession)
 	return s, nil
 }
 
@@ -107,81 +483,264 @@ func parseSplitTime(splitTime time.Duration) uint64 {
 }
 
 func (s *Storage) Wait() {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return
+	}
 	s.processorPool.Pause()
 	s.uploaderPool.Pause()
+	if s.mirrorPool != nil {
+		s.mirrorPool.Pause()
+	}
+	if s.batcher != nil {
+		s.batcher.flush()
+	}
+}
+
+func (s *Storage) isClosed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.closed
+}
+
+// Close stops accepting new sessions and waits until all already submitted sessions are uploaded
+func (s *Storage) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.processorPool.Stop()
+		s.uploaderPool.Stop()
+		if s.mirrorPool != nil {
+			s.mirrorPool.Stop()
+		}
+		if s.batcher != nil {
+			s.batcher.stop()
+		}
+		if s.notifier != nil {
+			s.notifier.stop()
+		}
+		if s.splitStats != nil {
+			s.splitStats.stop()
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("storage closing interrupted: %s, not drained tasks: %d", ctx.Err(), s.pending.Load())
+	}
 }
 
 func (s *Storage) Process(ctx context.Context, msg *messages.SessionEnd) (err error) {
-	// Generate file path
+	// Malformed messages are rejected before building file paths from the session id
+	switch {
+	case msg == nil:
+		metrics.IncreaseStorageInvalidMessages("nil")
+		return fmt.Errorf("%w: message is nil", ErrInvalidMessage)
+	case msg.Batch() == nil || msg.SessionID() == 0:
+		metrics.IncreaseStorageInvalidMessages("session_id")
+		return fmt.Errorf("%w: session id is 0", ErrInvalidMessage)
+	}
+	if s.isClosed() {
+		return ErrStorageClosed
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.waitRateLimit(ctx); err != nil {
+		return err
+	}
+
 	sessionID := strconv.FormatUint(msg.SessionID(), 10)
-	filePath := s.cfg.FSDir + "/" + sessionID
+	projectID := projectIDOf(ctx)
 
 	// Prepare sessions
 	newTask := &Task{
-		ctx:         ctx,
-		id:          sessionID,
-		key:         msg.EncryptionKey,
-		compression: s.setTaskCompression(ctx),
+		ctx:          ctx,
+		id:           sessionID,
+		key:          msg.EncryptionKey,
+		base:         s.projectKeyBase(projectID, msg.SessionID(), msg.Timestamp),
+		timestamp:    msg.Timestamp,
+		paths:        s.sessionPaths(projectID, msg.SessionID()),
+		compression:  s.compression,
+		compressions: s.compressions,
+		startedAt:    time.Now(),
+	}
+	if !s.isSampled(ctx, sessionID) {
+		metrics.IncreaseStorageSampledOutSessions()
+		if s.cfg.DeleteAfterUpload {
+			s.deleteLocalFiles(newTask)
+		}
+		return nil
+	}
+	if s.cfg.KeyCollisionCheck {
+		s.checkKeyCollision(newTask, msg.SessionID(), msg.Timestamp)
+	}
+	if err := s.acquireInFlight(newTask); err != nil {
+		return err
 	}
+	// Budget of submitted sessions is released after compression or by taskDone
+	defer func() {
+		if err != nil {
+			s.releaseInFlight(newTask)
+		}
+	}()
+	var domErr, devErr, canvasErr error
 	wg := &sync.WaitGroup{}
 	wg.Add(2)
 	go func() {
-		if prepErr := s.prepareSession(filePath, DOM, newTask); prepErr != nil {
-			err = fmt.Errorf("prepareSession DOM err: %s", prepErr)
+		if prepErr := s.prepareSession(DOM, newTask); prepErr != nil {
+			domErr = fmt.Errorf("prepareSession DOM err: %w", prepErr)
 		}
 		wg.Done()
 	}()
+	if s.cfg.ProcessDevTools {
+		wg.Add(1)
+		go func() {
+			if prepErr := s.prepareSession(DEV, newTask); prepErr != nil {
+				devErr = fmt.Errorf("prepareSession DEV err: %w", prepErr)
+			}
+			wg.Done()
+		}()
+	}
 	go func() {
-		if prepErr := s.prepareSession(filePath, DEV, newTask); prepErr != nil {
-			err = fmt.Errorf("prepareSession DEV err: %s", prepErr)
+		if prepErr := s.prepareSession(CANVAS, newTask); prepErr != nil {
+			canvasErr = fmt.Errorf("prepareSession CANVAS err: %w", prepErr)
 		}
 		wg.Done()
 	}()
 	wg.Wait()
-	if err != nil {
-		if strings.Contains(err.Error(), "big file") {
-			s.log.Warn(ctx, "can't process session: %s", err)
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err = errors.Join(domErr, devErr, canvasErr); err != nil {
+		var tooLarge *ErrFileTooLarge
+		if errors.As(err, &tooLarge) {
+			s.releaseInFlight(newTask)
 			metrics.IncreaseStorageTotalSkippedSessions()
+			s.recordTotalDuration(newTask, "skipped")
 			return nil
 		}
 		return err
 	}
 
-	s.processorPool.Submit(newTask)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return ErrStorageClosed
+	}
+	newTask.enqueuedAt = time.Now()
+	s.taskSubmitted(newTask)
+	switch s.cfg.QueueFullPolicy {
+	case queueReject:
+		if !s.processorPool.TrySubmit(newTask) {
+			s.taskDone(newTask)
+			metrics.IncreaseStorageQueueRejections(queueReject)
+			return ErrQueueFull
+		}
+	case queueDropOldest:
+		if dropped, ok := s.processorPool.SubmitDropOldest(newTask); ok {
+			droppedTask := dropped.(*Task)
+			s.taskDone(droppedTask)
+			metrics.IncreaseStorageQueueRejections(queueDropOldest)
+			s.recordTotalDuration(droppedTask, "dropped")
+			s.log.Warn(droppedTask.ctx, "session dropped from the full queue")
+		}
+	default:
+		s.processorPool.Submit(newTask)
+	}
 	return nil
 }
 
-func (s *Storage) prepareSession(path string, tp FileType, task *Task) error {
+func (s *Storage) prepareSession(tp FileType, task *Task) error {
+	if err := task.ctx.Err(); err != nil {
+		return err
+	}
+
+	// Big DOM files are compressed and uploaded on the fly without reading into memory
+	if tp == DOM && s.shouldStream(task, task.paths[DOM]) {
+		task.domPath = task.paths[DOM]
+		return nil
+	}
+
 	// Open session file
 	startRead := time.Now()
-	mob, index, err := s.openSession(task.ctx, path, tp)
+	mob, index, err := s.openSession(task.ctx, task.paths[tp], tp)
 	if err != nil {
+		// DevTools and canvas files are optional
+		if tp != DOM && errors.Is(err, os.ErrNotExist) {
+			if tp == DEV {
+				metrics.IncreaseStorageDevtoolsMissing()
+			}
+			return nil
+		}
+		// Oversized devtools or canvas file is skipped alone if oversized files are uploaded
+		var tooLarge *ErrFileTooLarge
+		if tp != DOM && errors.As(err, &tooLarge) && !s.cfg.DropOversized {
+			return nil
+		}
+		// Empty file is skipped to not upload useless objects
+		if errors.Is(err, errSmallFile) {
+			metrics.IncreaseStorageEmptySessions(tp.String())
+			s.log.Warn(task.ctx, "%s file is skipped: %s", tp.String(), err)
+			return nil
+		}
 		return err
 	}
 
-	metrics.RecordSessionReadDuration(float64(time.Now().Sub(startRead).Milliseconds()), tp.String())
-	metrics.RecordSessionSize(float64(len(mob)), tp.String())
+	project, sdk := s.metricAttributes(task.ctx)
+	metrics.RecordSessionReadDuration(float64(time.Now().Sub(startRead).Milliseconds()), tp.String(), project, sdk)
+	metrics.RecordSessionSize(float64(len(mob)), tp.String(), project, sdk)
 
 	// Put opened session file into task struct
 	task.SetMob(mob, index, tp)
 	return nil
 }
 
+// ErrFileTooLarge is returned for session files bigger than MaxFileSize, such sessions are skipped
+type ErrFileTooLarge struct {
+	Size int64
+	Max  int64
+}
+
+func (e *ErrFileTooLarge) Error() string {
+	return fmt.Sprintf("file is too large, size: %d, max: %d", e.Size, e.Max)
+}
+
 func (s *Storage) openSession(ctx context.Context, filePath string, tp FileType) ([]byte, int, error) {
-	if tp == DEV {
-		filePath += "devtools"
-	}
 	// Check file size before download into memory
-	info, err := os.Stat(filePath)
-	if err == nil && info.Size() > s.cfg.MaxFileSize {
-		metrics.RecordSkippedSessionSize(float64(info.Size()), tp.String())
-		return nil, -1, fmt.Errorf("big file, size: %d", info.Size())
+	size, err := s.source.Size(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, -1, err
+	}
+	if err == nil && size > s.cfg.MaxFileSize {
+		metrics.RecordSkippedSessionSize(float64(size), tp.String())
+		metrics.IncreaseStorageBigFilesSkipped(tp.String())
+		s.log.Warn(logger.WithFields(ctx, map[string]interface{}{"fileType": tp.String(), "fileSize": size}),
+			"%s file is skipped, max file size: %d", tp.String(), s.cfg.MaxFileSize)
+		return nil, -1, &ErrFileTooLarge{Size: size, Max: s.cfg.MaxFileSize}
 	}
 	// Read file into memory
-	raw, err := os.ReadFile(filePath)
+	raw, err := s.readFile(ctx, filePath, tp)
 	if err != nil {
 		return nil, -1, err
 	}
+	if int64(len(raw)) < s.cfg.MinFileSize {
+		return nil, -1, fmt.Errorf("%w, size: %d", errSmallFile, len(raw))
+	}
+	// Compressed file can't be sorted and split
+	if s.cfg.DetectPrecompressed && isGzip(raw) {
+		return raw, -1, nil
+	}
 	if !s.cfg.UseSort {
 		return raw, -1, nil
 	}
@@ -190,7 +749,8 @@ func (s *Storage) openSession(ctx context.Context, filePath string, tp FileType)
 	if err != nil {
 		return nil, -1, fmt.Errorf("can't sort session, err: %s", err)
 	}
-	metrics.RecordSessionSortDuration(float64(time.Now().Sub(start).Milliseconds()), tp.String())
+	project, sdk := s.metricAttributes(ctx)
+	metrics.RecordSessionSortDuration(float64(time.Now().Sub(start).Milliseconds()), tp.String(), project, sdk)
 	return mob, index, nil
 }
 
@@ -206,236 +766,527 @@ func (s *Storage) sortSessionMessages(ctx context.Context, tp FileType, raw []by
 		}
 	}
 	mob, index := messages.MergeMessages(raw, messages.SortMessages(unsortedMessages), tp == DOM, s.splitTime)
+	if tp == DOM && index == -1 && s.splitTime > 0 {
+		index = s.sizeSplitIndex(mob)
+	}
 	return mob, index, nil
 }
 
-func (s *Storage) setTaskCompression(ctx context.Context) objectstorage.CompressionType {
-	switch s.cfg.CompressionAlgo {
-	case "none":
-		return objectstorage.NoCompression
-	case "gzip":
-		return objectstorage.Gzip
-	case "brotli":
-		return objectstorage.Brotli
-	case "zstd":
-		return objectstorage.Zstd
-	default:
-		s.log.Warn(ctx, "unknown compression algorithm: %s", s.cfg.CompressionAlgo)
-		return objectstorage.NoCompression
+func (s *Storage) packSession(task *Task, tp FileType) error {
+	// Streamed DOM file will be compressed during upload
+	if tp == DOM && task.domPath != "" {
+		return nil
 	}
-}
 
-func (s *Storage) packSession(task *Task, tp FileType) {
 	// Prepare mob file
 	mob, index := task.Mob(tp)
 
-	// For devtools of short sessions
-	if tp == DEV || index == -1 {
-		// Compression
-		start := time.Now()
-		data := s.compress(task.ctx, mob, task.compression)
-		metrics.RecordSessionCompressDuration(float64(time.Now().Sub(start).Milliseconds()), tp.String())
-
-		// Encryption
-		start = time.Now()
-		result := s.encryptSession(task.ctx, data.Bytes(), task.key)
-		metrics.RecordSessionEncryptionDuration(float64(time.Now().Sub(start).Milliseconds()), tp.String())
+	// Session without devtools or canvas file or skipped empty file
+	if mob == nil {
+		return nil
+	}
 
+	// For devtools, canvas and DOM of short sessions
+	if tp != DOM || index == -1 {
+		compression := task.compressionOf(tp)
+		if s.cfg.DetectPrecompressed && isGzip(mob) {
+			task.setPrecompressed(tp)
+			metrics.IncreaseStorageRecompressionSkipped(tp.String())
+			compression = objectstorage.NoCompression
+		}
+		result, compressDur, encryptDur, err := s.packPart(task, tp, mob, compression)
+		if err != nil {
+			metrics.IncreaseStorageCompressionErrors(tp.String())
+			return err
+		}
+		project, sdk := s.metricAttributes(task.ctx)
+		metrics.RecordSessionCompressDuration(float64(compressDur), tp.String(), project, sdk)
+		if task.encrypted() {
+			metrics.RecordSessionEncryptionDuration(float64(encryptDur), tp.String(), project, sdk)
+		}
+		task.setPacked(tp, result, float64(len(mob)))
 		if tp == DOM {
-			task.doms = bytes.NewBuffer(result)
-			task.domsRawSize = float64(len(mob))
-		} else {
-			task.dev = bytes.NewBuffer(result)
-			task.devRawSize = float64(len(mob))
+			s.recordSplit(int64(len(mob)))
 		}
-		return
+		return nil
 	}
 
-	// Prepare two workers for two parts (start and end) of dom file
+	// Prepare a separate worker for each part of dom file
+	parts := s.splitDom(mob, index)
+	task.doms = make([]*bytes.Buffer, len(parts))
+	task.domRawSizes = make([]float64, len(parts))
+	compressDurs := make([]int64, len(parts))
+	encryptDurs := make([]int64, len(parts))
+	errs := make([]error, len(parts))
 	wg := &sync.WaitGroup{}
-	wg.Add(2)
-	var firstPart, secondPart, firstEncrypt, secondEncrypt int64
+	wg.Add(len(parts))
+	for i, part := range parts {
+		go func(i int, part []byte) {
+			task.doms[i], compressDurs[i], encryptDurs[i], errs[i] = s.packPart(task, DOM, part, task.compressionOf(DOM))
+			task.domRawSizes[i] = float64(len(part))
+			wg.Done()
+		}(i, part)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		metrics.IncreaseStorageCompressionErrors(tp.String())
+		return err
+	}
 
-	// DomStart part
-	go func() {
-		// Compression
-		start := time.Now()
-		data := s.compress(task.ctx, mob[:index], task.compression)
-		firstPart = time.Since(start).Milliseconds()
+	// Record metrics
+	var compressDur, encryptDur int64
+	sizes := make([]int64, len(parts))
+	for i := range parts {
+		compressDur += compressDurs[i]
+		encryptDur += encryptDurs[i]
+		sizes[i] = int64(len(parts[i]))
+	}
+	s.recordSplit(sizes...)
+	project, sdk := s.metricAttributes(task.ctx)
+	if task.encrypted() {
+		metrics.RecordSessionEncryptionDuration(float64(encryptDur), tp.String(), project, sdk)
+	}
+	metrics.RecordSessionCompressDuration(float64(compressDur), tp.String(), project, sdk)
+	return nil
+}
 
-		// Encryption
-		start = time.Now()
-		task.doms = bytes.NewBuffer(s.encryptSession(task.ctx, data.Bytes(), task.key))
-		firstEncrypt = time.Since(start).Milliseconds()
+// packPart compresses and encrypts one part of the mob file, returns the result with compression and encryption durations.
+// Parts of all sessions are packed in parallel only up to MaxCompressionConcurrency.
+func (s *Storage) packPart(task *Task, tp FileType, data []byte, compression objectstorage.CompressionType) (*bytes.Buffer, int64, int64, error) {
+	start := time.Now()
+	if err := s.packSlots.Acquire(task.ctx, 1); err != nil {
+		return nil, 0, 0, err
+	}
+	defer s.packSlots.Release(1)
+	metrics.RecordCompressionSlotWaitDuration(float64(time.Since(start).Milliseconds()), tp.String())
 
-		// Record dom start raw size
-		task.domsRawSize = float64(index)
+	// Compression
+	start = time.Now()
+	compressed, err := s.compress(data, compression)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	compressDur := time.Since(start).Milliseconds()
 
-		// Finish task
-		wg.Done()
-	}()
+	// Encryption
+	start = time.Now()
+	encrypted, err := s.encryptSession(task, compressed.Bytes())
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("can't encrypt data: %s", err)
+	}
+	return bytes.NewBuffer(encrypted), compressDur, time.Since(start).Milliseconds(), nil
+}
 
-	// DomEnd part
-	go func() {
-		// Compression
-		start := time.Now()
-		data := s.compress(task.ctx, mob[index:], task.compression)
-		secondPart = time.Since(start).Milliseconds()
+// splitDom splits the sorted DOM file into the start part (before split index) and the end part. If more than two
+// splits are allowed, the end part is additionally cut into chunks of at least FileSplitSize bytes at message
+// boundaries, the last chunk takes the rest.
+func (s *Storage) splitDom(mob []byte, index int) [][]byte {
+	parts := [][]byte{mob[:index]}
+	rest := mob[index:]
+	for len(parts) < s.cfg.MaxFileSplits-1 && s.cfg.FileSplitSize > 0 && len(rest) > s.cfg.FileSplitSize {
+		end := nextMessageBoundary(rest, s.cfg.FileSplitSize)
+		if end < 0 || end >= len(rest) {
+			break
+		}
+		parts = append(parts, rest[:end])
+		rest = rest[end:]
+	}
+	return append(parts, rest)
+}
 
-		// Encryption
-		start = time.Now()
-		task.dome = bytes.NewBuffer(s.encryptSession(task.ctx, data.Bytes(), task.key))
-		secondEncrypt = time.Since(start).Milliseconds()
+// sortedHeaderSize is the size of the index placeholder written before messages of the sorted mob file
+const sortedHeaderSize = 8
 
-		// Record dom end raw size
-		task.domeRawSize = float64(len(mob) - index)
+// sizeSplitIndex returns the split index for sorted DOM files without the time boundary (sessions shorter than
+// FILE_SPLIT_TIME): the end of the first message after FileSplitSize bytes, -1 if the file is small or can't be decoded
+func (s *Storage) sizeSplitIndex(mob []byte) int {
+	if s.cfg.FileSplitSize <= sortedHeaderSize || len(mob) <= s.cfg.FileSplitSize {
+		return -1
+	}
+	end := nextMessageBoundary(mob[sortedHeaderSize:], s.cfg.FileSplitSize-sortedHeaderSize)
+	if end < 0 || sortedHeaderSize+end >= len(mob) {
+		return -1
+	}
+	return sortedHeaderSize + end
+}
 
-		// Finish task
-		wg.Done()
-	}()
-	wg.Wait()
+// nextMessageBoundary returns the end of the first message which ends at or after the given offset, the data must
+// start with a message (sorted mob files don't have message indexes). Returns -1 if the data can't be decoded.
+func nextMessageBoundary(data []byte, offset int) int {
+	reader := messages.NewBytesReader(data)
+	for int(reader.Pointer()) < offset {
+		msgType, err := reader.ReadUint()
+		if err != nil {
+			return -1
+		}
+		if _, err := messages.ReadMessage(msgType, reader); err != nil {
+			return -1
+		}
+	}
+	return int(reader.Pointer())
+}
 
-	// Record metrics
-	metrics.RecordSessionEncryptionDuration(float64(firstEncrypt+secondEncrypt), tp.String())
-	metrics.RecordSessionCompressDuration(float64(firstPart+secondPart), tp.String())
+// Encryption modes of session files
+const (
+	encryptionCBC  = "cbc"  // AES-CBC with the IV from the session's key, see EncryptData
+	encryptionGCM  = "gcm"  // AES-256-GCM with the HKDF derived key
+	encryptionNone = "none" // object metadata value of not encrypted files
+)
+
+// encryptionMetadataKey is the object metadata key with the encryption mode of the stored file
+const encryptionMetadataKey = "encryption"
+
+// encryptionOf returns the encryption mode of the session files, empty if they aren't encrypted
+func (s *Storage) encryptionOf(task *Task) string {
+	if !task.encrypted() {
+		return ""
+	}
+	if s.cfg.EncryptionMode == "" {
+		return encryptionCBC
+	}
+	return s.cfg.EncryptionMode
 }
 
-func (s *Storage) encryptSession(ctx context.Context, data []byte, encryptionKey string) []byte {
-	if encryptionKey == "" {
+// encryptSession encrypts the session file with the configured mode, GCM errors fail the session. CBC errors are
+// logged and the session is uploaded not encrypted, without encryption metadata.
+func (s *Storage) encryptSession(task *Task, data []byte) ([]byte, error) {
+	if task.key == "" {
 		// no encryption, just return the same data
-		return data
+		return data, nil
+	}
+	if s.cfg.EncryptionMode == encryptionGCM {
+		return encryptGCM(data, []byte(task.key), task.id)
 	}
-	encryptedData, err := EncryptData(data, []byte(encryptionKey))
+	encryptedData, err := EncryptData(data, []byte(task.key))
 	if err != nil {
-		s.log.Error(ctx, "can't encrypt data: %s", err)
+		s.log.Error(task.ctx, "can't encrypt data: %s", err)
+		task.notEncrypted.Store(true)
 		encryptedData = data
 	}
-	return encryptedData
+	return encryptedData, nil
 }
 
-func (s *Storage) compress(ctx context.Context, data []byte, compressionType objectstorage.CompressionType) *bytes.Buffer {
+// encrypted reports whether the session files are actually encrypted, it's known only after packing
+func (t *Task) encrypted() bool {
+	return t.key != "" && !t.notEncrypted.Load()
+}
+
+// compress returns the whole compressed data or an error, truncated data is never returned
+func (s *Storage) compress(data []byte, compressionType objectstorage.CompressionType) (*bytes.Buffer, error) {
+	if compressionType == objectstorage.NoCompression {
+		// no compression, just return the same data
+		return bytes.NewBuffer(data), nil
+	}
+	out := getBuffer()
+	w, err := s.newCompressor(out, compressionType, int64(len(data)))
+	if err != nil {
+		putBuffer(out)
+		return nil, fmt.Errorf("can't create %s compressor: %s", compressionType, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		putBuffer(out)
+		return nil, fmt.Errorf("can't write session data to %s compressor: %s", compressionType, err)
+	}
+	if err := w.Close(); err != nil {
+		putBuffer(out)
+		return nil, fmt.Errorf("can't close %s compressor: %s", compressionType, err)
+	}
+	return out, nil
+}
+
+// newCompressor returns the writer of the compressed data, size of the original data is used to choose the gzip level
+func (s *Storage) newCompressor(w io.Writer, compressionType objectstorage.CompressionType, size int64) (io.WriteCloser, error) {
 	switch compressionType {
 	case objectstorage.Gzip:
-		return s.compressGzip(ctx, data)
+		return s.newGzipWriter(w, s.gzipLevelFor(size))
 	case objectstorage.Brotli:
-		return s.compressBrotli(ctx, data)
+		return brotli.NewWriterOptions(w, brotli.WriterOptions{Quality: brotli.DefaultCompression}), nil
 	case objectstorage.Zstd:
-		return s.compressZstd(ctx, data)
+		if s.zstdDict != nil {
+			return zstd.NewWriter(w, zstd.WithEncoderDict(s.zstdDict))
+		}
+		return zstd.NewWriter(w)
 	default:
-		// no compression, just return the same data
-		return bytes.NewBuffer(data)
+		return nil, fmt.Errorf("unknown compression type: %s", compressionType)
 	}
 }
 
-func (s *Storage) compressGzip(ctx context.Context, data []byte) *bytes.Buffer {
-	zippedMob := new(bytes.Buffer)
-	z, _ := gzip.NewWriterLevel(zippedMob, gzip.DefaultCompression)
-	if _, err := z.Write(data); err != nil {
-		s.log.Error(ctx, "can't write session data to compressor: %s", err)
+func (s *Storage) uploadSession(payload interface{}) {
+	task := payload.(*Task)
+	batched := false
+	defer func() {
+		if !batched {
+			s.taskDone(task)
+		}
+	}()
+	if err := task.ctx.Err(); err != nil {
+		s.log.Warn(task.ctx, "session processing cancelled: %s", err)
+		metrics.IncreaseStorageTotalFailedUploads()
+		s.recordTotalDuration(task, "cancelled")
+		return
 	}
-	if err := z.Close(); err != nil {
-		s.log.Error(ctx, "can't close compressor: %s", err)
+	// Corrupted session files aren't uploaded or saved to the dead letter dir
+	if task.packErr != nil {
+		s.log.Error(task.ctx, "can't pack session: %s", task.packErr)
+		metrics.IncreaseStorageTotalFailedUploads()
+		s.recordTotalDuration(task, "failed")
+		s.releaseBuffers(task)
+		return
+	}
+	if task.processErr != nil {
+		s.onUploadFailed(task, task.processErr)
+		s.releaseBuffers(task)
+		return
+	}
+	// Small sessions are collected into batches and uploaded together
+	if s.batcher != nil && task.domPath == "" {
+		// The batcher marks the session done once its batch is uploaded
+		batched = true
+		s.batcher.add(task)
+		return
+	}
+	// Buffers aren't released on panic to save the session to the dead letter dir
+	err := s.uploadParts(task)
+	if err == nil && s.cfg.WriteManifest {
+		err = s.uploadManifest(task)
 	}
-	return zippedMob
-}
-
-func (s *Storage) compressBrotli(ctx context.Context, data []byte) *bytes.Buffer {
-	out := bytes.Buffer{}
-	writer := brotli.NewWriterOptions(&out, brotli.WriterOptions{Quality: brotli.DefaultCompression})
-	in := bytes.NewReader(data)
-	n, err := io.Copy(writer, in)
 	if err != nil {
-		s.log.Error(ctx, "can't write session data to compressor: %s", err)
+		s.onUploadFailed(task, err)
+		s.releaseBuffers(task)
+		return
 	}
-
-	if int(n) != len(data) {
-		s.log.Error(ctx, "wrote less data than expected: %d vs %d", n, len(data))
+	s.onUploaded(task)
+	switch {
+	case s.mirrorPool != nil:
+		// Mirroring is best effort, it never blocks the uploader
+		if s.mirrorPool.TrySubmit(task) {
+			return
+		}
+		metrics.IncreaseStorageMirrorDropped()
+		s.log.Warn(task.ctx, "mirror queue is full, session isn't mirrored")
+	case s.mirror != nil:
+		s.mirrorSession(task)
 	}
+	s.releaseBuffers(task)
+}
 
-	if err := writer.Close(); err != nil {
-		s.log.Error(ctx, "can't close compressor: %s", err)
+func (s *Storage) onUploadFailed(task *Task, err error) {
+	s.health.recordUpload(false, s.cfg.HealthWindow)
+	if s.cfg.StructuredLogs {
+		s.logReport(task, err)
+	} else {
+		s.log.Error(task.ctx, "can't upload session: %s", err)
+	}
+	metrics.IncreaseStorageTotalFailedUploads()
+	s.recordTotalDuration(task, "failed")
+	if s.cfg.DeadLetterDir != "" {
+		if dlErr := s.deadLetter(task, err); dlErr != nil {
+			s.log.Error(task.ctx, "can't save session to dead letter dir: %s", dlErr)
+		}
 	}
-	return &out
 }
 
-func (s *Storage) compressZstd(ctx context.Context, data []byte) *bytes.Buffer {
-	var out bytes.Buffer
-	w, _ := zstd.NewWriter(&out)
-	if _, err := w.Write(data); err != nil {
-		s.log.Error(ctx, "can't write session data to compressor: %s", err)
+func (s *Storage) onUploaded(task *Task) {
+	s.health.recordUpload(true, s.cfg.HealthWindow)
+	if s.cfg.StructuredLogs {
+		s.logReport(task, nil)
 	}
-	if err := w.Close(); err != nil {
-		s.log.Error(ctx, "can't close compressor: %s", err)
+	metrics.IncreaseStorageTotalSessions()
+	s.recordTotalDuration(task, "uploaded")
+	if s.cfg.DeleteAfterUpload {
+		s.deleteLocalFiles(task)
+	}
+	if task.deadLetterDir != "" {
+		if err := os.RemoveAll(task.deadLetterDir); err != nil {
+			s.log.Error(task.ctx, "can't remove dead letter %s: %s", task.deadLetterDir, err)
+		}
+	}
+	if s.notifier != nil {
+		s.notifier.notify(task)
 	}
-	return &out
 }
 
-func (s *Storage) uploadSession(payload interface{}) {
-	task := payload.(*Task)
+// recordTotalDuration records the time from the start of processing, DOM file is split if it has more than one part
+func (s *Storage) recordTotalDuration(task *Task, outcome string) {
+	project, sdk := s.metricAttributes(task.ctx)
+	metrics.RecordSessionTotalDuration(float64(time.Since(task.startedAt).Milliseconds()), len(task.doms) > 1, outcome, project, sdk)
+}
+
+func (s *Storage) deleteLocalFiles(task *Task) {
+	for _, tp := range fileTypes {
+		path, ok := task.paths[tp]
+		if !ok {
+			continue
+		}
+		if err := s.source.Remove(path); err != nil {
+			s.log.Warn(task.ctx, "can't delete local session file: %s", err)
+			metrics.IncreaseStorageDeleteErrors()
+		}
+	}
+}
+
+func (s *Storage) uploadParts(task *Task) error {
 	wg := &sync.WaitGroup{}
-	wg.Add(3)
 	var (
-		uploadDoms int64 = 0
-		uploadDome int64 = 0
-		uploadDev  int64 = 0
+		uploadDom    int64 = 0
+		uploadDev    int64 = 0
+		uploadCanvas int64 = 0
+		mu           sync.Mutex
+		errs         []error
 	)
-	go func() {
-		if task.doms != nil {
-			// Record compression ratio
-			metrics.RecordSessionCompressionRatio(task.domsRawSize/float64(task.doms.Len()), DOM.String())
-			// Upload session to s3
-			start := time.Now()
-			if err := s.objStorage.Upload(task.doms, task.id+string(DOM)+"s", "application/octet-stream", task.compression); err != nil {
-				s.log.Fatal(task.ctx, "failed to upload mob file, err: %s", err)
-			}
-			uploadDoms = time.Now().Sub(start).Milliseconds()
+	addErr := func(part string, err error) {
+		mu.Lock()
+		errs = append(errs, fmt.Errorf("%s upload failed: %s", part, err))
+		mu.Unlock()
+	}
+	addDuration := func(dur *int64, start time.Time) {
+		mu.Lock()
+		*dur += time.Since(start).Milliseconds()
+		mu.Unlock()
+	}
+	recordCompression := func(tp FileType, rawSize float64, buf *bytes.Buffer) {
+		metrics.RecordSessionCompressionRatio(rawSize/float64(buf.Len()), tp.String())
+		if task.compressionOf(tp) == objectstorage.Zstd {
+			metrics.RecordZstdCompressionRatio(rawSize/float64(buf.Len()), tp.String(), s.useZstdDictionary(task, tp))
 		}
-		wg.Done()
-	}()
-	go func() {
-		if task.dome != nil {
-			// Record compression ratio
-			metrics.RecordSessionCompressionRatio(task.domeRawSize/float64(task.dome.Len()), DOM.String())
-			// Upload session to s3
+		metrics.RecordSessionCompressedSize(float64(buf.Len()), tp.String())
+	}
+	domUploaded := make([]bool, len(task.doms))
+	if s.cfg.LayoutMode == layoutIndexed && len(task.doms) > 0 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, dom := range task.doms {
+				recordCompression(DOM, task.domRawSizes[i], dom)
+			}
 			start := time.Now()
-			if err := s.objStorage.Upload(task.dome, task.id+string(DOM)+"e", "application/octet-stream", task.compression); err != nil {
-				s.log.Fatal(task.ctx, "failed to upload mob file, err: %s", err)
+			if err := s.uploadIndexedDom(task); err != nil {
+				addErr(DOM.String(), err)
 			}
-			uploadDome = time.Now().Sub(start).Milliseconds()
+			addDuration(&uploadDom, start)
+		}()
+	} else {
+		var splitOffset int64
+		for i, dom := range task.doms {
+			// Store the end of the part in the whole DOM file to be able to join parts back
+			splitOffset += int64(task.domRawSizes[i])
+			metadata := map[string]string{splitOffsetMetadataKey: strconv.FormatInt(splitOffset, 10)}
+			s.setCompressionLevelMetadata(task, DOM, int64(task.domRawSizes[i]), metadata)
+			wg.Add(1)
+			go func(i int, dom *bytes.Buffer) {
+				defer wg.Done()
+				recordCompression(DOM, task.domRawSizes[i], dom)
+				// Upload session to s3
+				start := time.Now()
+				if err := s.uploadWithRetry(task, dom, s.objectKey(task.base, DOM)+domPartSuffix(i), DOM, metadata); err != nil {
+					addErr(domPartName(i), err)
+				} else {
+					domUploaded[i] = true
+				}
+				addDuration(&uploadDom, start)
+			}(i, dom)
 		}
-		wg.Done()
-	}()
-	go func() {
-		if task.dev != nil {
-			// Record compression ratio
-			metrics.RecordSessionCompressionRatio(task.devRawSize/float64(task.dev.Len()), DEV.String())
-			// Upload session to s3
+	}
+	if task.domPath != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Compress and upload big session file on the fly
 			start := time.Now()
-			if err := s.objStorage.Upload(task.dev, task.id+string(DEV), "application/octet-stream", task.compression); err != nil {
-				s.log.Fatal(task.ctx, "failed to upload mob file, err: %s", err)
+			if err := s.uploadFileWithRetry(task, task.domPath, s.domKey(task.base, 0), DOM); err != nil {
+				addErr(domPartName(0), err)
 			}
-			uploadDev = time.Now().Sub(start).Milliseconds()
+			addDuration(&uploadDom, start)
+		}()
+	}
+	uploadFile := func(tp FileType, buf *bytes.Buffer, rawSize float64, dur *int64) {
+		defer wg.Done()
+		recordCompression(tp, rawSize, buf)
+		// Upload session to s3
+		start := time.Now()
+		metadata := make(map[string]string)
+		s.setCompressionLevelMetadata(task, tp, int64(rawSize), metadata)
+		if err := s.uploadWithRetry(task, buf, s.objectKey(task.base, tp), tp, metadata); err != nil {
+			addErr(tp.String(), err)
 		}
-		wg.Done()
-	}()
+		addDuration(dur, start)
+	}
+	if task.dev != nil {
+		wg.Add(1)
+		go uploadFile(DEV, task.dev, task.devRawSize, &uploadDev)
+	}
+	if task.canvas != nil {
+		wg.Add(1)
+		go uploadFile(CANVAS, task.canvas, task.canvasRawSize, &uploadCanvas)
+	}
 	wg.Wait()
-	metrics.RecordSessionUploadDuration(float64(uploadDoms+uploadDome), DOM.String())
-	metrics.RecordSessionUploadDuration(float64(uploadDev), DEV.String())
-	metrics.IncreaseStorageTotalSessions()
+	s.rollbackPartialDom(task, domUploaded)
+	project, sdk := s.metricAttributes(task.ctx)
+	metrics.RecordSessionUploadDuration(float64(uploadDom), DOM.String(), project, sdk)
+	metrics.RecordSessionUploadDuration(float64(uploadDev), DEV.String(), project, sdk)
+	if task.canvas != nil {
+		metrics.RecordSessionUploadDuration(float64(uploadCanvas), CANVAS.String(), project, sdk)
+	}
+	return errors.Join(errs...)
+}
+
+// rollbackPartialDom deletes uploaded DOM parts if other parts failed, a truncated DOM file can't be replayed.
+// The whole session is uploaded again from the dead letter dir.
+func (s *Storage) rollbackPartialDom(task *Task, uploaded []bool) {
+	failed := 0
+	for _, ok := range uploaded {
+		if !ok {
+			failed++
+		}
+	}
+	if failed == 0 || failed == len(uploaded) {
+		return
+	}
+	metrics.IncreaseStoragePartialUploadFailures()
+	if s.cfg.DryRun {
+		return
+	}
+	for i, ok := range uploaded {
+		if !ok {
+			continue
+		}
+		key := s.objectKey(task.base, DOM) + domPartSuffix(i)
+		if err := s.objStorage.Delete(key); err != nil {
+			s.log.Error(task.ctx, "can't delete %s of partially uploaded session: %s", key, err)
+		}
+	}
 }
 
 func (s *Storage) doCompression(payload interface{}) {
 	task := payload.(*Task)
+	metrics.RecordTaskQueueWaitDuration(float64(time.Since(task.enqueuedAt).Milliseconds()))
+	// Nothing to compress for cancelled session, uploader will report the error
+	if task.ctx.Err() != nil {
+		s.uploaderPool.Submit(task)
+		return
+	}
+	var domErr, devErr, canvasErr error
 	wg := &sync.WaitGroup{}
-	wg.Add(2)
+	wg.Add(3)
 	go func() {
-		s.packSession(task, DOM)
+		domErr = s.packSession(task, DOM)
 		wg.Done()
 	}()
 	go func() {
-		s.packSession(task, DEV)
+		devErr = s.packSession(task, DEV)
+		wg.Done()
+	}()
+	go func() {
+		canvasErr = s.packSession(task, CANVAS)
 		wg.Done()
 	}()
 	wg.Wait()
+	if task.packErr = errors.Join(domErr, devErr, canvasErr); task.packErr == nil {
+		task.processErr = s.runProcessors(task)
+	}
+	// Raw files aren't needed anymore
+	task.domRaw, task.devRaw, task.canvasRaw = nil, nil, nil
+	s.releaseInFlight(task)
 	s.uploaderPool.Submit(task)
 }
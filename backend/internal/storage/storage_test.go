@@ -0,0 +1,714 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	objConfig "openreplay/backend/internal/config/objectstorage"
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/logger"
+	"openreplay/backend/pkg/messages"
+	"openreplay/backend/pkg/objectstorage"
+	"openreplay/backend/pkg/objectstorage/memory"
+)
+
+func newTestStorage(t *testing.T, cfg *config.Config) (*Storage, *memory.Storage) {
+	if cfg.FSDir == "" {
+		cfg.FSDir = t.TempDir()
+	}
+	if cfg.FileSplitSize == 0 {
+		cfg.FileSplitSize = 1000
+	}
+	if cfg.MaxFileSize == 0 {
+		cfg.MaxFileSize = 1 << 20
+	}
+	if cfg.Workers == 0 {
+		cfg.Workers = 1
+	}
+	if cfg.CompressionAlgo == "" {
+		cfg.CompressionAlgo = "none"
+	}
+	if cfg.SampleRate == 0 {
+		cfg.SampleRate = 1
+	}
+	// Enabled by default in the env config, tests disable it after creation
+	cfg.ProcessDevTools = true
+	objStorage := memory.New()
+	s, err := New(cfg, logger.New(), objStorage, nil)
+	if err != nil {
+		t.Fatalf("can't create storage: %s", err)
+	}
+	return s, objStorage
+}
+
+func objectMetadata(objStorage *memory.Storage, key string) map[string]string {
+	if obj, ok := objStorage.Object(key); ok {
+		return obj.Metadata
+	}
+	return nil
+}
+
+func TestProcessReportsBothPrepareErrors(t *testing.T) {
+	s, _ := newTestStorage(t, &config.Config{})
+	// Missing dom file and devtools "file" which can't be read
+	if err := os.Mkdir(s.cfg.FSDir+"/42devtools", 0755); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(42)
+
+	err := s.Process(context.Background(), msg)
+	if err == nil {
+		t.Fatal("expected error for broken session files")
+	}
+	if !strings.Contains(err.Error(), "DOM") || !strings.Contains(err.Error(), "DEV") {
+		t.Errorf("expected both DOM and DEV errors, got: %s", err)
+	}
+}
+
+func TestCompressionErrors(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{CompressionAlgo: "gzip", DeadLetterDir: t.TempDir()})
+	// Broken compression level makes the compressor fail
+	s.gzipLevel = 42
+	if err := os.WriteFile(s.cfg.FSDir+"/19", []byte("dom"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(19)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	if objStorage.Exists("19" + string(DOM) + "s") {
+		t.Error("session with compression error shouldn't be uploaded")
+	}
+	if entries, _ := os.ReadDir(s.cfg.DeadLetterDir); len(entries) != 0 {
+		t.Error("session with compression error shouldn't be dead-lettered")
+	}
+}
+
+func TestProcessSplitSession(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{UseSort: true, FileSplitTime: 15 * time.Second,
+		CompressionAlgo: "zstd"})
+	// Messages of 40 seconds long session, the DOM file is split after 15 seconds
+	var raw []byte
+	for i := 0; i < 4; i++ {
+		for j, msg := range []messages.Message{
+			&messages.Timestamp{Timestamp: uint64(1000 + i*10000)},
+			&messages.SetViewportSize{Width: uint64(i), Height: uint64(i)},
+		} {
+			raw = binary.LittleEndian.AppendUint64(raw, uint64(i*2+j))
+			raw = append(raw, msg.Encode()...)
+		}
+	}
+	if err := os.WriteFile(s.cfg.FSDir+"/20", raw, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.cfg.FSDir+"/20devtools", []byte("devtools"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(20)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	keys := objStorage.Keys()
+	if strings.Join(keys, ",") != "20/devtools.mob,20/dom.mobe,20/dom.mobs" {
+		t.Fatalf("wrong uploaded objects: %v", keys)
+	}
+	expected, index, _ := s.sortSessionMessages(context.Background(), DOM, raw)
+	if index <= 0 {
+		t.Fatalf("session should be split, index: %d", index)
+	}
+	reader, err := s.Download(20, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := io.ReadAll(reader); !bytes.Equal(res, expected) {
+		t.Error("downloaded session doesn't match the sorted one")
+	}
+	dev, _ := objStorage.Object("20" + string(DEV))
+	if res, _ := s.decompress(dev.Data, objectstorage.Zstd); string(res) != "devtools" {
+		t.Errorf("wrong devtools content: %s", res)
+	}
+}
+
+func TestFileName(t *testing.T) {
+	s, _ := newTestStorage(t, &config.Config{})
+	for _, tc := range []struct {
+		tp        FileType
+		localPath string
+		objectKey string
+	}{
+		{DOM, "/mnt/efs/1", "2024/01/02/1/dom.mob"},
+		{DEV, "/mnt/efs/1devtools", "2024/01/02/1/devtools.mob"},
+		{CANVAS, "/mnt/efs/1canvas", "2024/01/02/1/canvas.mob"},
+	} {
+		if path := s.localPath("/mnt/efs/1", tc.tp); path != tc.localPath {
+			t.Errorf("wrong %s local path: %s, expected: %s", tc.tp, path, tc.localPath)
+		}
+		if key := s.objectKey("2024/01/02/1", tc.tp); key != tc.objectKey {
+			t.Errorf("wrong %s object key: %s, expected: %s", tc.tp, key, tc.objectKey)
+		}
+	}
+	if len(fileTypes) != 3 {
+		t.Errorf("test doesn't cover all file types: %v", fileTypes)
+	}
+	s, _ = newTestStorage(t, &config.Config{DevToolsFileName: "network", DevToolsObjectKey: "devtools/{version}/events.mob"})
+	if path := s.localPath("/mnt/efs/1", DEV); path != "/mnt/efs/1network" {
+		t.Errorf("wrong custom devtools local path: %s", path)
+	}
+	if key := s.objectKey("1", DEV); key != "1/devtools/"+mobFormatVersion+"/events.mob" {
+		t.Errorf("wrong custom devtools object key: %s", key)
+	}
+	for _, names := range [][2]string{{"canvas", ""}, {"", "dom.mobs"}, {"", "manifest.json"}, {"", "{date}.mob"}} {
+		if _, _, err := parseDevToolsNames(names[0], names[1], mobFormatVersion); err == nil {
+			t.Errorf("devtools names %v should fail", names)
+		}
+	}
+}
+
+func TestSplitDom(t *testing.T) {
+	// Start part and 25 timestamp messages of 4 bytes, so messages straddle the 30 bytes split size
+	mob := bytes.Repeat([]byte{1}, 10)
+	for i := 0; i < 25; i++ {
+		mob = append(mob, (&messages.Timestamp{Timestamp: 1 << 20}).Encode()...)
+	}
+	for _, tc := range []struct {
+		maxSplits int
+		index     int
+		sizes     []int
+	}{
+		{maxSplits: 2, index: 10, sizes: []int{10, 100}},
+		{maxSplits: 3, index: 10, sizes: []int{10, 32, 68}},
+		{maxSplits: 10, index: 10, sizes: []int{10, 32, 32, 32, 4}},
+		{maxSplits: 10, index: 98, sizes: []int{98, 12}},
+	} {
+		s, _ := newTestStorage(t, &config.Config{FileSplitSize: 30, MaxFileSplits: tc.maxSplits})
+		parts := s.splitDom(mob, tc.index)
+		if len(parts) != len(tc.sizes) {
+			t.Fatalf("expected %d parts, got %d", len(tc.sizes), len(parts))
+		}
+		for i, part := range parts {
+			if len(part) != tc.sizes[i] {
+				t.Errorf("part %d: expected size %d, got %d", i, tc.sizes[i], len(part))
+			}
+			if i > 0 && len(part) > 0 && part[0] != messages.MsgTimestamp {
+				t.Errorf("part %d doesn't start with a message", i)
+			}
+		}
+	}
+
+	// Undecodable end part isn't split
+	s, _ := newTestStorage(t, &config.Config{FileSplitSize: 30, MaxFileSplits: 3})
+	if parts := s.splitDom(bytes.Repeat([]byte{0xff}, 100), 10); len(parts) != 2 {
+		t.Errorf("expected 2 parts, got %d", len(parts))
+	}
+}
+
+func TestSplitOffsetMetadata(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{})
+	task := &Task{
+		ctx:         context.Background(),
+		id:          "5",
+		base:        "5",
+		doms:        []*bytes.Buffer{bytes.NewBufferString("start"), bytes.NewBufferString("end")},
+		domRawSizes: []float64{10, 20},
+	}
+	if err := s.uploadParts(task); err != nil {
+		t.Fatal(err)
+	}
+	for key, offset := range map[string]string{"5/dom.mobs": "10", "5/dom.mobe": "30"} {
+		if got := objectMetadata(objStorage, key)[splitOffsetMetadataKey]; got != offset {
+			t.Errorf("%s: expected split offset %s, got %s", key, offset, got)
+		}
+	}
+}
+
+func TestCloseDrainsSubmittedSessions(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{DeleteAfterUpload: true})
+	dom := []byte("dom file content")
+	if err := os.WriteFile(s.cfg.FSDir+"/11", dom, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.cfg.FSDir+"/11devtools", []byte("devtools"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(11)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatalf("can't process session: %s", err)
+	}
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatalf("can't close storage: %s", err)
+	}
+	if !objStorage.Exists("11" + string(DOM) + "s") {
+		t.Error("dom file wasn't uploaded before close")
+	}
+	if !objStorage.Exists("11" + string(DEV)) {
+		t.Error("devtools file wasn't uploaded before close")
+	}
+	if _, err := os.Stat(s.cfg.FSDir + "/11"); !os.IsNotExist(err) {
+		t.Error("local dom file wasn't deleted after upload")
+	}
+	if err := s.Process(context.Background(), msg); !errors.Is(err, ErrStorageClosed) {
+		t.Errorf("expected closed storage error, got: %v", err)
+	}
+}
+
+func BenchmarkProcessWorkers(b *testing.B) {
+	for _, workers := range []int{1, 4} {
+		b.Run(fmt.Sprintf("workers-%d", workers), func(b *testing.B) {
+			dir := b.TempDir()
+			if err := os.WriteFile(dir+"/1", bytes.Repeat([]byte("dom"), 1000), 0644); err != nil {
+				b.Fatal(err)
+			}
+			if err := os.WriteFile(dir+"/1devtools", bytes.Repeat([]byte("dev"), 1000), 0644); err != nil {
+				b.Fatal(err)
+			}
+			objStorage := memory.New()
+			objStorage.SetLatency(time.Millisecond)
+			s, err := New(&config.Config{FSDir: dir, FileSplitSize: 1 << 19, MaxFileSize: 1 << 20, CompressionAlgo: "zstd",
+				Workers: workers},
+				logger.New(), objStorage, nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+			msg := &messages.SessionEnd{}
+			msg.SetSessionID(1)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := s.Process(context.Background(), msg); err != nil {
+					b.Fatal(err)
+				}
+			}
+			s.Close(context.Background())
+		})
+	}
+}
+
+func TestProcessWithoutDevtools(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{})
+	if err := os.WriteFile(s.cfg.FSDir+"/12", []byte("dom"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(12)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatalf("session without devtools shouldn't fail: %s", err)
+	}
+	s.Wait()
+	if !objStorage.Exists("12" + string(DOM) + "s") {
+		t.Error("dom file wasn't uploaded")
+	}
+	if objStorage.Exists("12" + string(DEV)) {
+		t.Error("devtools file shouldn't be uploaded")
+	}
+	if objStorage.Exists("12" + string(CANVAS)) {
+		t.Error("canvas file shouldn't be uploaded")
+	}
+}
+
+func TestProcessCanvas(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{DeleteAfterUpload: true})
+	for name, data := range map[string]string{"16": "dom", "16canvas": "canvas frames"} {
+		if err := os.WriteFile(s.cfg.FSDir+"/"+name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(16)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	if obj, ok := objStorage.Object("16" + string(CANVAS)); !ok || string(obj.Data) != "canvas frames" {
+		t.Error("canvas file wasn't uploaded")
+	}
+	if _, err := os.Stat(s.cfg.FSDir + "/16canvas"); !os.IsNotExist(err) {
+		t.Error("local canvas file wasn't deleted after upload")
+	}
+}
+
+func TestProcessSkipsSmallFiles(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{MinFileSize: 4})
+	if err := os.WriteFile(s.cfg.FSDir+"/13", []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.cfg.FSDir+"/13devtools", []byte("devtools"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(13)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatalf("session with empty dom file shouldn't fail: %s", err)
+	}
+	s.Wait()
+	if objStorage.Exists("13" + string(DOM) + "s") {
+		t.Error("empty dom file shouldn't be uploaded")
+	}
+	if !objStorage.Exists("13" + string(DEV)) {
+		t.Error("devtools file wasn't uploaded")
+	}
+}
+
+func TestQueueFullPolicy(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	blocker := testProcessor(func(task *Task) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+	objStorage := memory.New()
+	s, err := New(&config.Config{FSDir: t.TempDir(), FileSplitSize: 1000, MaxFileSize: 1 << 20, Workers: 1,
+		QueueCapacity: 1, QueueFullPolicy: "reject", CompressionAlgo: "none"}, logger.New(), objStorage, nil, blocker)
+	if err != nil {
+		t.Fatal(err)
+	}
+	process := func(id uint64) error {
+		if err := os.WriteFile(fmt.Sprintf("%s/%d", s.cfg.FSDir, id), []byte("dom"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		msg := &messages.SessionEnd{}
+		msg.SetSessionID(id)
+		return s.Process(context.Background(), msg)
+	}
+	if err := process(21); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	if err := process(22); err != nil {
+		t.Fatalf("session should wait in the queue: %s", err)
+	}
+	if err := process(23); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected full queue error, got: %v", err)
+	}
+	close(release)
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !objStorage.Exists("22"+string(DOM)+"s") || objStorage.Exists("23"+string(DOM)+"s") {
+		t.Errorf("wrong uploaded sessions: %v", objStorage.Keys())
+	}
+
+	if _, err := New(&config.Config{FSDir: t.TempDir(), FileSplitSize: 1000, MaxFileSize: 1 << 20, Workers: 1,
+		QueueFullPolicy: "drop-newest"}, logger.New(), memory.New(), nil); err == nil {
+		t.Error("unknown queue full policy should be rejected")
+	}
+}
+
+func TestOversizedFiles(t *testing.T) {
+	for _, drop := range []bool{true, false} {
+		s, objStorage := newTestStorage(t, &config.Config{FileSplitSize: 5, MaxFileSize: 10, DropOversized: drop})
+		if err := os.WriteFile(s.cfg.FSDir+"/16", bytes.Repeat([]byte("dom"), 10), 0644); err != nil {
+			t.Fatal(err)
+		}
+		msg := &messages.SessionEnd{}
+		msg.SetSessionID(16)
+		if err := s.Process(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+		s.Wait()
+		if objStorage.Exists("16"+string(DOM)+"s") == drop {
+			t.Errorf("drop oversized: %t, dom file uploaded: %t", drop, !drop)
+		}
+	}
+}
+
+func TestFileTooLarge(t *testing.T) {
+	s, _ := newTestStorage(t, &config.Config{FileSplitSize: 5, MaxFileSize: 10})
+	if err := os.WriteFile(s.cfg.FSDir+"/19", bytes.Repeat([]byte("dom"), 10), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, _, err := s.openSession(context.Background(), s.cfg.FSDir+"/19", DOM)
+	var tooLarge *ErrFileTooLarge
+	if !errors.As(err, &tooLarge) {
+		t.Fatalf("expected ErrFileTooLarge, got: %v", err)
+	}
+	if tooLarge.Size != 30 || tooLarge.Max != 10 {
+		t.Errorf("wrong sizes: %d, max: %d", tooLarge.Size, tooLarge.Max)
+	}
+}
+
+func BenchmarkPackSession(b *testing.B) {
+	objStorage := memory.New()
+	s, err := New(&config.Config{FSDir: b.TempDir(), FileSplitSize: 1 << 19, MaxFileSize: 1 << 20, CompressionAlgo: "zstd",
+		Workers: 1},
+		logger.New(), objStorage, nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	dom := bytes.Repeat([]byte("openreplay dom message "), 10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		task := &Task{ctx: context.Background(), id: "1", domRaw: dom, index: -1, compression: s.compression}
+		s.packSession(task, DOM)
+		s.releaseBuffers(task)
+	}
+}
+
+func TestSkipDevTools(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{})
+	s.cfg.ProcessDevTools = false
+	if err := os.WriteFile(s.cfg.FSDir+"/28", []byte("dom"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(s.cfg.FSDir+"/28devtools", []byte("devtools"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(28)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	if !objStorage.Exists("28" + string(DOM) + "s") {
+		t.Error("dom file should be uploaded")
+	}
+	if objStorage.Exists("28" + string(DEV)) {
+		t.Error("devtools file shouldn't be uploaded")
+	}
+}
+
+// concurrentStorage tracks the max number of uploads in progress
+type concurrentStorage struct {
+	*memory.Storage
+	mu      sync.Mutex
+	current int
+	max     int
+}
+
+func (c *concurrentStorage) UploadWithOptions(reader io.Reader, key string, contentType string, compression objectstorage.CompressionType, opts *objectstorage.UploadOptions) error {
+	c.mu.Lock()
+	c.current++
+	if c.current > c.max {
+		c.max = c.current
+	}
+	c.mu.Unlock()
+	time.Sleep(10 * time.Millisecond)
+	c.mu.Lock()
+	c.current--
+	c.mu.Unlock()
+	return c.Storage.UploadWithOptions(reader, key, contentType, compression, opts)
+}
+
+func TestMaxConcurrentUploads(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{Workers: 2, MaxConcurrentUploads: 1})
+	counting := &concurrentStorage{Storage: objStorage}
+	s.objStorage = counting
+	for _, id := range []uint64{33, 34} {
+		for _, tp := range fileTypes {
+			if err := os.WriteFile(s.localPath(s.cfg.FSDir+"/"+strconv.FormatUint(id, 10), tp), []byte("session file"), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		msg := &messages.SessionEnd{}
+		msg.SetSessionID(id)
+		if err := s.Process(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s.Wait()
+	if counting.max != 1 {
+		t.Errorf("max concurrent uploads: %d, expected 1", counting.max)
+	}
+	if !objStorage.Exists("34" + string(CANVAS)) {
+		t.Error("canvas file wasn't uploaded")
+	}
+}
+
+func TestSizeSplitFallback(t *testing.T) {
+	s, _ := newTestStorage(t, &config.Config{UseSort: true, FileSplitTime: 15 * time.Second, FileSplitSize: 100})
+	// 5 seconds long session without the time boundary
+	var raw []byte
+	for i := 0; i < 50; i++ {
+		for j, msg := range []messages.Message{
+			&messages.Timestamp{Timestamp: uint64(1000 + i*100)},
+			&messages.SetViewportSize{Width: uint64(i), Height: uint64(i)},
+		} {
+			raw = binary.LittleEndian.AppendUint64(raw, uint64(i*2+j))
+			raw = append(raw, msg.Encode()...)
+		}
+	}
+	mob, index, err := s.sortSessionMessages(context.Background(), DOM, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if index < 100 || index >= len(mob) {
+		t.Fatalf("session should be split after %d bytes, index: %d, size: %d", s.cfg.FileSplitSize, index, len(mob))
+	}
+	if nextMessageBoundary(mob[sortedHeaderSize:], index-sortedHeaderSize) != index-sortedHeaderSize {
+		t.Error("split index isn't at the message boundary")
+	}
+	// Devtools files aren't split
+	if _, index, _ := s.sortSessionMessages(context.Background(), DEV, raw); index != -1 {
+		t.Errorf("devtools file shouldn't be split, index: %d", index)
+	}
+}
+
+func TestObjectACL(t *testing.T) {
+	if _, err := New(&config.Config{FSDir: t.TempDir(), FileSplitSize: 1000, MaxFileSize: 1 << 20,
+		ObjectACL: "public-write"}, logger.New(), memory.New(), nil); err == nil {
+		t.Error("unknown acl should fail")
+	}
+	s, objStorage := newTestStorage(t, &config.Config{ObjectACL: "public-read"})
+	if err := os.WriteFile(s.cfg.FSDir+"/42", []byte("dom"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(42)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	if obj, ok := objStorage.Object("42" + string(DOM) + "s"); !ok || obj.ACL != objectstorage.PublicReadACL {
+		t.Error("dom file wasn't uploaded with public-read acl")
+	}
+}
+
+// benchmarkMob returns a raw DOM file of the session with the given number of seconds, each second has a timestamp
+// and a viewport message
+func benchmarkMob(seconds int) []byte {
+	var raw []byte
+	for i := 0; i < seconds; i++ {
+		for j, msg := range []messages.Message{
+			&messages.Timestamp{Timestamp: uint64(1000 + i*1000)},
+			&messages.SetViewportSize{Width: uint64(i), Height: uint64(i)},
+		} {
+			raw = binary.LittleEndian.AppendUint64(raw, uint64(i*2+j))
+			raw = append(raw, msg.Encode()...)
+		}
+	}
+	return raw
+}
+
+// BenchmarkSessionPipeline measures the whole prepare, compress and upload path of one session
+func BenchmarkSessionPipeline(b *testing.B) {
+	for _, bc := range []struct {
+		name    string
+		seconds int
+	}{
+		{"small", 10},      // not split
+		{"split", 600},     // split after FILE_SPLIT_TIME
+		{"large", 1 << 17}, // about 3MB
+	} {
+		raw := benchmarkMob(bc.seconds)
+		for _, devtools := range []bool{false, true} {
+			b.Run(fmt.Sprintf("%s/devtools-%t", bc.name, devtools), func(b *testing.B) {
+				dir := b.TempDir()
+				if err := os.WriteFile(dir+"/1", raw, 0644); err != nil {
+					b.Fatal(err)
+				}
+				s, err := New(&config.Config{FSDir: dir, MaxFileSize: 1 << 30, FileSplitSize: 1 << 20, UseSort: true,
+					FileSplitTime: 15 * time.Second, CompressionAlgo: "zstd", Workers: 1, ProcessDevTools: true},
+					logger.New(), memory.New(), nil)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if devtools {
+					if err := os.WriteFile(s.localPath(dir+"/1", DEV), raw, 0644); err != nil {
+						b.Fatal(err)
+					}
+				}
+				msg := &messages.SessionEnd{}
+				msg.SetSessionID(1)
+				b.SetBytes(int64(len(raw)))
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := s.Process(context.Background(), msg); err != nil {
+						b.Fatal(err)
+					}
+					s.Wait()
+				}
+				b.StopTimer()
+				s.Close(context.Background())
+			})
+		}
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	for name, cfg := range map[string]*config.Config{
+		"zero split size":     {FSDir: t.TempDir(), MaxFileSize: 1 << 20},
+		"negative split size": {FSDir: t.TempDir(), FileSplitSize: -1, MaxFileSize: 1 << 20},
+		"zero max size":       {FSDir: t.TempDir(), FileSplitSize: 1000},
+		"split above max":     {FSDir: t.TempDir(), FileSplitSize: 1 << 20, MaxFileSize: 1000},
+		"missing dir":         {FSDir: filepath.Join(t.TempDir(), "missing"), FileSplitSize: 1000, MaxFileSize: 1 << 20},
+		"file instead of dir": {FSDir: file, FileSplitSize: 1000, MaxFileSize: 1 << 20},
+		"v2 without projects": {FSDir: t.TempDir(), FileSplitSize: 1000, MaxFileSize: 1 << 20, KeyScheme: "v2"},
+		"project sample rates without projects": {FSDir: t.TempDir(), FileSplitSize: 1000, MaxFileSize: 1 << 20,
+			ProjectSampleRates: map[string]float64{"7": 0}},
+		"project tag without projects": {FSDir: t.TempDir(), FileSplitSize: 1000, MaxFileSize: 1 << 20,
+			Tags: map[string]string{"project": "{projectID}"}},
+		"metric labels without projects": {FSDir: t.TempDir(), FileSplitSize: 1000, MaxFileSize: 1 << 20,
+			HighCardinalityMetrics: true},
+		"batches without manifests": {FSDir: t.TempDir(), FileSplitSize: 1000, MaxFileSize: 1 << 20,
+			BatchUploads: true},
+		"tags in gcs": {FSDir: t.TempDir(), FileSplitSize: 1000, MaxFileSize: 1 << 20,
+			Tags: map[string]string{"retention": "long"}, ObjectsConfig: objConfig.ObjectsConfig{CloudName: "gcp"}},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("%s should fail", name)
+		}
+		if _, err := New(cfg, logger.New(), memory.New(), nil); err == nil {
+			t.Errorf("storage with %s should fail", name)
+		}
+	}
+	// FS_DIR is a key prefix for the object storage source
+	cfg := &config.Config{FSDir: "/mobs", Source: "objectstorage", FileSplitSize: 1000, MaxFileSize: 1 << 20}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("object storage source shouldn't check FS_DIR: %s", err)
+	}
+}
+
+func TestMaxCompressionConcurrency(t *testing.T) {
+	s, _ := newTestStorage(t, &config.Config{MaxCompressionConcurrency: 1, CompressionAlgo: "zstd"})
+	if err := s.packSlots.Acquire(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, _, _, err := s.packPart(&Task{ctx: ctx}, DOM, []byte("dom"), s.compression); err == nil {
+		t.Error("compression should wait for a free slot")
+	}
+	s.packSlots.Release(1)
+	if _, _, _, err := s.packPart(&Task{ctx: context.Background()}, DOM, []byte("dom"), s.compression); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInvalidMessage(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{})
+	if err := s.Process(context.Background(), nil); !errors.Is(err, ErrInvalidMessage) {
+		t.Errorf("nil message should be rejected, got: %v", err)
+	}
+	zeroID := &messages.SessionEnd{}
+	zeroID.SetSessionID(0)
+	for _, msg := range []*messages.SessionEnd{{}, zeroID} {
+		if err := s.Process(context.Background(), msg); !errors.Is(err, ErrInvalidMessage) {
+			t.Errorf("message without session id should be rejected, got: %v", err)
+		}
+	}
+	s.Wait()
+	if keys := objStorage.Keys(); len(keys) != 0 {
+		t.Errorf("nothing should be uploaded: %v", keys)
+	}
+}
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"time"
+
+	metrics "openreplay/backend/pkg/metrics/storage"
+	"openreplay/backend/pkg/objectstorage"
+)
+
+// shouldStream checks that the file is big enough to skip reading it into memory. Files bigger than MaxFileSize
+// are streamed only if they shouldn't be dropped. Encrypted sessions are always processed in memory. Streamed files
+// are uploaded as is, even with USE_SESSION_SORT, the manifest marks them as unsorted.
+func (s *Storage) shouldStream(task *Task, filePath string) bool {
+	if task.key != "" || (s.cfg.StreamThreshold <= 0 && s.cfg.DropOversized) {
+		return false
+	}
+	size, err := s.source.Size(filePath)
+	if err != nil || !s.isStreamed(task, size) {
+		return false
+	}
+	project, sdk := s.metricAttributes(task.ctx)
+	metrics.RecordSessionSize(float64(size), DOM.String(), project, sdk)
+	return true
+}
+
+// isStreamed checks that the DOM file of the given size is streamed instead of reading into memory
+func (s *Storage) isStreamed(task *Task, size int64) bool {
+	if task.key != "" {
+		return false
+	}
+	if size > s.cfg.MaxFileSize {
+		return !s.cfg.DropOversized
+	}
+	return s.cfg.StreamThreshold > 0 && size > s.cfg.StreamThreshold
+}
+
+func (s *Storage) uploadFileWithRetry(task *Task, filePath, key string, tp FileType) error {
+	stored := &countingReader{}
+	attempt := 0
+	err := s.withRetry(task, key, tp, func(ctx context.Context) error {
+		size, err := s.source.Size(filePath)
+		if err != nil {
+			return err
+		}
+		file, err := s.source.Open(filePath)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		opts := &objectstorage.UploadOptions{
+			Metadata:     make(map[string]string),
+			StorageClass: s.storageClass[tp],
+			ACL:          s.acl,
+			Tags:         s.objectTags(task),
+			Context:      ctx,
+		}
+		for k, v := range task.metadata {
+			opts.Metadata[k] = v
+		}
+		compression := task.compressionOf(tp)
+		opts.Metadata[compressionMetadataKey] = compression.String()
+		opts.Metadata[encryptionMetadataKey] = encryptionNone // sessions with encryption keys aren't streamed
+		opts.Metadata[formatVersionMetadataKey] = s.formatVersion
+		s.setDictionaryMetadata(task, tp, opts.Metadata)
+		s.setCompressionLevelMetadata(task, tp, size, opts.Metadata)
+		compressed := s.compressStream(newCtxReader(ctx, file), compression, size)
+		// Stops the compressor if the upload returns before reading the whole stream
+		defer compressed.Close()
+		*stored = countingReader{reader: compressed}
+		// Includes compression, the stream is compressed during the upload
+		start := time.Now()
+		err = s.objStorage.UploadWithOptions(stored, key, s.contentType[tp], compression, opts)
+		metrics.RecordPutDuration(float64(time.Since(start).Milliseconds()), tp.String(), attempt)
+		attempt++
+		return err
+	})
+	if err == nil && !s.cfg.DryRun {
+		metrics.IncreaseStorageStoredBytes(float64(stored.n), tp.String())
+	}
+	return err
+}
+
+// countingReader counts the bytes of the compressed stream sent to the object storage
+type countingReader struct {
+	reader io.Reader
+	n      int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// compressStream compresses the file while it's read, so only the compressor's window is kept in memory instead of
+// the whole compressed file. Compression errors are returned by Read, Close stops the compressor.
+func (s *Storage) compressStream(file io.Reader, compressionType objectstorage.CompressionType, size int64) io.ReadCloser {
+	if compressionType == objectstorage.NoCompression {
+		return io.NopCloser(file)
+	}
+	return pipeCompressor(file, func(w io.Writer) (io.WriteCloser, error) {
+		return s.newCompressor(w, compressionType, size)
+	})
+}
+
+func pipeCompressor(file io.Reader, newWriter func(w io.Writer) (io.WriteCloser, error)) io.ReadCloser {
+	reader, writer := io.Pipe()
+	go func() {
+		cw, err := newWriter(writer)
+		if err != nil {
+			writer.CloseWithError(err)
+			return
+		}
+		if _, err := io.Copy(cw, file); err != nil {
+			cw.Close()
+			writer.CloseWithError(err)
+			return
+		}
+		writer.CloseWithError(cw.Close())
+	}()
+	return reader
+}
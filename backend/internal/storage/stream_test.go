@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"testing"
+	"testing/iotest"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/logger"
+	"openreplay/backend/pkg/messages"
+	"openreplay/backend/pkg/objectstorage/memory"
+)
+
+func TestCompressStream(t *testing.T) {
+	s, _ := newTestStorage(t, &config.Config{CompressionAlgo: "gzip"})
+	dom := bytes.Repeat([]byte("openreplay dom message "), 1000)
+	compressed, err := io.ReadAll(s.compressStream(bytes.NewReader(dom), s.compression, int64(len(dom))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res, err := s.decompress(compressed, s.compression); err != nil || !bytes.Equal(res, dom) {
+		t.Fatalf("can't decompress stream: %v", err)
+	}
+	// Source error is returned to the reader side
+	readErr := errors.New("read failed")
+	failing := io.MultiReader(bytes.NewReader(dom), iotest.ErrReader(readErr))
+	if _, err := io.ReadAll(s.compressStream(failing, s.compression, int64(len(dom)))); !errors.Is(err, readErr) {
+		t.Errorf("wrong stream error: %v", err)
+	}
+	// Closed stream stops the compressor
+	stream := s.compressStream(bytes.NewReader(dom), s.compression, int64(len(dom)))
+	stream.Close()
+	if _, err := stream.Read(make([]byte, 1)); !errors.Is(err, io.ErrClosedPipe) {
+		t.Errorf("wrong error of closed stream: %v", err)
+	}
+}
+
+func BenchmarkCompressStream(b *testing.B) {
+	s, err := New(&config.Config{FSDir: b.TempDir(), FileSplitSize: 1 << 19, MaxFileSize: 1 << 20, CompressionAlgo: "gzip",
+		Workers: 1},
+		logger.New(), memory.New(), nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+	dom := bytes.Repeat([]byte("openreplay dom message "), 100000)
+	b.Run("buffered", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			data, err := s.compress(dom, s.compression)
+			if err != nil {
+				b.Fatal(err)
+			}
+			io.Copy(io.Discard, data)
+		}
+	})
+	b.Run("streamed", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := io.Copy(io.Discard, s.compressStream(bytes.NewReader(dom), s.compression, int64(len(dom)))); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestStreamedUnsorted(t *testing.T) {
+	// Oversized files are streamed as is even if sorting is enabled
+	s, objStorage := newTestStorage(t, &config.Config{FileSplitSize: 5, MaxFileSize: 10, DropOversized: false,
+		UseSort: true, WriteManifest: true})
+	dom := bytes.Repeat([]byte("dom"), 10)
+	if err := os.WriteFile(s.cfg.FSDir+"/17", dom, 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{}
+	msg.SetSessionID(17)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	if obj, ok := objStorage.Object("17" + string(DOM) + "s"); !ok || !bytes.Equal(obj.Data, dom) {
+		t.Fatal("streamed dom file wasn't uploaded as is")
+	}
+	obj, ok := objStorage.Object("17" + manifestName)
+	if !ok {
+		t.Fatal("manifest wasn't uploaded")
+	}
+	manifest := &sessionManifest{}
+	if err := json.Unmarshal(obj.Data, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Parts) != 1 || !manifest.Parts[0].Unsorted {
+		t.Errorf("streamed part should be marked as unsorted: %+v", manifest.Parts)
+	}
+
+	// Files under the threshold are always sorted
+	cfg := &config.Config{FSDir: t.TempDir(), FileSplitSize: 5, MaxFileSize: 1 << 20, StreamThreshold: 10, UseSort: true}
+	if err := cfg.Validate(); err == nil {
+		t.Error("stream threshold with sorting should fail")
+	}
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"openreplay/backend/pkg/objectstorage"
+)
+
+// tagPlaceholders are the supported placeholders of object tag values, {projectID} requires PROJECT_LOOKUP and is
+// empty if the project of the session wasn't found
+var tagPlaceholders = map[string]bool{
+	"{sessionID}": true,
+	"{projectID}": true,
+}
+
+// validateTags checks configured object tags, placeholders are replaced with sample values to check S3 constraints
+func validateTags(tags map[string]string) error {
+	for k, v := range tags {
+		for _, placeholder := range keyPlaceholder.FindAllString(v, -1) {
+			if !tagPlaceholders[placeholder] {
+				return fmt.Errorf("unknown placeholder %s in object tag %s: %s", placeholder, k, v)
+			}
+		}
+	}
+	return objectstorage.ValidateTags(replaceTagPlaceholders(tags, "0", "0"))
+}
+
+// objectTags returns object tags of the session's files
+func (s *Storage) objectTags(task *Task) map[string]string {
+	return replaceTagPlaceholders(s.cfg.Tags, task.id, projectIDOf(task.ctx))
+}
+
+func replaceTagPlaceholders(tags map[string]string, sessionID, projectID string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	replacer := strings.NewReplacer("{sessionID}", sessionID, "{projectID}", projectID)
+	res := make(map[string]string, len(tags))
+	for k, v := range tags {
+		res[k] = replacer.Replace(v)
+	}
+	return res
+}
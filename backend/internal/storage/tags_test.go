@@ -0,0 +1,26 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+)
+
+func TestObjectTags(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{Tags: map[string]string{"project": "{projectID}", "env": "prod"},
+		ProjectLookup: true})
+	task := &Task{ctx: WithProject(context.Background(), "7", ""), id: "5", base: "5"}
+	if err := s.uploadWithRetry(task, bytes.NewBufferString("data"), "5"+string(DEV), DEV, nil); err != nil {
+		t.Fatal(err)
+	}
+	if obj, _ := objStorage.Object("5" + string(DEV)); obj.Tags["project"] != "7" || obj.Tags["env"] != "prod" {
+		t.Errorf("wrong object tags: %v", obj.Tags)
+	}
+	for _, tags := range []map[string]string{{"aws:env": "prod"}, {"env": "prod?"}, {"project": "{tenantID}"}} {
+		if err := validateTags(tags); err == nil {
+			t.Errorf("tags should be rejected: %v", tags)
+		}
+	}
+}
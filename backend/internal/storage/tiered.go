@@ -0,0 +1,121 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/objectstorage"
+	"openreplay/backend/pkg/objectstorage/store"
+)
+
+// coldStore is the manifest store name of DOM parts uploaded to the cold storage, empty for the primary storage
+const coldStore = "cold"
+
+// newColdStorage returns the object storage for the rarely replayed DOM parts or nil if it isn't configured
+func newColdStorage(cfg *config.Config) (objectstorage.ObjectStorage, error) {
+	if cfg.ColdBucketName == "" {
+		return nil, nil
+	}
+	coldCfg := cfg.ObjectsConfig
+	coldCfg.BucketName = cfg.ColdBucketName
+	if cfg.ColdRegion != "" {
+		coldCfg.AWSRegion = cfg.ColdRegion
+	}
+	objStorage, err := store.NewStore(&coldCfg)
+	if err != nil {
+		return nil, fmt.Errorf("can't init cold object storage: %s", err)
+	}
+	return objStorage, nil
+}
+
+// isColdKey checks that the key is a DOM part after the start one (dom.mobe, dom.mob2, ...), the start part and
+// the indexed DOM object are replayed first and stay in the primary storage
+func isColdKey(key string) bool {
+	i := strings.LastIndex(key, string(DOM))
+	if i < 0 {
+		return false
+	}
+	suffix := key[i+len(DOM):]
+	return suffix != "" && suffix != domPartSuffix(0) && !strings.Contains(suffix, "/")
+}
+
+// tieredStorage uploads cold DOM parts to the cold storage and the rest to the primary one. Cold keys are read from
+// the primary storage if they aren't in the cold one, for sessions uploaded before the cold storage was configured.
+type tieredStorage struct {
+	objectstorage.ObjectStorage
+	cold objectstorage.ObjectStorage
+}
+
+func newTieredStorage(hot, cold objectstorage.ObjectStorage) objectstorage.ObjectStorage {
+	return &tieredStorage{ObjectStorage: hot, cold: cold}
+}
+
+// writeStore returns the storage new objects of the key are uploaded to
+func (t *tieredStorage) writeStore(key string) objectstorage.ObjectStorage {
+	if isColdKey(key) {
+		return t.cold
+	}
+	return t.ObjectStorage
+}
+
+// readStore returns the storage with the object of the key
+func (t *tieredStorage) readStore(key string) objectstorage.ObjectStorage {
+	if isColdKey(key) && t.cold.Exists(key) {
+		return t.cold
+	}
+	return t.ObjectStorage
+}
+
+func (t *tieredStorage) Upload(reader io.Reader, key string, contentType string, compression objectstorage.CompressionType) error {
+	return t.writeStore(key).Upload(reader, key, contentType, compression)
+}
+
+func (t *tieredStorage) UploadWithOptions(reader io.Reader, key string, contentType string, compression objectstorage.CompressionType, opts *objectstorage.UploadOptions) error {
+	return t.writeStore(key).UploadWithOptions(reader, key, contentType, compression, opts)
+}
+
+func (t *tieredStorage) Get(key string) (io.ReadCloser, error) {
+	return t.readStore(key).Get(key)
+}
+
+func (t *tieredStorage) GetRange(key string, offset, size int64) (io.ReadCloser, error) {
+	return t.readStore(key).GetRange(key, offset, size)
+}
+
+func (t *tieredStorage) Head(key string) (*objectstorage.ObjectInfo, error) {
+	return t.readStore(key).Head(key)
+}
+
+func (t *tieredStorage) Exists(key string) bool {
+	return t.readStore(key).Exists(key)
+}
+
+func (t *tieredStorage) Delete(key string) error {
+	return t.readStore(key).Delete(key)
+}
+
+func (t *tieredStorage) GetCreationTime(key string) *time.Time {
+	return t.readStore(key).GetCreationTime(key)
+}
+
+func (t *tieredStorage) GetPreSignedUploadUrl(key string) (string, error) {
+	return t.writeStore(key).GetPreSignedUploadUrl(key)
+}
+
+func (t *tieredStorage) GetPreSignedDownloadUrl(key string, ttl time.Duration, contentEncoding string) (string, error) {
+	return t.readStore(key).GetPreSignedDownloadUrl(key, ttl, contentEncoding)
+}
+
+// manifestStore returns the storage of the manifest part
+func (s *Storage) manifestStore(part manifestPart) (objectstorage.ObjectStorage, error) {
+	if part.Store != coldStore {
+		return s.objStorage, nil
+	}
+	if s.cold == nil {
+		return nil, fmt.Errorf("%s is in the cold storage, but COLD_BUCKET_NAME isn't set", part.Key)
+	}
+	return s.cold, nil
+}
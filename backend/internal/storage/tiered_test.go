@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/objectstorage"
+	"openreplay/backend/pkg/objectstorage/memory"
+)
+
+func TestColdStorage(t *testing.T) {
+	for _, manifest := range []bool{false, true} {
+		s, hot := newTestStorage(t, &config.Config{WriteManifest: manifest})
+		cold := memory.New()
+		s.cold, s.objStorage = cold, newTieredStorage(hot, cold)
+		raw := [][]byte{bytes.Repeat([]byte("dom start "), 100), bytes.Repeat([]byte("dom end "), 50)}
+		task := &Task{ctx: context.Background(), id: "46", base: "46", compression: s.compression}
+		for _, part := range raw {
+			task.doms = append(task.doms, bytes.NewBuffer(part))
+			task.domRawSizes = append(task.domRawSizes, float64(len(part)))
+		}
+		if err := s.uploadParts(task); err != nil {
+			t.Fatal(err)
+		}
+		if manifest {
+			if err := s.uploadManifest(task); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if !hot.Exists("46"+string(DOM)+"s") || hot.Exists("46"+string(DOM)+"e") || !cold.Exists("46"+string(DOM)+"e") {
+			t.Fatalf("dom end part should be in the cold storage, hot: %v, cold: %v", hot.Keys(), cold.Keys())
+		}
+		reader, err := s.Download(46, 0, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res, _ := io.ReadAll(reader); !bytes.Equal(res, bytes.Join(raw, nil)) {
+			t.Errorf("downloaded data mismatch, manifest: %t", manifest)
+		}
+	}
+	// Parts uploaded before the cold storage was configured are read from the primary storage
+	s, hot := newTestStorage(t, &config.Config{})
+	if err := hot.Upload(strings.NewReader("end"), "47"+string(DOM)+"e", "", objectstorage.NoCompression); err != nil {
+		t.Fatal(err)
+	}
+	s.cold, s.objStorage = memory.New(), newTieredStorage(hot, memory.New())
+	if data, err := s.getObject("47" + string(DOM) + "e"); err != nil || string(data) != "end" {
+		t.Errorf("dom end part should be read from the primary storage: %v", err)
+	}
+	if !isColdKey("v2/none/1/46/dom.mob2") || isColdKey("46/dom.mobs") || isColdKey("46/dom.mob") || isColdKey("46/devtools.mob") {
+		t.Error("wrong cold keys")
+	}
+}
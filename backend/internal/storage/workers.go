@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+
+	metrics "openreplay/backend/pkg/metrics/storage"
+)
+
+const (
+	processorPool = "processor"
+	uploaderPool  = "uploader"
+)
+
+// busyWorkers tracks the number of pool workers which are handling a task at the moment
+type busyWorkers struct {
+	pool    string
+	workers int
+	busy    atomic.Int64
+}
+
+func newBusyWorkers(pool string, workers int) *busyWorkers {
+	b := &busyWorkers{pool: pool, workers: workers}
+	b.record(0)
+	return b
+}
+
+// wrap returns the pool handler which updates the busy workers gauge, the gauge is decremented even if the handler panics
+func (b *busyWorkers) wrap(handler func(payload interface{})) func(payload interface{}) {
+	return func(payload interface{}) {
+		b.record(b.busy.Add(1))
+		defer func() {
+			b.record(b.busy.Add(-1))
+		}()
+		handler(payload)
+	}
+}
+
+func (b *busyWorkers) record(busy int64) {
+	metrics.RecordWorkersBusy(float64(busy), float64(b.workers), b.pool)
+}
+
+// recoverWorker keeps the pool worker alive if the handler panics, the session is reported as failed and saved
+// to the dead letter dir if it was already packed
+func (s *Storage) recoverWorker(pool string, handler func(payload interface{})) func(payload interface{}) {
+	return func(payload interface{}) {
+		defer func() {
+			if r := recover(); r != nil {
+				s.onPanic(pool, payload.(*Task), r)
+			}
+		}()
+		handler(payload)
+	}
+}
+
+func (s *Storage) onPanic(pool string, task *Task, r interface{}) {
+	metrics.IncreaseStorageWorkerPanics(pool)
+	s.health.recordPanic()
+	err := fmt.Errorf("%s worker panic: %v", pool, r)
+	s.log.Error(task.ctx, "%s\n%s", err, debug.Stack())
+	if pool == mirrorPool {
+		// The session is already in the primary storage
+		s.releaseBuffers(task)
+		return
+	}
+	packed := task.packErr == nil && (len(task.doms) > 0 || task.domPath != "")
+	if pool == processorPool {
+		// Uploader reports the error and decrements the number of pending tasks
+		if packed {
+			task.processErr = err
+		} else {
+			task.packErr = err
+		}
+		s.uploaderPool.Submit(task)
+		return
+	}
+	if packed {
+		s.onUploadFailed(task, err)
+		s.releaseBuffers(task)
+		return
+	}
+	metrics.IncreaseStorageTotalFailedUploads()
+	s.recordTotalDuration(task, "failed")
+}
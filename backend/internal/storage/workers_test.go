@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/logger"
+	"openreplay/backend/pkg/messages"
+	"openreplay/backend/pkg/objectstorage/memory"
+)
+
+func TestWorkerPanic(t *testing.T) {
+	panicking := testProcessor(func(task *Task) error {
+		if task.ID() == "31" {
+			var buf *bytes.Buffer
+			buf.Reset()
+		}
+		return nil
+	})
+	objStorage := memory.New()
+	s, err := New(&config.Config{FSDir: t.TempDir(), DeadLetterDir: t.TempDir(), FileSplitSize: 1000,
+		MaxFileSize: 1 << 20, Workers: 1, CompressionAlgo: "none"}, logger.New(), objStorage, nil, panicking)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []uint64{31, 32} {
+		if err := os.WriteFile(fmt.Sprintf("%s/%d", s.cfg.FSDir, id), []byte("dom"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		msg := &messages.SessionEnd{}
+		msg.SetSessionID(id)
+		if err := s.Process(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !objStorage.Exists("32" + string(DOM) + "s") {
+		t.Error("session wasn't uploaded after worker panic")
+	}
+	if _, err := os.Stat(s.cfg.DeadLetterDir + "/31/" + deadLetterManifest); err != nil {
+		t.Errorf("panicked session wasn't saved to dead letter dir: %s", err)
+	}
+}
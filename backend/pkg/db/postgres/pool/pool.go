@@ -29,25 +29,33 @@ type poolImpl struct {
 
 func (p *poolImpl) Query(sql string, args ...interface{}) (pgx.Rows, error) {
 	start := time.Now()
-	res, err := p.conn.Query(getTimeoutContext(), sql, args...)
+	ctx, cancel := getTimeoutContext()
+	res, err := p.conn.Query(ctx, sql, args...)
 	method, table := methodName(sql)
 	database.RecordRequestDuration(float64(time.Now().Sub(start).Milliseconds()), method, table)
 	database.IncreaseTotalRequests(method, table)
-	return res, err
+	if err != nil {
+		cancel()
+		return res, err
+	}
+	return &timeoutRows{Rows: res, cancel: cancel}, nil
 }
 
 func (p *poolImpl) QueryRow(sql string, args ...interface{}) pgx.Row {
 	start := time.Now()
-	res := p.conn.QueryRow(getTimeoutContext(), sql, args...)
+	ctx, cancel := getTimeoutContext()
+	res := p.conn.QueryRow(ctx, sql, args...)
 	method, table := methodName(sql)
 	database.RecordRequestDuration(float64(time.Now().Sub(start).Milliseconds()), method, table)
 	database.IncreaseTotalRequests(method, table)
-	return res
+	return &timeoutRow{Row: res, cancel: cancel}
 }
 
 func (p *poolImpl) Exec(sql string, arguments ...interface{}) error {
 	start := time.Now()
-	_, err := p.conn.Exec(getTimeoutContext(), sql, arguments...)
+	ctx, cancel := getTimeoutContext()
+	defer cancel()
+	_, err := p.conn.Exec(ctx, sql, arguments...)
 	method, table := methodName(sql)
 	database.RecordRequestDuration(float64(time.Now().Sub(start).Milliseconds()), method, table)
 	database.IncreaseTotalRequests(method, table)
@@ -56,10 +64,11 @@ func (p *poolImpl) Exec(sql string, arguments ...interface{}) error {
 
 func (p *poolImpl) SendBatch(b *pgx.Batch) pgx.BatchResults {
 	start := time.Now()
-	res := p.conn.SendBatch(getTimeoutContext(), b)
+	ctx, cancel := getTimeoutContext()
+	res := p.conn.SendBatch(ctx, b)
 	database.RecordRequestDuration(float64(time.Now().Sub(start).Milliseconds()), "sendBatch", "")
 	database.IncreaseTotalRequests("sendBatch", "")
-	return res
+	return &timeoutBatchResults{BatchResults: res, cancel: cancel}
 }
 
 func (p *poolImpl) Begin() (*_Tx, error) {
@@ -122,9 +131,49 @@ func (tx *_Tx) commit() error {
 
 // TX - end
 
-func getTimeoutContext() context.Context {
-	ctx, _ := context.WithTimeout(context.Background(), time.Second*30)
-	return ctx
+func getTimeoutContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), time.Second*30)
+}
+
+// Results are read after the request method returns, so the timeout context is released once they are consumed
+
+type timeoutRows struct {
+	pgx.Rows
+	cancel context.CancelFunc
+}
+
+// Next closes rows after the last one, callers don't always call Close
+func (r *timeoutRows) Next() bool {
+	if r.Rows.Next() {
+		return true
+	}
+	r.cancel()
+	return false
+}
+
+func (r *timeoutRows) Close() {
+	r.Rows.Close()
+	r.cancel()
+}
+
+type timeoutRow struct {
+	pgx.Row
+	cancel context.CancelFunc
+}
+
+func (r *timeoutRow) Scan(dest ...interface{}) error {
+	defer r.cancel()
+	return r.Row.Scan(dest...)
+}
+
+type timeoutBatchResults struct {
+	pgx.BatchResults
+	cancel context.CancelFunc
+}
+
+func (r *timeoutBatchResults) Close() error {
+	defer r.cancel()
+	return r.BatchResults.Close()
 }
 
 func methodName(sql string) (string, string) {
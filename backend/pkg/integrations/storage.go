@@ -43,7 +43,8 @@ func (s *storageImpl) UnListen() error {
 }
 
 func (s *storageImpl) CheckNew() (*model.Integration, error) {
-	ctx, _ := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
 	notification, err := s.conn.WaitForNotification(ctx)
 	if err != nil {
 		return nil, err
@@ -6,6 +6,7 @@ import (
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 	"os"
+	"sort"
 )
 
 type Logger interface {
@@ -16,6 +17,13 @@ type Logger interface {
 	Fatal(ctx context.Context, message string, args ...interface{})
 }
 
+type fieldsKey struct{}
+
+// WithFields returns a context with additional fields for every log line written with this context
+func WithFields(ctx context.Context, fields map[string]interface{}) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, fields)
+}
+
 type loggerImpl struct {
 	l *zap.Logger
 }
@@ -49,6 +57,16 @@ func (l *loggerImpl) prepare(ctx context.Context, logger *zap.Logger) *zap.Logge
 	if batch, ok := ctx.Value("batch").(string); ok {
 		logger = logger.With(zap.String("batch", batch))
 	}
+	if fields, ok := ctx.Value(fieldsKey{}).(map[string]interface{}); ok {
+		keys := make([]string, 0, len(fields))
+		for key := range fields {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			logger = logger.With(zap.Any(key, fields[key]))
+		}
+	}
 	return logger
 }
 
@@ -22,8 +22,8 @@ func New(log logger.Logger, cs []prometheus.Collector) {
 		collectors.NewGoCollector(),
 		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
 	)
-	// Add extra metrics
-	registry.MustRegister(cs...)
+	// Add extra metrics, services keep working without metrics which can't be registered
+	register(log, registry, cs)
 	// Expose /metrics HTTP endpoint using the created custom registry.
 	http.Handle(
 		"/metrics", promhttp.HandlerFor(
@@ -36,3 +36,17 @@ func New(log logger.Logger, cs []prometheus.Collector) {
 		log.Error(context.Background(), "%v", http.ListenAndServe(":8888", nil))
 	}()
 }
+
+// register adds collectors one by one and logs failed ones, returns the number of registered collectors.
+// Recording to a not registered collector is harmless, its values just aren't exported.
+func register(log logger.Logger, registry prometheus.Registerer, cs []prometheus.Collector) int {
+	registered := 0
+	for _, c := range cs {
+		if err := registry.Register(c); err != nil {
+			log.Error(context.Background(), "can't register metric: %s", err)
+			continue
+		}
+		registered++
+	}
+	return registered
+}
@@ -0,0 +1,22 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"openreplay/backend/pkg/logger"
+	storageMetrics "openreplay/backend/pkg/metrics/storage"
+)
+
+func TestRegisterFailure(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	collectors := storageMetrics.List()
+	// Duplicated collectors fail to register
+	if n := register(logger.New(), registry, append(collectors, collectors[0])); n != len(collectors) {
+		t.Fatalf("wrong number of registered collectors: %d, expected: %d", n, len(collectors))
+	}
+	// Recording to not registered metrics doesn't panic
+	storageMetrics.IncreaseStorageTotalSessions()
+	storageMetrics.RecordSessionSize(1, "dom", "", "")
+}
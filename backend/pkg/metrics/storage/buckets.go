@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultDurationBuckets are the buckets of storage duration histograms from 1 millisecond to 5 minutes, tuned
+// for typical session files from a few kilobytes to hundreds of megabytes
+var DefaultDurationBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300}
+
+// durationHistogram is a histogram of durations in seconds, its buckets can be changed before registration
+type durationHistogram struct {
+	vec    *prometheus.HistogramVec
+	opts   prometheus.HistogramOpts
+	labels []string
+}
+
+func newDurationHistogram(name, help string, labels ...string) *durationHistogram {
+	h := &durationHistogram{
+		opts: prometheus.HistogramOpts{
+			Namespace: "storage",
+			Name:      name,
+			Help:      help,
+			Buckets:   DefaultDurationBuckets,
+		},
+		labels: labels,
+	}
+	h.vec = prometheus.NewHistogramVec(h.opts, labels)
+	return h
+}
+
+func durationHistograms() map[string]*durationHistogram {
+	return map[string]*durationHistogram{
+		"read_duration":                  storageSessionReadDuration,
+		"session_total_duration":         storageSessionTotalDuration,
+		"sort_duration":                  storageSessionSortDuration,
+		"encryption_duration":            storageSessionEncryptionDuration,
+		"compress_duration":              storageSessionCompressDuration,
+		"upload_duration":                storageSessionUploadDuration,
+		"put_duration":                   storagePutDuration,
+		"task_queue_wait_duration":       storageTaskQueueWaitDuration,
+		"upload_slot_wait_duration":      storageUploadSlotWaitDuration,
+		"compression_slot_wait_duration": storageCompressionSlotWaitDuration,
+	}
+}
+
+// SetDurationBuckets changes buckets of duration histograms, it should be called before the registration of List.
+// The spec is a list of metric names with bucket boundaries in milliseconds, for example:
+// "read_duration=1,5,10,25,50,100;upload_duration=10,50,100,250,500,1000". Not listed histograms keep default buckets.
+func SetDurationBuckets(spec string) error {
+	histograms := durationHistograms()
+	for _, item := range strings.Split(spec, ";") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, values, ok := strings.Cut(item, "=")
+		if !ok {
+			return fmt.Errorf("wrong duration buckets format: %s", item)
+		}
+		h, ok := histograms[strings.TrimSpace(name)]
+		if !ok {
+			return fmt.Errorf("unknown duration histogram: %s", name)
+		}
+		buckets, err := parseMillisBuckets(values)
+		if err != nil {
+			return fmt.Errorf("wrong %s buckets: %s", name, err)
+		}
+		h.opts.Buckets = buckets
+		h.vec = prometheus.NewHistogramVec(h.opts, h.labels)
+	}
+	return nil
+}
+
+func parseMillisBuckets(values string) ([]float64, error) {
+	var buckets []float64
+	for _, value := range strings.Split(values, ",") {
+		millis, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, err
+		}
+		if millis <= 0 {
+			return nil, fmt.Errorf("bucket boundary should be positive: %v", millis)
+		}
+		if len(buckets) > 0 && millis/1000.0 <= buckets[len(buckets)-1] {
+			return nil, fmt.Errorf("bucket boundaries should be increasing: %s", values)
+		}
+		buckets = append(buckets, millis/1000.0)
+	}
+	return buckets, nil
+}
@@ -1,6 +1,8 @@
 package storage
 
 import (
+	"strconv"
+
 	"github.com/prometheus/client_golang/prometheus"
 	"openreplay/backend/pkg/metrics/common"
 )
@@ -12,11 +14,11 @@ var storageSessionSize = prometheus.NewHistogramVec(
 		Help:      "A histogram displaying the size of each session file in bytes prior to any manipulation.",
 		Buckets:   common.DefaultSizeBuckets,
 	},
-	[]string{"file_type"},
+	[]string{"file_type", "project", "sdk"},
 )
 
-func RecordSessionSize(fileSize float64, fileType string) {
-	storageSessionSize.WithLabelValues(fileType).Observe(fileSize)
+func RecordSessionSize(fileSize float64, fileType string, project, sdk string) {
+	storageSessionSize.WithLabelValues(fileType, project, sdk).Observe(fileSize)
 }
 
 var storageTotalSessions = prometheus.NewCounter(
@@ -31,6 +33,117 @@ func IncreaseStorageTotalSessions() {
 	storageTotalSessions.Inc()
 }
 
+var storageTotalFailedUploads = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "failed_uploads_total",
+		Help:      "A counter displaying the total number of sessions which failed to upload to the object storage.",
+	},
+)
+
+func IncreaseStorageTotalFailedUploads() {
+	storageTotalFailedUploads.Inc()
+}
+
+var storageTotalDeadLetteredSessions = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "dead_lettered_sessions_total",
+		Help:      "A counter displaying the total number of failed sessions saved to the dead letter dir.",
+	},
+)
+
+func IncreaseStorageDeadLetteredSessions() {
+	storageTotalDeadLetteredSessions.Inc()
+}
+
+var storageDeleteErrors = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "delete_errors_total",
+		Help:      "A counter displaying the total number of errors during local session files removal.",
+	},
+)
+
+func IncreaseStorageDeleteErrors() {
+	storageDeleteErrors.Inc()
+}
+
+var storageDevtoolsMissing = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "devtools_missing_total",
+		Help:      "A counter displaying the total number of sessions without devtools file.",
+	},
+)
+
+func IncreaseStorageDevtoolsMissing() {
+	storageDevtoolsMissing.Inc()
+}
+
+var storageEmptySessions = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "empty_sessions_total",
+		Help:      "A counter displaying the total number of skipped empty session files.",
+	},
+	[]string{"file_type"},
+)
+
+func IncreaseStorageEmptySessions(fileType string) {
+	storageEmptySessions.WithLabelValues(fileType).Inc()
+}
+
+var storageChecksumMismatch = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "checksum_mismatch_total",
+		Help:      "A counter displaying the total number of uploaded objects which don't match the uploaded data.",
+	},
+)
+
+func IncreaseStorageChecksumMismatch() {
+	storageChecksumMismatch.Inc()
+}
+
+var storageSampledOutSessions = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "sessions_sampled_out_total",
+		Help:      "A counter displaying the total number of sessions which weren't stored because of sampling.",
+	},
+)
+
+func IncreaseStorageSampledOutSessions() {
+	storageSampledOutSessions.Inc()
+}
+
+var storageBigFilesSkipped = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "big_files_skipped_total",
+		Help:      "A counter displaying the total number of skipped session files bigger than the max file size.",
+	},
+	[]string{"file_type"},
+)
+
+func IncreaseStorageBigFilesSkipped(fileType string) {
+	storageBigFilesSkipped.WithLabelValues(fileType).Inc()
+}
+
+var storageCompressionErrors = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "compression_errors_total",
+		Help:      "A counter displaying the total number of session files which failed to compress.",
+	},
+	[]string{"file_type"},
+)
+
+func IncreaseStorageCompressionErrors(fileType string) {
+	storageCompressionErrors.WithLabelValues(fileType).Inc()
+}
+
 var storageSkippedSessionSize = prometheus.NewHistogramVec(
 	prometheus.HistogramOpts{
 		Namespace: "storage",
@@ -57,99 +170,581 @@ func IncreaseStorageTotalSkippedSessions() {
 	storageTotalSkippedSessions.Inc()
 }
 
-var storageSessionReadDuration = prometheus.NewHistogramVec(
+var storageSessionReadDuration = newDurationHistogram(
+	"read_duration_seconds",
+	"A histogram displaying the duration of reading for each session in seconds.",
+	"file_type", "project", "sdk",
+)
+
+func RecordSessionReadDuration(durMillis float64, fileType string, project, sdk string) {
+	storageSessionReadDuration.vec.WithLabelValues(fileType, project, sdk).Observe(durMillis / 1000.0)
+}
+
+var storageSessionTotalDuration = newDurationHistogram(
+	"session_total_duration_seconds",
+	"A histogram displaying the duration from the start of processing to the end of upload for each session in seconds.",
+	"split", "outcome", "project", "sdk",
+)
+
+func RecordSessionTotalDuration(durMillis float64, split bool, outcome, project, sdk string) {
+	storageSessionTotalDuration.vec.WithLabelValues(strconv.FormatBool(split), outcome, project, sdk).Observe(durMillis / 1000.0)
+}
+
+var storageSessionSortDuration = newDurationHistogram(
+	"sort_duration_seconds",
+	"A histogram displaying the duration of sorting for each session in seconds.",
+	"file_type", "project", "sdk",
+)
+
+func RecordSessionSortDuration(durMillis float64, fileType string, project, sdk string) {
+	storageSessionSortDuration.vec.WithLabelValues(fileType, project, sdk).Observe(durMillis / 1000.0)
+}
+
+var storageSessionEncryptionDuration = newDurationHistogram(
+	"encryption_duration_seconds",
+	"A histogram displaying the duration of encoding for each session in seconds.",
+	"file_type", "project", "sdk",
+)
+
+func RecordSessionEncryptionDuration(durMillis float64, fileType string, project, sdk string) {
+	storageSessionEncryptionDuration.vec.WithLabelValues(fileType, project, sdk).Observe(durMillis / 1000.0)
+}
+
+var storageSessionCompressDuration = newDurationHistogram(
+	"compress_duration_seconds",
+	"A histogram displaying the duration of compressing for each session in seconds.",
+	"file_type", "project", "sdk",
+)
+
+func RecordSessionCompressDuration(durMillis float64, fileType string, project, sdk string) {
+	storageSessionCompressDuration.vec.WithLabelValues(fileType, project, sdk).Observe(durMillis / 1000.0)
+}
+
+var storagePutDuration = newDurationHistogram(
+	"put_duration_seconds",
+	"A histogram displaying the duration of each object upload request in seconds, attempt is 0 for the first try.",
+	"file_type", "attempt",
+)
+
+func RecordPutDuration(durMillis float64, fileType string, attempt int) {
+	storagePutDuration.vec.WithLabelValues(fileType, strconv.Itoa(attempt)).Observe(durMillis / 1000.0)
+}
+
+var storageSessionUploadDuration = newDurationHistogram(
+	"upload_duration_seconds",
+	"A histogram displaying the duration of uploading to s3 for each session in seconds.",
+	"file_type", "project", "sdk",
+)
+
+func RecordSessionUploadDuration(durMillis float64, fileType string, project, sdk string) {
+	storageSessionUploadDuration.vec.WithLabelValues(fileType, project, sdk).Observe(durMillis / 1000.0)
+}
+
+var storageSessionCompressionRatio = prometheus.NewHistogramVec(
 	prometheus.HistogramOpts{
 		Namespace: "storage",
-		Name:      "read_duration_seconds",
-		Help:      "A histogram displaying the duration of reading for each session in seconds.",
+		Name:      "compression_ratio",
+		Help:      "A histogram displaying the compression ratio of mob files for each session.",
 		Buckets:   common.DefaultDurationBuckets,
 	},
 	[]string{"file_type"},
 )
 
-func RecordSessionReadDuration(durMillis float64, fileType string) {
-	storageSessionReadDuration.WithLabelValues(fileType).Observe(durMillis / 1000.0)
+func RecordSessionCompressionRatio(ratio float64, fileType string) {
+	storageSessionCompressionRatio.WithLabelValues(fileType).Observe(ratio)
 }
 
-var storageSessionSortDuration = prometheus.NewHistogramVec(
+var storageZstdCompressionRatio = prometheus.NewHistogramVec(
 	prometheus.HistogramOpts{
 		Namespace: "storage",
-		Name:      "sort_duration_seconds",
-		Help:      "A histogram displaying the duration of sorting for each session in seconds.",
+		Name:      "zstd_compression_ratio",
+		Help:      "A histogram displaying the zstd compression ratio of session files with and without the dictionary.",
 		Buckets:   common.DefaultDurationBuckets,
 	},
-	[]string{"file_type"},
+	[]string{"file_type", "dictionary"},
 )
 
-func RecordSessionSortDuration(durMillis float64, fileType string) {
-	storageSessionSortDuration.WithLabelValues(fileType).Observe(durMillis / 1000.0)
+func RecordZstdCompressionRatio(ratio float64, fileType string, dictionary bool) {
+	storageZstdCompressionRatio.WithLabelValues(fileType, strconv.FormatBool(dictionary)).Observe(ratio)
 }
 
-var storageSessionEncryptionDuration = prometheus.NewHistogramVec(
+var storageSessionCompressedSize = prometheus.NewHistogramVec(
 	prometheus.HistogramOpts{
 		Namespace: "storage",
-		Name:      "encryption_duration_seconds",
-		Help:      "A histogram displaying the duration of encoding for each session in seconds.",
-		Buckets:   common.DefaultDurationBuckets,
+		Name:      "compressed_size_bytes",
+		Help:      "A histogram displaying the size of each compressed (and encrypted) session file part in bytes.",
+		Buckets:   common.DefaultSizeBuckets,
 	},
 	[]string{"file_type"},
 )
 
-func RecordSessionEncryptionDuration(durMillis float64, fileType string) {
-	storageSessionEncryptionDuration.WithLabelValues(fileType).Observe(durMillis / 1000.0)
+func RecordSessionCompressedSize(fileSize float64, fileType string) {
+	storageSessionCompressedSize.WithLabelValues(fileType).Observe(fileSize)
 }
 
-var storageSessionCompressDuration = prometheus.NewHistogramVec(
-	prometheus.HistogramOpts{
+var storageStoredBytes = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
 		Namespace: "storage",
-		Name:      "compress_duration_seconds",
-		Help:      "A histogram displaying the duration of compressing for each session in seconds.",
-		Buckets:   common.DefaultDurationBuckets,
+		Name:      "stored_bytes_total",
+		Help:      "A counter displaying the total size of compressed (and encrypted) objects uploaded to the object storage in bytes.",
+	},
+	[]string{"file_type"},
+)
+
+func IncreaseStorageStoredBytes(size float64, fileType string) {
+	storageStoredBytes.WithLabelValues(fileType).Add(size)
+}
+
+var storageUploadRetries = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "upload_retries_total",
+		Help:      "A counter displaying the total number of retried uploads to the object storage.",
 	},
 	[]string{"file_type"},
 )
 
-func RecordSessionCompressDuration(durMillis float64, fileType string) {
-	storageSessionCompressDuration.WithLabelValues(fileType).Observe(durMillis / 1000.0)
+func IncreaseStorageUploadRetries(fileType string) {
+	storageUploadRetries.WithLabelValues(fileType).Inc()
 }
 
-var storageSessionUploadDuration = prometheus.NewHistogramVec(
+var storageUploadTimeouts = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "upload_timeouts_total",
+		Help:      "A counter displaying the total number of upload attempts aborted by the upload timeout.",
+	},
+	[]string{"file_type"},
+)
+
+func IncreaseStorageUploadTimeouts(fileType string) {
+	storageUploadTimeouts.WithLabelValues(fileType).Inc()
+}
+
+var storageMultipartUploadParts = prometheus.NewHistogram(
 	prometheus.HistogramOpts{
 		Namespace: "storage",
-		Name:      "upload_duration_seconds",
-		Help:      "A histogram displaying the duration of uploading to s3 for each session in seconds.",
-		Buckets:   common.DefaultDurationBuckets,
+		Name:      "multipart_upload_parts",
+		Help:      "A histogram displaying the number of parts of each multipart upload.",
+		Buckets:   common.DefaultBuckets,
+	},
+)
+
+func RecordMultipartUploadParts(parts float64) {
+	storageMultipartUploadParts.Observe(parts)
+}
+
+var storageTaskQueueDepth = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: "storage",
+		Name:      "task_queue_depth",
+		Help:      "A gauge displaying the number of sessions submitted for processing but not uploaded yet.",
+	},
+)
+
+func RecordTaskQueueDepth(depth float64) {
+	storageTaskQueueDepth.Set(depth)
+}
+
+var storageTaskQueueWaitDuration = newDurationHistogram(
+	"task_queue_wait_duration_seconds",
+	"A histogram displaying the time each session spent in the queue before processing in seconds.",
+)
+
+func RecordTaskQueueWaitDuration(durMillis float64) {
+	storageTaskQueueWaitDuration.vec.WithLabelValues().Observe(durMillis / 1000.0)
+}
+
+var storageUploadSlotWaitDuration = newDurationHistogram(
+	"upload_slot_wait_duration_seconds",
+	"A histogram displaying the time each object upload waited for a free upload slot in seconds.",
+	"file_type",
+)
+
+func RecordUploadSlotWaitDuration(durMillis float64, fileType string) {
+	storageUploadSlotWaitDuration.vec.WithLabelValues(fileType).Observe(durMillis / 1000.0)
+}
+
+var storageCompressionSlotWaitDuration = newDurationHistogram(
+	"compression_slot_wait_duration_seconds",
+	"A histogram displaying the time each file or DOM part waited for a free compression slot in seconds.",
+	"file_type",
+)
+
+func RecordCompressionSlotWaitDuration(durMillis float64, fileType string) {
+	storageCompressionSlotWaitDuration.vec.WithLabelValues(fileType).Observe(durMillis / 1000.0)
+}
+
+var storageRateLimited = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "rate_limited_total",
+		Help:      "A counter displaying the total number of sessions delayed or rejected by the rate limiter.",
+	},
+	[]string{"policy"},
+)
+
+func IncreaseStorageRateLimited(policy string) {
+	storageRateLimited.WithLabelValues(policy).Inc()
+}
+
+var storageUploadedCallbacksDropped = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "uploaded_callbacks_dropped_total",
+		Help:      "A counter displaying the total number of uploaded sessions skipped by the callback because of the full queue.",
+	},
+)
+
+func IncreaseStorageUploadedCallbacksDropped() {
+	storageUploadedCallbacksDropped.Inc()
+}
+
+var storageQueueRejections = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "queue_rejections_total",
+		Help:      "A counter displaying the total number of sessions rejected or dropped because of the full queue.",
+	},
+	[]string{"policy"},
+)
+
+func IncreaseStorageQueueRejections(policy string) {
+	storageQueueRejections.WithLabelValues(policy).Inc()
+}
+
+var storageWorkersBusy = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: "storage",
+		Name:      "workers_busy",
+		Help:      "A gauge displaying the number of pool workers handling a session at the moment.",
+	},
+	[]string{"pool"},
+)
+
+var storageWorkersSaturation = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Namespace: "storage",
+		Name:      "workers_saturation",
+		Help:      "A gauge displaying the ratio of busy pool workers to the total number of pool workers.",
+	},
+	[]string{"pool"},
+)
+
+func RecordWorkersBusy(busy, workers float64, pool string) {
+	storageWorkersBusy.WithLabelValues(pool).Set(busy)
+	if workers > 0 {
+		storageWorkersSaturation.WithLabelValues(pool).Set(busy / workers)
+	}
+}
+
+var storageWorkerPanics = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "worker_panics_total",
+		Help:      "A counter displaying the total number of recovered panics in pool workers.",
+	},
+	[]string{"pool"},
+)
+
+func IncreaseStorageWorkerPanics(pool string) {
+	storageWorkerPanics.WithLabelValues(pool).Inc()
+}
+
+var storageUploadsSkippedExisting = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "uploads_skipped_existing_total",
+		Help:      "A counter displaying the total number of skipped uploads of already stored objects.",
 	},
 	[]string{"file_type"},
 )
 
-func RecordSessionUploadDuration(durMillis float64, fileType string) {
-	storageSessionUploadDuration.WithLabelValues(fileType).Observe(durMillis / 1000.0)
+func IncreaseStorageUploadsSkippedExisting(fileType string) {
+	storageUploadsSkippedExisting.WithLabelValues(fileType).Inc()
 }
 
-var storageSessionCompressionRatio = prometheus.NewHistogramVec(
+var storageGzipLevel = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "gzip_level_total",
+		Help:      "A counter displaying the total number of files compressed with each gzip level.",
+	},
+	[]string{"level"},
+)
+
+func IncreaseStorageGzipLevel(level int) {
+	storageGzipLevel.WithLabelValues(strconv.Itoa(level)).Inc()
+}
+
+var storageRecompressionSkipped = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "recompression_skipped_total",
+		Help:      "A counter displaying the total number of already compressed session files uploaded without compression.",
+	},
+	[]string{"file_type"},
+)
+
+func IncreaseStorageRecompressionSkipped(fileType string) {
+	storageRecompressionSkipped.WithLabelValues(fileType).Inc()
+}
+
+var storageDomSplits = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "dom_splits_total",
+		Help:      "A counter displaying the total number of DOM files by the split decision.",
+	},
+	[]string{"split"},
+)
+
+func IncreaseStorageDomSplits(split bool) {
+	storageDomSplits.WithLabelValues(strconv.FormatBool(split)).Inc()
+}
+
+var storageInvalidMessages = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "invalid_messages_total",
+		Help:      "A counter displaying the total number of rejected malformed session end messages.",
+	},
+	[]string{"reason"},
+)
+
+func IncreaseStorageInvalidMessages(reason string) {
+	storageInvalidMessages.WithLabelValues(reason).Inc()
+}
+
+var storageReencryptedObjects = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "reencrypted_objects_total",
+		Help:      "A counter displaying the total number of objects re-encrypted with the new key.",
+	},
+	[]string{"file_type"},
+)
+
+func IncreaseStorageReencryptedObjects(fileType string) {
+	storageReencryptedObjects.WithLabelValues(fileType).Inc()
+}
+
+var storageDedupHits = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "dedup_hits_total",
+		Help:      "A counter displaying the total number of files stored as pointers to already uploaded objects.",
+	},
+	[]string{"file_type"},
+)
+
+func IncreaseStorageDedupHits(fileType string) {
+	storageDedupHits.WithLabelValues(fileType).Inc()
+}
+
+var storageSessionsSplit = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "sessions_split_total",
+		Help:      "A counter displaying the total number of sessions with DOM file bigger than FILE_SPLIT_SIZE split into parts.",
+	},
+)
+
+var storageSessionsUnsplit = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "sessions_unsplit_total",
+		Help:      "A counter displaying the total number of sessions with DOM file stored whole.",
+	},
+)
+
+func IncreaseStorageSessionsSplit(split bool) {
+	if split {
+		storageSessionsSplit.Inc()
+	} else {
+		storageSessionsUnsplit.Inc()
+	}
+}
+
+var storageDomPartSize = prometheus.NewHistogramVec(
 	prometheus.HistogramOpts{
 		Namespace: "storage",
-		Name:      "compression_ratio",
-		Help:      "A histogram displaying the compression ratio of mob files for each session.",
-		Buckets:   common.DefaultDurationBuckets,
+		Name:      "dom_part_size_bytes",
+		Help:      "A histogram displaying the raw size of each DOM part in bytes, whole is used for not split files.",
+		Buckets:   common.DefaultSizeBuckets,
+	},
+	[]string{"part"},
+)
+
+func RecordStorageDomPartSize(size float64, part string) {
+	storageDomPartSize.WithLabelValues(part).Observe(size)
+}
+
+var storageSlowReads = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "slow_reads_total",
+		Help:      "A counter displaying the total number of session file reads longer than the slow read threshold.",
 	},
 	[]string{"file_type"},
 )
 
-func RecordSessionCompressionRatio(ratio float64, fileType string) {
-	storageSessionCompressionRatio.WithLabelValues(fileType).Observe(ratio)
+func IncreaseStorageSlowReads(fileType string) {
+	storageSlowReads.WithLabelValues(fileType).Inc()
+}
+
+var storagePartialUploadFailures = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "partial_upload_failures_total",
+		Help:      "A counter displaying the total number of split sessions with only some of DOM parts uploaded.",
+	},
+)
+
+func IncreaseStoragePartialUploadFailures() {
+	storagePartialUploadFailures.Inc()
+}
+
+var storageInFlightBytes = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: "storage",
+		Name:      "in_flight_bytes",
+		Help:      "A gauge displaying the reserved memory budget of raw session files in bytes.",
+	},
+)
+
+func RecordInFlightBytes(size float64) {
+	storageInFlightBytes.Set(size)
+}
+
+var storageBreakerState = prometheus.NewGauge(
+	prometheus.GaugeOpts{
+		Namespace: "storage",
+		Name:      "breaker_state",
+		Help:      "A gauge displaying the object storage circuit breaker state: 0 - closed, 1 - half-open, 2 - open.",
+	},
+)
+
+func RecordBreakerState(state float64) {
+	storageBreakerState.Set(state)
+}
+
+var storageBreakerRejections = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "breaker_rejections_total",
+		Help:      "A counter displaying the total number of uploads rejected by the open circuit breaker.",
+	},
+)
+
+func IncreaseStorageBreakerRejections() {
+	storageBreakerRejections.Inc()
+}
+
+var storageMirrorFailures = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "mirror_failures_total",
+		Help:      "A counter displaying the total number of session files which failed to upload to the mirror storage.",
+	},
+	[]string{"file_type"},
+)
+
+func IncreaseStorageMirrorFailures(fileType string) {
+	storageMirrorFailures.WithLabelValues(fileType).Inc()
+}
+
+var storageMirrorDropped = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "mirror_dropped_total",
+		Help:      "A counter displaying the total number of sessions which weren't mirrored because the mirror queue was full.",
+	},
+)
+
+func IncreaseStorageMirrorDropped() {
+	storageMirrorDropped.Inc()
+}
+
+var storageKeyCollisions = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "key_collisions_total",
+		Help:      "A counter displaying the total number of sessions which already existed under the v1 object key.",
+	},
+)
+
+func IncreaseStorageKeyCollisions() {
+	storageKeyCollisions.Inc()
+}
+
+var storageSessionsDeleted = prometheus.NewCounter(
+	prometheus.CounterOpts{
+		Namespace: "storage",
+		Name:      "sessions_deleted_total",
+		Help:      "A counter displaying the total number of sessions deleted from the object storage.",
+	},
+)
+
+func IncreaseStorageSessionsDeleted() {
+	storageSessionsDeleted.Inc()
 }
 
 func List() []prometheus.Collector {
 	return []prometheus.Collector{
 		storageSessionSize,
 		storageTotalSessions,
-		storageSessionReadDuration,
-		storageSessionSortDuration,
-		storageSessionEncryptionDuration,
-		storageSessionCompressDuration,
-		storageSessionUploadDuration,
+		storageTotalFailedUploads,
+		storageKeyCollisions,
+		storageSessionsDeleted,
+		storageMirrorFailures,
+		storageMirrorDropped,
+		storagePartialUploadFailures,
+		storageTotalDeadLetteredSessions,
+		storageDeleteErrors,
+		storageDevtoolsMissing,
+		storageEmptySessions,
+		storageSampledOutSessions,
+		storageBigFilesSkipped,
+		storageCompressionErrors,
+		storageChecksumMismatch,
+		storageSessionReadDuration.vec,
+		storageSlowReads,
+		storageSessionTotalDuration.vec,
+		storageSessionSortDuration.vec,
+		storageSessionEncryptionDuration.vec,
+		storageSessionCompressDuration.vec,
+		storageSessionUploadDuration.vec,
+		storagePutDuration.vec,
 		storageSessionCompressionRatio,
+		storageDomSplits,
+		storageSessionsSplit,
+		storageDedupHits,
+		storageInvalidMessages,
+		storageReencryptedObjects,
+		storageSessionsUnsplit,
+		storageDomPartSize,
+		storageZstdCompressionRatio,
+		storageGzipLevel,
+		storageRecompressionSkipped,
+		storageSessionCompressedSize,
+		storageStoredBytes,
+		storageUploadRetries,
+		storageUploadTimeouts,
+		storageBreakerState,
+		storageBreakerRejections,
+		storageUploadsSkippedExisting,
+		storageMultipartUploadParts,
+		storageTaskQueueDepth,
+		storageInFlightBytes,
+		storageTaskQueueWaitDuration.vec,
+		storageUploadSlotWaitDuration.vec,
+		storageCompressionSlotWaitDuration.vec,
+		storageQueueRejections,
+		storageRateLimited,
+		storageUploadedCallbacksDropped,
+		storageWorkersBusy,
+		storageWorkersSaturation,
+		storageWorkerPanics,
 	}
 }
@@ -0,0 +1,176 @@
+package gcs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/storage/v1"
+
+	objConfig "openreplay/backend/internal/config/objectstorage"
+	"openreplay/backend/pkg/objectstorage"
+)
+
+var (
+	errTagsNotSupported    = errors.New("object tags aren't supported by gcs")
+	errPresignNotSupported = errors.New("pre-signed urls aren't supported by gcs")
+)
+
+type storageImpl struct {
+	svc    *storage.Service
+	bucket string
+}
+
+func NewStorage(cfg *objConfig.ObjectsConfig) (objectstorage.ObjectStorage, error) {
+	if cfg == nil {
+		return nil, fmt.Errorf("gcs config is empty")
+	}
+	var opts []option.ClientOption
+	if cfg.GCPCredentialsPath != "" {
+		opts = append(opts, option.WithCredentialsFile(cfg.GCPCredentialsPath))
+	}
+	svc, err := storage.NewService(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create gcs client: %v", err)
+	}
+	return &storageImpl{
+		svc:    svc,
+		bucket: cfg.BucketName,
+	}, nil
+}
+
+func (s *storageImpl) Upload(reader io.Reader, key string, contentType string, compression objectstorage.CompressionType) error {
+	return s.UploadWithOptions(reader, key, contentType, compression, nil)
+}
+
+func (s *storageImpl) UploadWithOptions(reader io.Reader, key string, contentType string, compression objectstorage.CompressionType, opts *objectstorage.UploadOptions) error {
+	obj := &storage.Object{
+		Name:         strings.TrimPrefix(key, "/"),
+		ContentType:  contentType,
+		CacheControl: "max-age=2628000, immutable, private",
+	}
+	switch compression {
+	case objectstorage.Gzip:
+		obj.ContentEncoding = "gzip"
+	case objectstorage.Brotli:
+		obj.ContentEncoding = "br"
+	case objectstorage.Zstd:
+		// Have to ignore contentEncoding for Zstd (otherwise will be an error in browser)
+	}
+	if opts != nil {
+		// GCS objects have no tags, ignoring them would silently break tag based lifecycle rules
+		if len(opts.Tags) > 0 {
+			return errTagsNotSupported
+		}
+		obj.Metadata = opts.Metadata
+		obj.StorageClass = storageClass(opts.StorageClass)
+	}
+	call := s.svc.Objects.Insert(s.bucket, obj).Media(reader)
+	if opts != nil {
+		if acl := predefinedACL(opts.ACL); acl != "" {
+			call = call.PredefinedAcl(acl)
+		}
+	}
+	_, err := call.Context(objectstorage.UploadContext(opts)).Do()
+	return err
+}
+
+// predefinedACL returns the GCS predefined ACL, empty for private objects to keep the bucket's default
+func predefinedACL(acl objectstorage.ACL) string {
+	switch acl {
+	case objectstorage.PublicReadACL:
+		return "publicRead"
+	case objectstorage.AuthenticatedReadACL:
+		return "authenticatedRead"
+	case objectstorage.BucketOwnerReadACL:
+		return "bucketOwnerRead"
+	case objectstorage.BucketOwnerFullControlACL:
+		return "bucketOwnerFullControl"
+	default:
+		return ""
+	}
+}
+
+// storageClass returns the GCS storage class closest to the S3 one, intelligent tiering is done by bucket's autoclass
+func storageClass(class objectstorage.StorageClass) string {
+	switch class {
+	case objectstorage.StandardStorageClass:
+		return "STANDARD"
+	case objectstorage.StandardIAStorageClass:
+		return "NEARLINE"
+	case objectstorage.GlacierStorageClass:
+		return "ARCHIVE"
+	default:
+		return ""
+	}
+}
+
+func (s *storageImpl) Get(key string) (io.ReadCloser, error) {
+	resp, err := s.svc.Objects.Get(s.bucket, strings.TrimPrefix(key, "/")).Download()
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *storageImpl) GetRange(key string, offset, size int64) (io.ReadCloser, error) {
+	call := s.svc.Objects.Get(s.bucket, strings.TrimPrefix(key, "/"))
+	call.Header().Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+size-1))
+	resp, err := call.Download()
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+func (s *storageImpl) Head(key string) (*objectstorage.ObjectInfo, error) {
+	obj, err := s.svc.Objects.Get(s.bucket, strings.TrimPrefix(key, "/")).Do()
+	if err != nil {
+		return nil, err
+	}
+	info := &objectstorage.ObjectInfo{
+		Size:     int64(obj.Size),
+		Metadata: make(map[string]string, len(obj.Metadata)),
+	}
+	for k, v := range obj.Metadata {
+		info.Metadata[strings.ToLower(k)] = v
+	}
+	return info, nil
+}
+
+func (s *storageImpl) Exists(key string) bool {
+	_, err := s.svc.Objects.Get(s.bucket, strings.TrimPrefix(key, "/")).Do()
+	return err == nil
+}
+
+func (s *storageImpl) Delete(key string) error {
+	return s.svc.Objects.Delete(s.bucket, strings.TrimPrefix(key, "/")).Do()
+}
+
+func (s *storageImpl) GetCreationTime(key string) *time.Time {
+	obj, err := s.svc.Objects.Get(s.bucket, strings.TrimPrefix(key, "/")).Do()
+	if err != nil {
+		return nil
+	}
+	created, err := time.Parse(time.RFC3339, obj.TimeCreated)
+	if err != nil {
+		return nil
+	}
+	return &created
+}
+
+// GetPreSignedUploadUrl isn't supported, signed urls require a service account private key which the client
+// created from the default credentials doesn't have
+func (s *storageImpl) GetPreSignedUploadUrl(key string) (string, error) {
+	return "", errPresignNotSupported
+}
+
+// GetPreSignedDownloadUrl isn't supported for the same reason as GetPreSignedUploadUrl, sessions stored in gcs are
+// downloaded through the storage service
+func (s *storageImpl) GetPreSignedDownloadUrl(key string, ttl time.Duration, contentEncoding string) (string, error) {
+	return "", errPresignNotSupported
+}
@@ -0,0 +1,197 @@
+package gcs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/storage/v1"
+
+	"openreplay/backend/pkg/objectstorage"
+)
+
+const testBucket = "mobs"
+
+type testObject struct {
+	meta *storage.Object
+	data []byte
+}
+
+// objectServer is the minimal in-memory JSON API of GCS: multipart uploads, object metadata, (range) downloads and deletes
+type objectServer struct {
+	mu      sync.Mutex
+	objects map[string]*testObject
+	acls    map[string]string // predefined ACLs of uploaded objects
+}
+
+func (s *objectServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r.Method == http.MethodPost && r.URL.Path == "/upload/storage/v1/b/"+testBucket+"/o" {
+		obj, err := readMultipartObject(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		obj.meta.Size = uint64(len(obj.data))
+		obj.meta.TimeCreated = time.Now().UTC().Format(time.RFC3339)
+		s.objects[obj.meta.Name] = obj
+		s.acls[obj.meta.Name] = r.URL.Query().Get("predefinedAcl")
+		json.NewEncoder(w).Encode(obj.meta)
+		return
+	}
+	prefix := "/storage/v1/b/" + testBucket + "/o/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		http.Error(w, "unknown path", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, prefix)
+	obj, ok := s.objects[name]
+	if !ok {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+	switch {
+	case r.Method == http.MethodDelete:
+		delete(s.objects, name)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet && r.URL.Query().Get("alt") == "media":
+		data, status := obj.data, http.StatusOK
+		if rng := r.Header.Get("Range"); rng != "" {
+			var start, end int
+			if _, err := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); err != nil || end >= len(data) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			data, status = data[start:end+1], http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(status)
+		w.Write(data)
+	case r.Method == http.MethodGet:
+		json.NewEncoder(w).Encode(obj.meta)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// readMultipartObject reads the object resource and its media from the multipart upload request
+func readMultipartObject(r *http.Request) (*testObject, error) {
+	_, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, err
+	}
+	reader := multipart.NewReader(r.Body, params["boundary"])
+	part, err := reader.NextPart()
+	if err != nil {
+		return nil, err
+	}
+	obj := &testObject{meta: &storage.Object{}}
+	if err := json.NewDecoder(part).Decode(obj.meta); err != nil {
+		return nil, err
+	}
+	if part, err = reader.NextPart(); err != nil {
+		return nil, err
+	}
+	if obj.data, err = io.ReadAll(part); err != nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (s *objectServer) object(name string) (*testObject, string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[name]
+	return obj, s.acls[name], ok
+}
+
+func newTestStorage(t *testing.T) (*storageImpl, *objectServer) {
+	objects := &objectServer{objects: make(map[string]*testObject), acls: make(map[string]string)}
+	server := httptest.NewServer(objects)
+	t.Cleanup(server.Close)
+	svc, err := storage.NewService(context.Background(), option.WithEndpoint(server.URL+"/storage/v1/"),
+		option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &storageImpl{svc: svc, bucket: testBucket}, objects
+}
+
+func TestUploadWithOptions(t *testing.T) {
+	s, server := newTestStorage(t)
+	opts := &objectstorage.UploadOptions{
+		Metadata:     map[string]string{"checksum": "abc"},
+		StorageClass: objectstorage.GlacierStorageClass,
+		ACL:          objectstorage.BucketOwnerFullControlACL,
+	}
+	if err := s.UploadWithOptions(strings.NewReader("dom"), "/1/dom.mobs", "application/octet-stream",
+		objectstorage.Gzip, opts); err != nil {
+		t.Fatal(err)
+	}
+	obj, acl, ok := server.object("1/dom.mobs")
+	if !ok {
+		t.Fatal("object wasn't uploaded without the leading slash")
+	}
+	if string(obj.data) != "dom" || obj.meta.ContentEncoding != "gzip" || obj.meta.StorageClass != "ARCHIVE" ||
+		obj.meta.Metadata["checksum"] != "abc" || acl != "bucketOwnerFullControl" {
+		t.Errorf("wrong object: %+v, data: %q, acl: %s", obj.meta, obj.data, acl)
+	}
+
+	opts.Tags = map[string]string{"retention": "long"}
+	if err := s.UploadWithOptions(strings.NewReader("dom"), "2/dom.mobs", "application/octet-stream",
+		objectstorage.NoCompression, opts); !errors.Is(err, errTagsNotSupported) {
+		t.Errorf("upload with tags should fail, got: %v", err)
+	}
+	if _, _, ok := server.object("2/dom.mobs"); ok {
+		t.Error("object with tags shouldn't be uploaded")
+	}
+}
+
+func TestReadAndDelete(t *testing.T) {
+	s, server := newTestStorage(t)
+	if err := s.Upload(strings.NewReader("dom file"), "1/dom.mobs", "application/octet-stream",
+		objectstorage.NoCompression); err != nil {
+		t.Fatal(err)
+	}
+	info, err := s.Head("/1/dom.mobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size != int64(len("dom file")) {
+		t.Errorf("wrong size: %d", info.Size)
+	}
+	reader, err := s.GetRange("1/dom.mobs", 4, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	if string(data) != "file" {
+		t.Errorf("wrong range: %q", data)
+	}
+	if created := s.GetCreationTime("1/dom.mobs"); created == nil {
+		t.Error("creation time is empty")
+	}
+	if err := s.Delete("/1/dom.mobs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := server.object("1/dom.mobs"); ok || s.Exists("1/dom.mobs") {
+		t.Error("object wasn't deleted")
+	}
+	if _, err := s.GetPreSignedDownloadUrl("1/dom.mobs", time.Minute, ""); !errors.Is(err, errPresignNotSupported) {
+		t.Errorf("pre-signed urls should be unsupported, got: %v", err)
+	}
+}
@@ -0,0 +1,175 @@
+// Package memory implements the object storage in memory, it's intended for tests of services and their hooks
+// which don't have to depend on a real S3/MinIO.
+package memory
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"openreplay/backend/pkg/objectstorage"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+// Object is an uploaded object with all its upload properties
+type Object struct {
+	Data         []byte
+	ContentType  string
+	Compression  objectstorage.CompressionType
+	Metadata     map[string]string
+	StorageClass objectstorage.StorageClass
+	ACL          objectstorage.ACL
+	Tags         map[string]string
+	CreatedAt    time.Time
+}
+
+type Storage struct {
+	mu      sync.Mutex
+	objects map[string]*Object
+	latency time.Duration
+	err     error
+}
+
+func New() *Storage {
+	return &Storage{objects: make(map[string]*Object)}
+}
+
+// SetError makes all next uploads fail with the given error, nil restores successful uploads
+func (s *Storage) SetError(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+// SetLatency adds a delay to every upload
+func (s *Storage) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	s.latency = latency
+	s.mu.Unlock()
+}
+
+// Keys returns sorted keys of all uploaded objects
+func (s *Storage) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Object returns the uploaded object, it can be modified to simulate changes on the storage side
+func (s *Storage) Object(key string) (*Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	obj, ok := s.objects[key]
+	return obj, ok
+}
+
+func (s *Storage) Upload(reader io.Reader, key string, contentType string, compression objectstorage.CompressionType) error {
+	return s.UploadWithOptions(reader, key, contentType, compression, nil)
+}
+
+func (s *Storage) UploadWithOptions(reader io.Reader, key string, contentType string, compression objectstorage.CompressionType, opts *objectstorage.UploadOptions) error {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	latency := s.latency
+	s.mu.Unlock()
+	ctx := objectstorage.UploadContext(opts)
+	select {
+	case <-time.After(latency):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	obj := &Object{
+		Data:        data,
+		ContentType: contentType,
+		Compression: compression,
+		Metadata:    make(map[string]string),
+		Tags:        make(map[string]string),
+		CreatedAt:   time.Now(),
+	}
+	if opts != nil {
+		for k, v := range opts.Metadata {
+			obj.Metadata[k] = v
+		}
+		for k, v := range opts.Tags {
+			obj.Tags[k] = v
+		}
+		obj.StorageClass = opts.StorageClass
+		obj.ACL = opts.ACL
+	}
+	s.objects[key] = obj
+	return nil
+}
+
+func (s *Storage) Get(key string) (io.ReadCloser, error) {
+	obj, ok := s.Object(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(obj.Data)), nil
+}
+
+func (s *Storage) GetRange(key string, offset, size int64) (io.ReadCloser, error) {
+	obj, ok := s.Object(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if offset < 0 || size < 0 || offset+size > int64(len(obj.Data)) {
+		return nil, fmt.Errorf("wrong range of %s: %d-%d, size: %d", key, offset, offset+size, len(obj.Data))
+	}
+	return io.NopCloser(bytes.NewReader(obj.Data[offset : offset+size])), nil
+}
+
+func (s *Storage) Head(key string) (*objectstorage.ObjectInfo, error) {
+	obj, ok := s.Object(key)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &objectstorage.ObjectInfo{Size: int64(len(obj.Data)), Metadata: obj.Metadata}, nil
+}
+
+func (s *Storage) Exists(key string) bool {
+	_, ok := s.Object(key)
+	return ok
+}
+
+func (s *Storage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, key)
+	return nil
+}
+
+func (s *Storage) GetCreationTime(key string) *time.Time {
+	obj, ok := s.Object(key)
+	if !ok {
+		return nil
+	}
+	return &obj.CreatedAt
+}
+
+func (s *Storage) GetPreSignedUploadUrl(key string) (string, error) {
+	return "", errors.New("pre-signed urls are not supported by in-memory storage")
+}
+
+func (s *Storage) GetPreSignedDownloadUrl(key string, ttl time.Duration, contentEncoding string) (string, error) {
+	return "", errors.New("pre-signed urls are not supported by in-memory storage")
+}
@@ -1,8 +1,12 @@
 package objectstorage
 
 import (
+	"context"
+	"fmt"
 	"io"
+	"strings"
 	"time"
+	"unicode"
 )
 
 type CompressionType int
@@ -14,10 +18,162 @@ const (
 	Zstd
 )
 
+func (c CompressionType) String() string {
+	switch c {
+	case Gzip:
+		return "gzip"
+	case Brotli:
+		return "brotli"
+	case Zstd:
+		return "zstd"
+	default:
+		return "none"
+	}
+}
+
+// ContentEncoding returns the HTTP content encoding of the compressed object, zstd isn't supported by all browsers,
+// so it's empty for zstd as well as for not compressed objects
+func (c CompressionType) ContentEncoding() string {
+	switch c {
+	case Gzip:
+		return "gzip"
+	case Brotli:
+		return "br"
+	default:
+		return ""
+	}
+}
+
+func ParseCompressionType(algo string) (CompressionType, error) {
+	switch algo {
+	case "none":
+		return NoCompression, nil
+	case "gzip":
+		return Gzip, nil
+	case "brotli":
+		return Brotli, nil
+	case "zstd":
+		return Zstd, nil
+	default:
+		return NoCompression, fmt.Errorf("unknown compression algorithm: %s", algo)
+	}
+}
+
+// StorageClass is the S3 storage class of the uploaded object, other providers use the closest equivalent
+type StorageClass string
+
+const (
+	DefaultStorageClass            StorageClass = "" // bucket's default
+	StandardStorageClass           StorageClass = "STANDARD"
+	StandardIAStorageClass         StorageClass = "STANDARD_IA"
+	IntelligentTieringStorageClass StorageClass = "INTELLIGENT_TIERING"
+	GlacierStorageClass            StorageClass = "GLACIER"
+)
+
+func ParseStorageClass(class string) (StorageClass, error) {
+	switch StorageClass(class) {
+	case DefaultStorageClass, StandardStorageClass, StandardIAStorageClass, IntelligentTieringStorageClass, GlacierStorageClass:
+		return StorageClass(class), nil
+	default:
+		return DefaultStorageClass, fmt.Errorf("unknown storage class: %s", class)
+	}
+}
+
+// ACL is the S3 canned ACL of the uploaded object, GCS uses the matching predefined ACL. Azure doesn't support
+// per-blob ACLs, public access is configured on the container.
+type ACL string
+
+const (
+	PrivateACL                ACL = "private" // S3 default, the ACL header isn't sent to work with buckets with disabled ACLs
+	PublicReadACL             ACL = "public-read"
+	AuthenticatedReadACL      ACL = "authenticated-read"
+	BucketOwnerReadACL        ACL = "bucket-owner-read"
+	BucketOwnerFullControlACL ACL = "bucket-owner-full-control"
+)
+
+func ParseACL(acl string) (ACL, error) {
+	switch ACL(acl) {
+	case "":
+		return PrivateACL, nil
+	case PrivateACL, PublicReadACL, AuthenticatedReadACL, BucketOwnerReadACL, BucketOwnerFullControlACL:
+		return ACL(acl), nil
+	default:
+		return PrivateACL, fmt.Errorf("unknown object acl: %s", acl)
+	}
+}
+
+// UploadOptions contains optional properties of the uploaded object
+type UploadOptions struct {
+	Metadata     map[string]string // keys should contain only lowercase letters, digits and underscores
+	StorageClass StorageClass
+	ACL          ACL               // private if empty
+	Tags         map[string]string // S3 object tags, blob index tags for Azure, GCS uploads with tags fail
+	Context      context.Context   // aborts the upload request once it's done, the upload isn't cancelled if nil
+}
+
+// UploadContext returns the context of the upload request
+func UploadContext(opts *UploadOptions) context.Context {
+	if opts == nil || opts.Context == nil {
+		return context.Background()
+	}
+	return opts.Context
+}
+
+const (
+	maxTags           = 10
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+)
+
+// ValidateTags checks that object tags meet S3 constraints: up to 10 tags, keys up to 128 and values up to
+// 256 characters long, only letters, digits, spaces and + - = . _ : / @ are allowed
+func ValidateTags(tags map[string]string) error {
+	if len(tags) > maxTags {
+		return fmt.Errorf("too many object tags: %d, max: %d", len(tags), maxTags)
+	}
+	for k, v := range tags {
+		switch {
+		case k == "" || len([]rune(k)) > maxTagKeyLength:
+			return fmt.Errorf("wrong object tag key length: %q", k)
+		case strings.HasPrefix(strings.ToLower(k), "aws:"):
+			return fmt.Errorf("object tag key can't start with aws: prefix: %q", k)
+		case len([]rune(v)) > maxTagValueLength:
+			return fmt.Errorf("object tag value is too long: %q", v)
+		case !isTagString(k):
+			return fmt.Errorf("object tag key contains not allowed characters: %q", k)
+		case !isTagString(v):
+			return fmt.Errorf("object tag value contains not allowed characters: %q", v)
+		}
+	}
+	return nil
+}
+
+func isTagString(str string) bool {
+	for _, r := range str {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r) && !strings.ContainsRune("+-=._:/@", r) {
+			return false
+		}
+	}
+	return true
+}
+
+// ObjectInfo contains properties of the stored object
+type ObjectInfo struct {
+	Size     int64
+	Metadata map[string]string // keys are in lower case
+}
+
 type ObjectStorage interface {
 	Upload(reader io.Reader, key string, contentType string, compression CompressionType) error
+	UploadWithOptions(reader io.Reader, key string, contentType string, compression CompressionType, opts *UploadOptions) error
 	Get(key string) (io.ReadCloser, error)
+	// GetRange returns size bytes of the object starting from offset
+	GetRange(key string, offset, size int64) (io.ReadCloser, error)
+	Head(key string) (*ObjectInfo, error)
 	Exists(key string) bool
+	Delete(key string) error
 	GetCreationTime(key string) *time.Time
 	GetPreSignedUploadUrl(key string) (string, error)
+	// GetPreSignedDownloadUrl returns a time-limited GET url, the response has the given content encoding if not empty
+	GetPreSignedDownloadUrl(key string, ttl time.Duration, contentEncoding string) (string, error)
 }
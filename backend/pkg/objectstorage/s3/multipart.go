@@ -0,0 +1,136 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	metrics "openreplay/backend/pkg/metrics/storage"
+)
+
+// uploadObject uploads objects smaller than the multipart threshold with a single request and bigger ones part by
+// part. Each part is retried separately and the multipart upload is aborted on failure to not leave orphaned parts.
+// Requests are aborted once ctx is done.
+func (s *storageImpl) uploadObject(ctx context.Context, input *s3manager.UploadInput) error {
+	if s.multipartThreshold <= 0 {
+		_, err := s.uploader.UploadWithContext(ctx, input)
+		return err
+	}
+	head := make([]byte, s.multipartThreshold)
+	n, err := io.ReadFull(input.Body, head)
+	switch {
+	case err == io.EOF || err == io.ErrUnexpectedEOF:
+		_, err = s.svc.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Body:                 bytes.NewReader(head[:n]),
+			Bucket:               input.Bucket,
+			Key:                  input.Key,
+			ContentType:          input.ContentType,
+			CacheControl:         input.CacheControl,
+			ContentEncoding:      input.ContentEncoding,
+			Tagging:              input.Tagging,
+			Metadata:             input.Metadata,
+			StorageClass:         input.StorageClass,
+			ACL:                  input.ACL,
+			ServerSideEncryption: input.ServerSideEncryption,
+			SSEKMSKeyId:          input.SSEKMSKeyId,
+		})
+		return err
+	case err != nil:
+		return err
+	}
+	return s.uploadMultipart(ctx, input, io.MultiReader(bytes.NewReader(head), input.Body))
+}
+
+func (s *storageImpl) uploadMultipart(ctx context.Context, input *s3manager.UploadInput, body io.Reader) error {
+	upload, err := s.svc.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               input.Bucket,
+		Key:                  input.Key,
+		ContentType:          input.ContentType,
+		CacheControl:         input.CacheControl,
+		ContentEncoding:      input.ContentEncoding,
+		Tagging:              input.Tagging,
+		Metadata:             input.Metadata,
+		StorageClass:         input.StorageClass,
+		ACL:                  input.ACL,
+		ServerSideEncryption: input.ServerSideEncryption,
+		SSEKMSKeyId:          input.SSEKMSKeyId,
+	})
+	if err != nil {
+		return fmt.Errorf("can't create multipart upload: %s", err)
+	}
+	parts, err := s.uploadParts(ctx, input, upload.UploadId, body)
+	if err == nil {
+		_, err = s.svc.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:          input.Bucket,
+			Key:             input.Key,
+			UploadId:        upload.UploadId,
+			MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+		})
+	}
+	if err != nil {
+		// Aborted with its own context, the upload's context can be already done
+		if _, abortErr := s.svc.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+			Bucket:   input.Bucket,
+			Key:      input.Key,
+			UploadId: upload.UploadId,
+		}); abortErr != nil {
+			return fmt.Errorf("%s, can't abort multipart upload: %s", err, abortErr)
+		}
+		return err
+	}
+	metrics.RecordMultipartUploadParts(float64(len(parts)))
+	return nil
+}
+
+func (s *storageImpl) uploadParts(ctx context.Context, input *s3manager.UploadInput, uploadID *string, body io.Reader) ([]*s3.CompletedPart, error) {
+	var parts []*s3.CompletedPart
+	buf := make([]byte, s.multipartPartSize)
+	for num := int64(1); ; num++ {
+		n, err := io.ReadFull(body, buf)
+		if err == io.EOF {
+			return parts, nil
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			return nil, err
+		}
+		etag, uploadErr := s.uploadPart(ctx, input, uploadID, num, buf[:n])
+		if uploadErr != nil {
+			return nil, fmt.Errorf("can't upload part %d: %s", num, uploadErr)
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: etag, PartNumber: aws.Int64(num)})
+		// Last part is smaller than the others
+		if err == io.ErrUnexpectedEOF {
+			return parts, nil
+		}
+	}
+}
+
+func (s *storageImpl) uploadPart(ctx context.Context, input *s3manager.UploadInput, uploadID *string, num int64, data []byte) (*string, error) {
+	var err error
+	for attempt := 0; attempt <= s.multipartRetries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(time.Duration(attempt) * time.Second):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		var out *s3.UploadPartOutput
+		if out, err = s.svc.UploadPartWithContext(ctx, &s3.UploadPartInput{
+			Body:       bytes.NewReader(data),
+			Bucket:     input.Bucket,
+			Key:        input.Key,
+			UploadId:   uploadID,
+			PartNumber: aws.Int64(num),
+		}); err == nil {
+			return out.ETag, nil
+		}
+	}
+	return nil, err
+}
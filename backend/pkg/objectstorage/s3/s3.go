@@ -6,9 +6,11 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -23,29 +25,48 @@ import (
 
 const MAX_RETURNING_COUNT = 40
 
+// endpointRegion is used for custom S3-compatible endpoints without a region, most of them ignore it
+const endpointRegion = "us-east-1"
+
 type storageImpl struct {
-	uploader *s3manager.Uploader
-	svc      *s3.S3
-	bucket   *string
-	fileTag  *string
+	uploader           *s3manager.Uploader
+	svc                *s3.S3
+	bucket             *string
+	fileTag            *string
+	multipartThreshold int64
+	multipartPartSize  int64
+	multipartRetries   int
+	sse                *string // server-side encryption, nil for the bucket's default
+	sseKMSKeyID        *string
 }
 
 func NewS3(cfg *objConfig.ObjectsConfig) (objectstorage.ObjectStorage, error) {
 	if cfg == nil {
 		return nil, fmt.Errorf("s3 config is nil")
 	}
-	creds := credentials.NewStaticCredentials(cfg.AWSAccessKeyID, cfg.AWSSecretAccessKey, "")
-	if cfg.AWSAccessKeyID == "" || cfg.AWSSecretAccessKey == "" {
-		creds = nil
+	if err := validateSSE(cfg); err != nil {
+		return nil, err
+	}
+	// Without static keys the default credential chain is used (env, shared config, IAM roles, IRSA), also for
+	// custom endpoints, a single key is a config mistake
+	if (cfg.AWSAccessKeyID == "") != (cfg.AWSSecretAccessKey == "") {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set together")
+	}
+	var creds *credentials.Credentials
+	if cfg.AWSAccessKeyID != "" {
+		creds = credentials.NewStaticCredentials(cfg.AWSAccessKeyID, cfg.AWSSecretAccessKey, "")
 	}
 	config := &aws.Config{
-		Region:      aws.String(cfg.AWSRegion),
+		Region:      aws.String(resolveRegion(cfg)),
 		Credentials: creds,
 	}
 	if cfg.AWSEndpoint != "" {
+		if err := validateEndpoint(cfg.AWSEndpoint); err != nil {
+			return nil, err
+		}
 		config.Endpoint = aws.String(cfg.AWSEndpoint)
 		config.DisableSSL = aws.Bool(true)
-		config.S3ForcePathStyle = aws.Bool(true)
+		config.S3ForcePathStyle = aws.Bool(cfg.AWSPathStyle)
 
 		if cfg.AWSSkipSSLValidation {
 			tr := &http.Transport{
@@ -59,15 +80,81 @@ func NewS3(cfg *objConfig.ObjectsConfig) (objectstorage.ObjectStorage, error) {
 	if err != nil {
 		return nil, fmt.Errorf("AWS session error: %v", err)
 	}
-	return &storageImpl{
-		uploader: s3manager.NewUploader(sess),
-		svc:      s3.New(sess), // AWS Docs: "These clients are safe to use concurrently."
-		bucket:   &cfg.BucketName,
-		fileTag:  tagging(cfg.UseS3Tags),
-	}, nil
+	partSize := cfg.AWSMultipartPartSize
+	if partSize < s3manager.MinUploadPartSize {
+		partSize = s3manager.MinUploadPartSize
+	}
+	impl := &storageImpl{
+		uploader:           s3manager.NewUploader(sess),
+		svc:                s3.New(sess), // AWS Docs: "These clients are safe to use concurrently."
+		bucket:             &cfg.BucketName,
+		fileTag:            tagging(cfg.UseS3Tags),
+		multipartThreshold: cfg.AWSMultipartThreshold,
+		multipartPartSize:  partSize,
+		multipartRetries:   cfg.AWSMultipartRetries,
+	}
+	if cfg.AWSServerSideEncryption != "" {
+		impl.sse = aws.String(cfg.AWSServerSideEncryption)
+	}
+	if cfg.AWSSSEKMSKeyID != "" {
+		impl.sseKMSKeyID = aws.String(cfg.AWSSSEKMSKeyID)
+	}
+	return impl, nil
+}
+
+// validateSSE checks server-side encryption settings, KMS key id can be set only for SSE-KMS
+func validateSSE(cfg *objConfig.ObjectsConfig) error {
+	switch cfg.AWSServerSideEncryption {
+	case "", s3.ServerSideEncryptionAes256, s3.ServerSideEncryptionAwsKms:
+	default:
+		return fmt.Errorf("unknown server-side encryption: %s", cfg.AWSServerSideEncryption)
+	}
+	if cfg.AWSSSEKMSKeyID != "" && cfg.AWSServerSideEncryption != s3.ServerSideEncryptionAwsKms {
+		return fmt.Errorf("AWS_SSE_KMS_KEY_ID is set, but server-side encryption isn't %s", s3.ServerSideEncryptionAwsKms)
+	}
+	return nil
+}
+
+// resolveRegion returns the configured region. Custom endpoints get a placeholder region, otherwise an empty
+// region is resolved by the SDK from the environment and shared config as before.
+func resolveRegion(cfg *objConfig.ObjectsConfig) string {
+	if cfg.AWSRegion == "" && cfg.AWSEndpoint != "" {
+		return endpointRegion
+	}
+	return cfg.AWSRegion
+}
+
+// validateEndpoint checks the custom endpoint at startup, it should be a host with an optional port and http(s) scheme
+func validateEndpoint(endpoint string) error {
+	if strings.ContainsAny(endpoint, " \t\n") {
+		return fmt.Errorf("wrong s3 endpoint %q: contains whitespaces", endpoint)
+	}
+	raw := endpoint
+	if !strings.Contains(raw, "://") {
+		raw = "http://" + raw
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("wrong s3 endpoint %q: %s", endpoint, err)
+	}
+	switch {
+	case u.Scheme != "http" && u.Scheme != "https":
+		return fmt.Errorf("wrong s3 endpoint %q: unsupported scheme %s", endpoint, u.Scheme)
+	case u.Hostname() == "":
+		return fmt.Errorf("wrong s3 endpoint %q: empty host", endpoint)
+	case u.Port() != "":
+		if port, err := strconv.Atoi(u.Port()); err != nil || port < 1 || port > 65535 {
+			return fmt.Errorf("wrong s3 endpoint %q: wrong port %s", endpoint, u.Port())
+		}
+	}
+	return nil
 }
 
 func (s *storageImpl) Upload(reader io.Reader, key string, contentType string, compression objectstorage.CompressionType) error {
+	return s.UploadWithOptions(reader, key, contentType, compression, nil)
+}
+
+func (s *storageImpl) UploadWithOptions(reader io.Reader, key string, contentType string, compression objectstorage.CompressionType, opts *objectstorage.UploadOptions) error {
 	cacheControl := "max-age=2628000, immutable, private"
 	var contentEncoding *string
 	switch compression {
@@ -81,16 +168,43 @@ func (s *storageImpl) Upload(reader io.Reader, key string, contentType string, c
 		// Have to ignore contentEncoding for Zstd (otherwise will be an error in browser)
 	}
 
-	_, err := s.uploader.Upload(&s3manager.UploadInput{
+	input := &s3manager.UploadInput{
 		Body:            reader,
 		Bucket:          s.bucket,
 		Key:             &key,
 		ContentType:     &contentType,
 		CacheControl:    &cacheControl,
 		ContentEncoding: contentEncoding,
-		Tagging:         s.fileTag,
-	})
-	return err
+		Tagging:         s.tagging(opts),
+		// Session files encrypted by the service are encrypted by S3 once more
+		ServerSideEncryption: s.sse,
+		SSEKMSKeyId:          s.sseKMSKeyID,
+	}
+	if opts != nil && len(opts.Metadata) > 0 {
+		input.Metadata = aws.StringMap(opts.Metadata)
+	}
+	if opts != nil && opts.StorageClass != objectstorage.DefaultStorageClass {
+		input.StorageClass = aws.String(string(opts.StorageClass))
+	}
+	if opts != nil && opts.ACL != "" && opts.ACL != objectstorage.PrivateACL {
+		input.ACL = aws.String(string(opts.ACL))
+	}
+	return s.uploadObject(objectstorage.UploadContext(opts), input)
+}
+
+// tagging adds upload tags to the file tag
+func (s *storageImpl) tagging(opts *objectstorage.UploadOptions) *string {
+	if opts == nil || len(opts.Tags) == 0 {
+		return s.fileTag
+	}
+	params := url.Values{}
+	if s.fileTag != nil {
+		params, _ = url.ParseQuery(*s.fileTag)
+	}
+	for k, v := range opts.Tags {
+		params.Set(k, v)
+	}
+	return aws.String(params.Encode())
 }
 
 func (s *storageImpl) Get(key string) (io.ReadCloser, error) {
@@ -104,6 +218,18 @@ func (s *storageImpl) Get(key string) (io.ReadCloser, error) {
 	return out.Body, nil
 }
 
+func (s *storageImpl) GetRange(key string, offset, size int64) (io.ReadCloser, error) {
+	out, err := s.svc.GetObject(&s3.GetObjectInput{
+		Bucket: s.bucket,
+		Key:    &key,
+		Range:  aws.String(fmt.Sprintf("bytes=%d-%d", offset, offset+size-1)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
 func (s *storageImpl) GetAll(key string) ([]io.ReadCloser, error) {
 	out, err := s.svc.GetObject(&s3.GetObjectInput{
 		Bucket: s.bucket,
@@ -156,6 +282,32 @@ func (s *storageImpl) Exists(key string) bool {
 	return false
 }
 
+func (s *storageImpl) Delete(key string) error {
+	_, err := s.svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: s.bucket,
+		Key:    &key,
+	})
+	return err
+}
+
+func (s *storageImpl) Head(key string) (*objectstorage.ObjectInfo, error) {
+	out, err := s.svc.HeadObject(&s3.HeadObjectInput{
+		Bucket: s.bucket,
+		Key:    &key,
+	})
+	if err != nil {
+		return nil, err
+	}
+	info := &objectstorage.ObjectInfo{
+		Size:     aws.Int64Value(out.ContentLength),
+		Metadata: make(map[string]string, len(out.Metadata)),
+	}
+	for k, v := range out.Metadata {
+		info.Metadata[strings.ToLower(k)] = aws.StringValue(v)
+	}
+	return info, nil
+}
+
 func (s *storageImpl) GetCreationTime(key string) *time.Time {
 	ans, err := s.svc.HeadObject(&s3.HeadObjectInput{
 		Bucket: s.bucket,
@@ -195,6 +347,18 @@ func (s *storageImpl) GetFrequentlyUsedKeys(projectID uint64) ([]string, error)
 	return keyList, nil
 }
 
+func (s *storageImpl) GetPreSignedDownloadUrl(key string, ttl time.Duration, contentEncoding string) (string, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(*s.bucket),
+		Key:    aws.String(key),
+	}
+	if contentEncoding != "" {
+		input.ResponseContentEncoding = aws.String(contentEncoding)
+	}
+	req, _ := s.svc.GetObjectRequest(input)
+	return req.Presign(ttl)
+}
+
 func (s *storageImpl) GetPreSignedUploadUrl(key string) (string, error) {
 	req, _ := s.svc.PutObjectRequest(&s3.PutObjectInput{
 		Bucket: aws.String(*s.bucket),
@@ -0,0 +1,90 @@
+package s3
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	objConfig "openreplay/backend/internal/config/objectstorage"
+	"openreplay/backend/pkg/objectstorage"
+)
+
+func TestServerSideEncryption(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		headers []http.Header
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		mu.Lock()
+		headers = append(headers, r.Header.Clone())
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+	cfg := &objConfig.ObjectsConfig{
+		BucketName:              "mobs",
+		AWSEndpoint:             server.URL,
+		AWSAccessKeyID:          "key",
+		AWSSecretAccessKey:      "secret",
+		AWSPathStyle:            true,
+		AWSServerSideEncryption: "aws:kms",
+		AWSSSEKMSKeyID:          "kms-key",
+	}
+	for _, threshold := range []int64{0, 1 << 20} {
+		cfg.AWSMultipartThreshold = threshold
+		storage, err := NewS3(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := storage.Upload(strings.NewReader("dom"), "1/dom.mobs", "application/octet-stream", objectstorage.NoCompression); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(headers) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(headers))
+	}
+	for _, header := range headers {
+		if header.Get("X-Amz-Server-Side-Encryption") != "aws:kms" || header.Get("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id") != "kms-key" {
+			t.Errorf("sse headers aren't set: %v", header)
+		}
+	}
+
+	cfg.AWSServerSideEncryption = "AES256"
+	if _, err := NewS3(cfg); err == nil {
+		t.Error("kms key id without aws:kms should fail")
+	}
+	cfg.AWSServerSideEncryption, cfg.AWSSSEKMSKeyID = "aes", ""
+	if _, err := NewS3(cfg); err == nil {
+		t.Error("unknown server-side encryption should fail")
+	}
+}
+
+func TestDefaultCredentials(t *testing.T) {
+	// Custom endpoints and AWS itself fall back to the default credential chain, the region may come from the environment
+	for _, cfg := range []*objConfig.ObjectsConfig{
+		{BucketName: "mobs", AWSEndpoint: "http://minio:9000"},
+		{BucketName: "mobs"},
+	} {
+		if _, err := NewS3(cfg); err != nil {
+			t.Errorf("storage without static credentials, endpoint %q: %s", cfg.AWSEndpoint, err)
+		}
+	}
+	for _, cfg := range []*objConfig.ObjectsConfig{
+		{BucketName: "mobs", AWSEndpoint: "http://minio:9000", AWSAccessKeyID: "minio"},
+		{BucketName: "mobs", AWSSecretAccessKey: "secret"},
+	} {
+		if _, err := NewS3(cfg); err == nil {
+			t.Errorf("storage with a single static key should fail, endpoint %q", cfg.AWSEndpoint)
+		}
+	}
+	if region := resolveRegion(&objConfig.ObjectsConfig{AWSEndpoint: "http://minio:9000"}); region != endpointRegion {
+		t.Errorf("wrong custom endpoint region: %s", region)
+	}
+	if region := resolveRegion(&objConfig.ObjectsConfig{AWSRegion: "eu-central-1"}); region != "eu-central-1" {
+		t.Errorf("wrong region: %s", region)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	objConfig "openreplay/backend/internal/config/objectstorage"
 	"openreplay/backend/pkg/objectstorage"
+	"openreplay/backend/pkg/objectstorage/gcs"
 	"openreplay/backend/pkg/objectstorage/s3"
 )
 
@@ -11,5 +12,8 @@ func NewStore(cfg *objConfig.ObjectsConfig) (objectstorage.ObjectStorage, error)
 	if cfg == nil {
 		return nil, errors.New("object storage config is empty")
 	}
+	if cfg.CloudName == "gcp" {
+		return gcs.NewStorage(cfg)
+	}
 	return s3.NewS3(cfg)
 }
@@ -20,10 +20,14 @@ type workerPoolImpl struct {
 	tasks           chan *task
 	numberOfWorkers int
 	handler         func(interface{})
+	mu              sync.Mutex // guards stopping, SubmitDropOldest never removes stop signals from the queue
+	stopping        bool
 }
 
 type WorkerPool interface {
 	Submit(payload interface{})
+	TrySubmit(payload interface{}) bool
+	SubmitDropOldest(payload interface{}) (dropped interface{}, ok bool)
 	Pause()
 	Stop()
 }
@@ -50,11 +54,55 @@ func (p *workerPoolImpl) Submit(payload interface{}) {
 	p.tasks <- NewTask(payload)
 }
 
+// TrySubmit adds the task to the queue only if there is free space, returns false otherwise
+func (p *workerPoolImpl) TrySubmit(payload interface{}) bool {
+	select {
+	case p.tasks <- NewTask(payload):
+		return true
+	default:
+		return false
+	}
+}
+
+// SubmitDropOldest adds the task to the queue, if the queue is full the oldest waiting task is removed
+// from the queue and returned to the caller. While the pool is pausing the queue may contain stop signals,
+// so the new task isn't added to the full queue and is returned as dropped instead.
+func (p *workerPoolImpl) SubmitDropOldest(payload interface{}) (interface{}, bool) {
+	newTask := NewTask(payload)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		select {
+		case p.tasks <- newTask:
+			return nil, false
+		default:
+		}
+		if p.stopping {
+			return payload, true
+		}
+		select {
+		case old := <-p.tasks:
+			p.tasks <- newTask
+			return old.Payload, true
+		default:
+		}
+	}
+}
+
+func (p *workerPoolImpl) setStopping(stopping bool) {
+	p.mu.Lock()
+	p.stopping = stopping
+	p.mu.Unlock()
+}
+
 func (p *workerPoolImpl) stop() {
+	// Stop signals are added only after SubmitDropOldest stops removing tasks from the queue
+	p.setStopping(true)
 	for i := 0; i < p.numberOfWorkers; i++ {
 		p.tasks <- NewStopSignal()
 	}
 	p.wg.Wait()
+	p.setStopping(false)
 }
 
 func (p *workerPoolImpl) Pause() {
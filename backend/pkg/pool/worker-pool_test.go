@@ -0,0 +1,47 @@
+package pool
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSubmitDropOldest(t *testing.T) {
+	started, release := make(chan struct{}, 1), make(chan struct{})
+	handled := make(chan interface{}, 10)
+	p := NewPool(1, 1, func(payload interface{}) {
+		started <- struct{}{}
+		<-release
+		handled <- payload
+	})
+	p.Submit(1)
+	<-started
+	p.Submit(2)
+	if dropped, ok := p.SubmitDropOldest(3); !ok || dropped != 2 {
+		t.Fatalf("oldest task should be dropped, got: %v, %t", dropped, ok)
+	}
+
+	// The stop signal waits for free space in the queue, it must never be dropped
+	paused := make(chan struct{})
+	go func() {
+		p.Pause()
+		close(paused)
+	}()
+	for stopping := false; !stopping; time.Sleep(time.Millisecond) {
+		p.mu.Lock()
+		stopping = p.stopping
+		p.mu.Unlock()
+	}
+	if dropped, ok := p.SubmitDropOldest(4); !ok || dropped != 4 {
+		t.Fatalf("new task should be dropped while pausing, got: %v, %t", dropped, ok)
+	}
+	close(release)
+	select {
+	case <-paused:
+	case <-time.After(time.Second):
+		t.Fatal("pool wasn't paused")
+	}
+	if res := []interface{}{<-handled, <-handled}; res[0] != 1 || res[1] != 3 {
+		t.Errorf("wrong handled tasks: %v", res)
+	}
+	p.Stop()
+}
@@ -53,6 +53,9 @@ func DecryptData(data, fullKey []byte) ([]byte, error) {
 	if len(fullKey) != 32 {
 		return nil, errors.New("wrong format of encryption key")
 	}
+	if len(data)%aes.BlockSize != 0 {
+		return nil, errors.New("encrypted data isn't a multiple of the block size")
+	}
 	key, iv := fullKey[:16], fullKey[16:]
 	block, err := aes.NewCipher(key)
 	if err != nil {
@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// gcmSupported enables ENCRYPTION_MODE=gcm
+const gcmSupported = true
+
+// AES-256-GCM encrypted object format: nonce (12 bytes) || ciphertext || authentication tag (16 bytes).
+// The nonce is random for every object. The AES key is derived from the session's key material with HKDF-SHA256
+// using the session id as the context info, so sessions never share the key even if the key material is reused.
+// Modified objects fail the tag check on decryption.
+
+func newSessionGCM(keyMaterial []byte, sessionID string) (cipher.AEAD, error) {
+	if len(keyMaterial) == 0 {
+		return nil, errors.New("empty encryption key")
+	}
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, keyMaterial, nil, []byte(sessionID)), key); err != nil {
+		return nil, fmt.Errorf("can't derive encryption key: %s", err)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func encryptGCM(data, keyMaterial []byte, sessionID string) ([]byte, error) {
+	aead, err := newSessionGCM(keyMaterial, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(data)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("can't generate nonce: %s", err)
+	}
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+func decryptGCM(data, keyMaterial []byte, sessionID string) ([]byte, error) {
+	aead, err := newSessionGCM(keyMaterial, sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize()+aead.Overhead() {
+		return nil, fmt.Errorf("encrypted data is too short: %d", len(data))
+	}
+	return aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"testing"
+
+	config "openreplay/backend/internal/config/storage"
+	"openreplay/backend/pkg/messages"
+	"openreplay/backend/pkg/objectstorage/memory"
+)
+
+func TestGCMEncryption(t *testing.T) {
+	s, objStorage := newTestStorage(t, &config.Config{CompressionAlgo: "gzip", EncryptionMode: "gcm", WriteManifest: true})
+	dom := bytes.Repeat([]byte("dom"), 100)
+	if err := os.WriteFile(s.cfg.FSDir+"/8", dom, 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{EncryptionKey: "session key material"}
+	msg.SetSessionID(8)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	obj, ok := objStorage.Object("8" + manifestName)
+	if !ok {
+		t.Fatal("manifest wasn't uploaded")
+	}
+	manifest := &sessionManifest{}
+	if err := json.Unmarshal(obj.Data, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Encryption != encryptionGCM || manifest.KeyID != encryptionKeyID(msg.EncryptionKey) {
+		t.Fatalf("wrong manifest: %+v", manifest)
+	}
+	// Encryption mode is taken from the manifest instead of the config
+	s.cfg.EncryptionMode = encryptionCBC
+	reader, err := s.Download(8, 0, msg.EncryptionKey)
+	if err != nil {
+		t.Fatalf("can't download encrypted session: %s", err)
+	}
+	if res, _ := io.ReadAll(reader); !bytes.Equal(res, dom) {
+		t.Error("decrypted data mismatch")
+	}
+	obj, _ = objStorage.Object("8" + string(DOM) + "s")
+	if _, err := decryptGCM(obj.Data, []byte(msg.EncryptionKey), "9"); err == nil {
+		t.Error("key derived for another session shouldn't decrypt data")
+	}
+	obj.Data[len(obj.Data)-1] ^= 1
+	if _, err := s.Download(8, 0, msg.EncryptionKey); err == nil {
+		t.Error("modified object should fail decryption")
+	}
+}
+
+func TestReencrypt(t *testing.T) {
+	for _, layout := range []string{layoutSplit, layoutIndexed} {
+		s, objStorage := newTestStorage(t, &config.Config{CompressionAlgo: "gzip", EncryptionMode: "gcm",
+			WriteManifest: true, LayoutMode: layout})
+		dom, devtools := bytes.Repeat([]byte("dom"), 100), bytes.Repeat([]byte("devtools"), 100)
+		if err := os.WriteFile(s.cfg.FSDir+"/45", dom, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(s.localPath(s.cfg.FSDir+"/45", DEV), devtools, 0644); err != nil {
+			t.Fatal(err)
+		}
+		msg := &messages.SessionEnd{EncryptionKey: "old key material"}
+		msg.SetSessionID(45)
+		if err := s.Process(context.Background(), msg); err != nil {
+			t.Fatal(err)
+		}
+		s.Wait()
+		newKey := "new key material"
+		for i := 0; i < 2; i++ {
+			// The second call is skipped, objects are already encrypted with the new key
+			if err := s.Reencrypt(context.Background(), "", 45, 0, msg.EncryptionKey, newKey); err != nil {
+				t.Fatalf("can't re-encrypt session, layout: %s: %s", layout, err)
+			}
+		}
+		reader, err := s.Download(45, 0, newKey)
+		if err != nil {
+			t.Fatalf("can't download re-encrypted session, layout: %s: %s", layout, err)
+		}
+		if res, _ := io.ReadAll(reader); !bytes.Equal(res, dom) {
+			t.Errorf("re-encrypted dom mismatch, layout: %s", layout)
+		}
+		obj, _ := objStorage.Object("45" + string(DEV))
+		if res, err := decryptGCM(obj.Data, []byte(newKey), "45"); err != nil {
+			t.Errorf("devtools file wasn't re-encrypted: %s", err)
+		} else if res, _ = s.decompress(res, s.compression); !bytes.Equal(res, devtools) {
+			t.Error("re-encrypted devtools mismatch")
+		}
+		if _, err := s.Download(45, 0, msg.EncryptionKey); err == nil {
+			t.Error("old key shouldn't decrypt the session")
+		}
+	}
+}
+
+func TestReencryptMirror(t *testing.T) {
+	s, _ := newTestStorage(t, &config.Config{CompressionAlgo: "gzip", EncryptionMode: "gcm", WriteManifest: true})
+	mirror := memory.New()
+	s.mirror = mirror
+	dom := bytes.Repeat([]byte("dom"), 100)
+	if err := os.WriteFile(s.cfg.FSDir+"/49", dom, 0644); err != nil {
+		t.Fatal(err)
+	}
+	msg := &messages.SessionEnd{EncryptionKey: "old key material"}
+	msg.SetSessionID(49)
+	if err := s.Process(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	s.Wait()
+	newKey := "new key material"
+	if err := s.Reencrypt(context.Background(), "", 49, 0, msg.EncryptionKey, newKey); err != nil {
+		t.Fatal(err)
+	}
+	// The mirror copy is readable with the new key only
+	obj, ok := mirror.Object("49/dom.mobs")
+	if !ok {
+		t.Fatal("dom file wasn't mirrored")
+	}
+	if obj.Metadata[encryptionKeyIDMetadataKey] != encryptionKeyID(newKey) {
+		t.Errorf("wrong key id of the mirror copy: %s", obj.Metadata[encryptionKeyIDMetadataKey])
+	}
+	if res, err := decryptGCM(obj.Data, []byte(newKey), "49"); err != nil {
+		t.Errorf("mirror copy wasn't re-encrypted: %s", err)
+	} else if res, _ = s.decompress(res, s.compression); !bytes.Equal(res, dom) {
+		t.Error("re-encrypted mirror copy mismatch")
+	}
+	obj, _ = mirror.Object("49" + manifestName)
+	manifest := &sessionManifest{}
+	if err := json.Unmarshal(obj.Data, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if manifest.KeyID != encryptionKeyID(newKey) {
+		t.Errorf("mirror manifest has the old key id: %s", manifest.KeyID)
+	}
+}
@@ -32,6 +32,17 @@ func NewStorage(cfg *config.ObjectsConfig) (objectstorage.ObjectStorage, error)
 	if cfg == nil {
 		return nil, fmt.Errorf("azure config is empty")
 	}
+	if cfg.AzureConnString != "" {
+		client, err := azblob.NewClientFromConnectionString(cfg.AzureConnString, nil)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create azure client from connection string: %v", err)
+		}
+		return &storageImpl{
+			client:    client,
+			container: cfg.BucketName,
+			tags:      loadFileTag(),
+		}, nil
+	}
 	cred, err := azblob.NewSharedKeyCredential(cfg.AzureAccountName, cfg.AzureAccountKey)
 	if err != nil {
 		return nil, fmt.Errorf("cannot create azure credential: %v", err)
@@ -51,6 +62,10 @@ func NewStorage(cfg *config.ObjectsConfig) (objectstorage.ObjectStorage, error)
 }
 
 func (s *storageImpl) Upload(reader io.Reader, key string, contentType string, compression objectstorage.CompressionType) error {
+	return s.UploadWithOptions(reader, key, contentType, compression, nil)
+}
+
+func (s *storageImpl) UploadWithOptions(reader io.Reader, key string, contentType string, compression objectstorage.CompressionType, opts *objectstorage.UploadOptions) error {
 	cacheControl := "max-age=2628000, immutable, private"
 	var contentEncoding *string
 	switch compression {
@@ -61,24 +76,82 @@ func (s *storageImpl) Upload(reader io.Reader, key string, contentType string, c
 		gzipStr := "br"
 		contentEncoding = &gzipStr
 	}
-	// Remove leading slash to avoid empty folder creation
-	if strings.HasPrefix(key, "/") {
-		key = key[1:]
+	key = blobName(key)
+	var metadata map[string]*string
+	if opts != nil && len(opts.Metadata) > 0 {
+		metadata = make(map[string]*string, len(opts.Metadata))
+		for k, v := range opts.Metadata {
+			metadata[k] = to.Ptr(v)
+		}
 	}
-	_, err := s.client.UploadStream(context.Background(), s.container, key, reader, &azblob.UploadStreamOptions{
+	var accessTier *blob.AccessTier
+	tags := s.tags
+	if opts != nil {
+		accessTier = accessTierFor(opts.StorageClass)
+		if len(opts.Tags) > 0 {
+			tags = make(map[string]string, len(s.tags)+len(opts.Tags))
+			for k, v := range s.tags {
+				tags[k] = v
+			}
+			for k, v := range opts.Tags {
+				tags[k] = v
+			}
+		}
+	}
+	_, err := s.client.UploadStream(objectstorage.UploadContext(opts), s.container, key, reader, &azblob.UploadStreamOptions{
 		HTTPHeaders: &blob.HTTPHeaders{
 			BlobCacheControl:    &cacheControl,
 			BlobContentEncoding: contentEncoding,
 			BlobContentType:     &contentType,
 		},
-		Tags: s.tags,
+		Metadata:   metadata,
+		AccessTier: accessTier,
+		Tags:       tags,
 	})
 	return err
 }
 
+// accessTierFor returns the blob access tier closest to the S3 storage class, nil means account's default tier
+func accessTierFor(class objectstorage.StorageClass) *blob.AccessTier {
+	switch class {
+	case objectstorage.StandardStorageClass:
+		return to.Ptr(blob.AccessTierHot)
+	case objectstorage.StandardIAStorageClass:
+		return to.Ptr(blob.AccessTierCool)
+	case objectstorage.GlacierStorageClass:
+		return to.Ptr(blob.AccessTierArchive)
+	default:
+		return nil
+	}
+}
+
+// blobName removes the leading slash of the key to avoid empty folder creation, all methods address the same blob
+func blobName(key string) string {
+	return strings.TrimPrefix(key, "/")
+}
+
+func (s *storageImpl) Head(key string) (*objectstorage.ObjectInfo, error) {
+	props, err := s.client.ServiceClient().NewContainerClient(s.container).NewBlobClient(blobName(key)).GetProperties(context.Background(), nil)
+	if err != nil {
+		return nil, err
+	}
+	info := &objectstorage.ObjectInfo{
+		Metadata: make(map[string]string, len(props.Metadata)),
+	}
+	if props.ContentLength != nil {
+		info.Size = *props.ContentLength
+	}
+	for k, v := range props.Metadata {
+		if v != nil {
+			info.Metadata[strings.ToLower(k)] = *v
+		}
+	}
+	return info, nil
+}
+
 func (s *storageImpl) Get(key string) (io.ReadCloser, error) {
 	ctx := context.Background()
-	get, err := s.client.DownloadStream(ctx, s.container, key, nil)
+	get, err := s.client.DownloadStream(ctx, s.container, blobName(key), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -94,13 +167,23 @@ func (s *storageImpl) Get(key string) (io.ReadCloser, error) {
 	return io.NopCloser(bytes.NewReader(downloadedData.Bytes())), err
 }
 
+func (s *storageImpl) GetRange(key string, offset, size int64) (io.ReadCloser, error) {
+	get, err := s.client.DownloadStream(context.Background(), s.container, blobName(key), &azblob.DownloadStreamOptions{
+		Range: blob.HTTPRange{Offset: offset, Count: size},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return get.Body, nil
+}
+
 func (s *storageImpl) GetAll(key string) ([]io.ReadCloser, error) {
 	return nil, errors.New("not implemented")
 }
 
 func (s *storageImpl) Exists(key string) bool {
 	ctx := context.Background()
-	get, err := s.client.DownloadStream(ctx, s.container, key, nil)
+	get, err := s.client.DownloadStream(ctx, s.container, blobName(key), nil)
 	if err != nil {
 		return false
 	}
@@ -110,9 +193,14 @@ func (s *storageImpl) Exists(key string) bool {
 	return true
 }
 
+func (s *storageImpl) Delete(key string) error {
+	_, err := s.client.DeleteBlob(context.Background(), s.container, blobName(key), nil)
+	return err
+}
+
 func (s *storageImpl) GetCreationTime(key string) *time.Time {
 	ctx := context.Background()
-	get, err := s.client.DownloadStream(ctx, s.container, key, nil)
+	get, err := s.client.DownloadStream(ctx, s.container, blobName(key), nil)
 	if err != nil {
 		return nil
 	}
@@ -123,6 +211,9 @@ func (s *storageImpl) GetCreationTime(key string) *time.Time {
 }
 
 func (s *storageImpl) GetPreSignedUploadUrl(key string) (string, error) {
+	if s.cred == nil {
+		return "", errors.New("pre-signed urls require azure account name and key")
+	}
 	// Set the desired SAS permissions and options for uploading
 	sasQueryParams, err := sas.BlobSignatureValues{
 		Protocol:      sas.ProtocolHTTPS,
@@ -130,7 +221,7 @@ func (s *storageImpl) GetPreSignedUploadUrl(key string) (string, error) {
 		ExpiryTime:    time.Now().UTC().Add(time.Hour),
 		Permissions:   to.Ptr(sas.BlobPermissions{Read: true, Create: true, Write: true, Tag: true}).String(),
 		ContainerName: s.container,
-		BlobName:      key,
+		BlobName:      blobName(key),
 	}.SignWithSharedKey(s.cred)
 	if err != nil {
 		return "", err
@@ -140,6 +231,26 @@ func (s *storageImpl) GetPreSignedUploadUrl(key string) (string, error) {
 	return sasURL, nil
 }
 
+func (s *storageImpl) GetPreSignedDownloadUrl(key string, ttl time.Duration, contentEncoding string) (string, error) {
+	if s.cred == nil {
+		return "", errors.New("pre-signed urls require azure account name and key")
+	}
+	key = blobName(key)
+	sasQueryParams, err := sas.BlobSignatureValues{
+		Protocol:        sas.ProtocolHTTPS,
+		StartTime:       time.Now().UTC(),
+		ExpiryTime:      time.Now().UTC().Add(ttl),
+		Permissions:     to.Ptr(sas.BlobPermissions{Read: true}).String(),
+		ContainerName:   s.container,
+		BlobName:        key,
+		ContentEncoding: contentEncoding,
+	}.SignWithSharedKey(s.cred)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("https://%s.blob.core.windows.net/%s/%s?%s", s.account, s.container, key, sasQueryParams.Encode()), nil
+}
+
 func loadFileTag() map[string]string {
 	// Load file tag from env
 	key := "retention"
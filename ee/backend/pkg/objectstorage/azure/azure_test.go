@@ -0,0 +1,214 @@
+package azure
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	config "openreplay/backend/internal/config/objectstorage"
+	"openreplay/backend/pkg/objectstorage"
+)
+
+// Azurite's well-known development account
+const (
+	testAccount    = "devstoreaccount1"
+	testAccountKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+	testContainer  = "mobs"
+)
+
+type testBlob struct {
+	data   []byte
+	header http.Header // x-ms-* and content headers of the committed blob
+}
+
+// blobServer is the minimal in-memory blob service: staged block uploads, properties, (range) downloads and deletes
+type blobServer struct {
+	mu     sync.Mutex
+	blocks map[string][]byte
+	blobs  map[string]*testBlob
+}
+
+func newBlobServer(t *testing.T) *httptest.Server {
+	s := &blobServer{blocks: make(map[string][]byte), blobs: make(map[string]*testBlob)}
+	server := httptest.NewServer(s)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *blobServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	prefix := "/" + testAccount + "/" + testContainer + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, prefix)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		blob := &testBlob{header: make(http.Header)}
+		for k, v := range r.Header {
+			if strings.HasPrefix(strings.ToLower(k), "x-ms-") {
+				blob.header[k] = v
+			}
+		}
+		switch r.URL.Query().Get("comp") {
+		case "":
+			// Small streams are uploaded with a single request
+			blob.data = body
+			s.blobs[name] = blob
+		case "block":
+			s.blocks[name+"/"+r.URL.Query().Get("blockid")] = body
+		case "blocklist":
+			list := struct {
+				Latest []string `xml:"Latest"`
+			}{}
+			if err := xml.Unmarshal(body, &list); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			for _, id := range list.Latest {
+				blob.data = append(blob.data, s.blocks[name+"/"+id]...)
+			}
+			s.blobs[name] = blob
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	case http.MethodHead, http.MethodGet:
+		blob, ok := s.blobs[name]
+		if !ok {
+			w.Header().Set("x-ms-error-code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		for k, v := range blob.header {
+			if strings.HasPrefix(strings.ToLower(k), "x-ms-meta-") {
+				w.Header()[k] = v
+			}
+		}
+		data, status := blob.data, http.StatusOK
+		if rng := r.Header.Get("x-ms-range"); rng != "" {
+			var start, end int
+			if _, err := fmt.Sscanf(rng, "bytes=%d-%d", &start, &end); err != nil || end >= len(data) {
+				w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			data, status = data[start:end+1], http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			w.Write(data)
+		}
+	case http.MethodDelete:
+		if _, ok := s.blobs[name]; !ok {
+			w.Header().Set("x-ms-error-code", "BlobNotFound")
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		delete(s.blobs, name)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *blobServer) blob(name string) (*testBlob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	blob, ok := s.blobs[name]
+	return blob, ok
+}
+
+func newTestStorage(t *testing.T) (objectstorage.ObjectStorage, *blobServer) {
+	server := newBlobServer(t)
+	connString := fmt.Sprintf("DefaultEndpointsProtocol=http;AccountName=%s;AccountKey=%s;BlobEndpoint=%s/%s;",
+		testAccount, testAccountKey, server.URL, testAccount)
+	storage, err := NewStorage(&config.ObjectsConfig{BucketName: testContainer, AzureConnString: connString})
+	if err != nil {
+		t.Fatalf("can't create storage from connection string: %s", err)
+	}
+	return storage, server.Config.Handler.(*blobServer)
+}
+
+func TestUploadWithOptions(t *testing.T) {
+	storage, server := newTestStorage(t)
+	opts := &objectstorage.UploadOptions{
+		Metadata:     map[string]string{"checksum": "abc"},
+		StorageClass: objectstorage.StandardIAStorageClass,
+		Tags:         map[string]string{"project": "7"},
+	}
+	if err := storage.UploadWithOptions(strings.NewReader("dom"), "/1/dom.mobs", "application/octet-stream",
+		objectstorage.Gzip, opts); err != nil {
+		t.Fatal(err)
+	}
+	blob, ok := server.blob("1/dom.mobs")
+	if !ok {
+		t.Fatal("blob wasn't uploaded without the leading slash")
+	}
+	for header, expected := range map[string]string{
+		"x-ms-meta-checksum":         "abc",
+		"x-ms-access-tier":           "Cool",
+		"x-ms-blob-content-encoding": "gzip",
+		"x-ms-blob-content-type":     "application/octet-stream",
+		"x-ms-blob-cache-control":    "max-age=2628000, immutable, private",
+	} {
+		if value := blob.header.Get(header); value != expected {
+			t.Errorf("wrong %s: %q", header, value)
+		}
+	}
+	if tags := blob.header.Get("x-ms-tags"); !strings.Contains(tags, "project=7") || !strings.Contains(tags, "retention=") {
+		t.Errorf("wrong tags: %q", tags)
+	}
+}
+
+func TestReadAndDelete(t *testing.T) {
+	storage, server := newTestStorage(t)
+	if err := storage.Upload(strings.NewReader("dom file"), "1/dom.mobs", "application/octet-stream",
+		objectstorage.NoCompression); err != nil {
+		t.Fatal(err)
+	}
+	// Keys with and without the leading slash address the same blob
+	for _, key := range []string{"1/dom.mobs", "/1/dom.mobs"} {
+		info, err := storage.Head(key)
+		if err != nil {
+			t.Fatalf("can't head %s: %s", key, err)
+		}
+		if info.Size != int64(len("dom file")) {
+			t.Errorf("wrong size of %s: %d", key, info.Size)
+		}
+		reader, err := storage.GetRange(key, 4, 4)
+		if err != nil {
+			t.Fatalf("can't get range of %s: %s", key, err)
+		}
+		data, _ := io.ReadAll(reader)
+		reader.Close()
+		if string(data) != "file" {
+			t.Errorf("wrong range of %s: %q", key, data)
+		}
+		if !storage.Exists(key) {
+			t.Errorf("%s should exist", key)
+		}
+	}
+	if _, err := storage.Head("2/dom.mobs"); err == nil {
+		t.Error("head of the missing blob should fail")
+	}
+	if err := storage.Delete("/1/dom.mobs"); err != nil {
+		t.Fatalf("can't delete blob: %s", err)
+	}
+	if _, ok := server.blob("1/dom.mobs"); ok {
+		t.Error("blob wasn't deleted")
+	}
+	if err := storage.Delete("1/dom.mobs"); err == nil {
+		t.Error("delete of the missing blob should fail")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	objConfig "openreplay/backend/internal/config/objectstorage"
 	"openreplay/backend/pkg/objectstorage"
 	"openreplay/backend/pkg/objectstorage/azure"
+	"openreplay/backend/pkg/objectstorage/gcs"
 	"openreplay/backend/pkg/objectstorage/s3"
 )
 
@@ -15,5 +16,8 @@ func NewStore(cfg *objConfig.ObjectsConfig) (objectstorage.ObjectStorage, error)
 	if cfg.CloudName == "azure" {
 		return azure.NewStorage(cfg)
 	}
+	if cfg.CloudName == "gcp" {
+		return gcs.NewStorage(cfg)
+	}
 	return s3.NewS3(cfg)
 }